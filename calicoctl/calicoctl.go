@@ -16,12 +16,15 @@ package main
 
 import (
 	"fmt"
+	"strconv"
+	"time"
 
 	"os"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/docopt/docopt-go"
 	"github.com/projectcalico/calico-containers/calicoctl/commands"
+	"github.com/projectcalico/calico-containers/calicoctl/commands/clientmgr"
 )
 
 func main() {
@@ -36,15 +39,33 @@ func main() {
               name.
     get       Get a resource identified by file, stdin or resource type and
               name.
+    convert   Convert resources in another format to Calico resources.
+    explain   Describe the fields of a resource type.
+    api-resources
+              List the supported resource types.
+    events    Display a stream of the changes to resources and configuration.
     config    Manage system-wide and low-level node configuration options.
+    context   Manage the datastore contexts in the calicoctl config file.
+    datastore Check the connectivity to the datastore.
     ipam      IP address management.
+    migrate   Migrate resources from deprecated features.
     node      Calico node management.
+    policy    Analyze and manage policy.
+    graph     Export the graph of the policies, profiles and endpoints.
     version   Display the version of calicoctl.
 
 Options:
   -h --help               Show this screen.
   -l --log-level=<level>  Set the log level (one of panic, fatal, error,
                           warn, info, debug) [default: panic]
+  --context=<CONTEXT>     The name of the datastore context in the calicoctl
+                          config file to use, overriding the current context.
+  --timeout=<TIMEOUT>     The timeout for each datastore operation, e.g. 10s.
+                          A timeout of 0 disables the timeout.  Overrides the
+                          timeout in the calicoctl config file.
+  --retries=<RETRIES>     The number of times to retry a datastore operation
+                          that fails with a transient error.  Overrides the
+                          retries in the calicoctl config file.
 
 Description:
   The calicoctl command line tool is used to manage Calico network and security
@@ -52,6 +73,34 @@ Description:
   node instance.
 
   See 'calicoctl <command> --help' to read about a specific subcommand.
+
+  The commands that modify the datastore (create, apply, replace, delete,
+  config set, config unset, ipam release, policy move, policy renumber and
+  migrate tags-to-labels) may be recorded in an audit log.  To enable the audit
+  log, set auditLog.path in the spec of the calicoctl config file, or set the
+  CALICOCTL_AUDIT_LOG environment variable, to either the path of the audit
+  log file or "syslog".  Each command appends a single line JSON record.  The
+  audit log file is rotated when it reaches auditLog.maxSizeMB (default 100),
+  keeping auditLog.maxBackups (default 5) rotated files.
+
+  The same commands may be restricted by local policy in the spec of the
+  calicoctl config file.  Setting readOnly to true (or setting the
+  CALICOCTL_READ_ONLY environment variable to true) prevents all of these
+  commands.  Setting allow to a list of rules, each containing a list of kinds
+  and a list of actions, permits only the listed actions on the listed kinds.
+  The actions are create, apply, replace and delete for resources, set and
+  unset for the Config kind, and release for the IPAddress kind.  The policy
+  move and policy renumber commands replace policies, and the migrate
+  tags-to-labels command replaces profiles and policies.  A kind or action of
+  "*" matches any kind or action.
+
+  Each datastore operation is subject to a timeout (default 30s) and is retried
+  with exponential backoff if it fails with a transient error (default 2
+  retries).  These may be set using timeout and retries in the spec of the
+  calicoctl config file, the CALICOCTL_TIMEOUT and CALICOCTL_RETRIES
+  environment variables, or the --timeout and --retries options.  Operations
+  that modify the datastore are only retried if the datastore could not be
+  reached, and not after a timeout, since the operation may have been applied.
 `
 	arguments, _ := docopt.Parse(doc, nil, true, commands.VERSION_SUMMARY, true, false)
 
@@ -67,6 +116,27 @@ Description:
 		}
 	}
 
+	if context := arguments["--context"]; context != nil {
+		clientmgr.SelectedContext = context.(string)
+	}
+
+	if timeout := arguments["--timeout"]; timeout != nil {
+		t, err := time.ParseDuration(timeout.(string))
+		if err != nil || t < 0 {
+			fmt.Printf("Invalid timeout: %s\n", timeout)
+			os.Exit(1)
+		}
+		clientmgr.TimeoutOverride = t
+	}
+	if retries := arguments["--retries"]; retries != nil {
+		r, err := strconv.Atoi(retries.(string))
+		if err != nil || r < 0 {
+			fmt.Printf("Invalid retries: %s\n", retries)
+			os.Exit(1)
+		}
+		clientmgr.RetriesOverride = r
+	}
+
 	if arguments["<command>"] != nil {
 		command := arguments["<command>"].(string)
 		args := append([]string{command}, arguments["<args>"].([]string)...)
@@ -82,14 +152,32 @@ Description:
 			commands.Delete(args)
 		case "get":
 			commands.Get(args)
+		case "convert":
+			commands.Convert(args)
+		case "explain":
+			commands.Explain(args)
+		case "api-resources":
+			commands.APIResources(args)
+		case "events":
+			commands.Events(args)
 		case "version":
 			commands.Version(args)
 		case "node":
 			commands.Node(args)
+		case "policy":
+			commands.Policy(args)
+		case "graph":
+			commands.Graph(args)
 		case "ipam":
 			commands.IPAM(args)
+		case "migrate":
+			commands.Migrate(args)
 		case "config":
 			commands.Config(args)
+		case "context":
+			commands.Context(args)
+		case "datastore":
+			commands.Datastore(args)
 		default:
 			fmt.Println(doc)
 		}
@@ -0,0 +1,71 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/docopt/docopt-go"
+	"github.com/projectcalico/calico-containers/calicoctl/resourcemgr"
+)
+
+func APIResources(args []string) {
+	doc := `Usage:
+  calicoctl api-resources
+
+Options:
+  -h --help   Show this screen.
+
+Description:
+  The api-resources command lists the resource types that are supported by the
+  resource management commands (create, apply, replace, delete, get).
+
+  For each resource type the following is displayed:
+    NAME          The plural name of the resource type.
+    SHORTNAMES    Short names that may be used in place of the resource type.
+    KIND          The kind of the resource, as used in the YAML and JSON
+                  resource definitions.
+    NODESCOPED    Whether the resource is specific to a node.
+    IDENTIFIERS   The arguments used to identify a resource of this type on
+                  the command line.
+
+  Any of the names of a resource type may be used as the <KIND> on the command
+  line.  The names are case insensitive.
+`
+	arguments, err := docopt.Parse(doc, args, true, "", false, false)
+	if err != nil {
+		fmt.Printf("Invalid option: 'calicoctl %s'. Use flag '--help' to read about a specific subcommand.\n", strings.Join(args, " "))
+		os.Exit(1)
+	}
+	if len(arguments) == 0 {
+		return
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 5, 1, 3, ' ', 0)
+	fmt.Fprintf(writer, "NAME\tSHORTNAMES\tKIND\tNODESCOPED\tIDENTIFIERS\t\n")
+	for _, ki := range resourcemgr.Kinds() {
+		ids := make([]string, len(ki.Identifiers))
+		for i, id := range ki.Identifiers {
+			ids[i] = id.Arg
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%s\t%v\t%s\t\n",
+			ki.Plural, strings.Join(ki.ShortNames, ","), ki.Kind, ki.NodeScoped,
+			strings.Join(ids, ","))
+	}
+	writer.Flush()
+}
@@ -27,7 +27,8 @@ import (
 
 func Apply(args []string) {
 	doc := constants.DatastoreIntro + `Usage:
-  calicoctl apply --filename=<FILENAME> [--config=<CONFIG>]
+  calicoctl apply --filename=<FILENAME> [--parallelism=<N>]
+                  [--config=<CONFIG>]
 
 Examples:
   # Apply a policy using the data in policy.yaml.
@@ -40,6 +41,8 @@ Options:
   -h --help                 Show this screen.
   -f --filename=<FILENAME>  Filename to use to apply the resource.  If set to
                             "-" loads from stdin.
+     --parallelism=<N>      The number of resources to apply concurrently.
+                            [default: 1]
   -c --config=<CONFIG>      Path to the file containing connection
                             configuration in YAML or JSON format.
                             [default: /etc/calico/calicoctl.cfg]
@@ -48,8 +51,7 @@ Description:
   The apply command is used to create or replace a set of resources by filename
   or stdin.  JSON and YAML formats are accepted.
 
-  Valid resource types are node, bgpPeer, hostEndpoint, workloadEndpoint,
-  ipPool, policy, and profile.
+  The valid resource types are listed by 'calicoctl api-resources'.
 
   When applying a resource:
   -  if the resource does not already exist (as determined by it's primary
@@ -67,6 +69,14 @@ Description:
   When applying a resource to perform an update, the complete resource spec
   must be provided, it is not sufficient to supply only the fields that are
   being updated.
+
+  The --parallelism option sets the number of resources that are applied
+  concurrently.  Consecutive resources of the same type are applied
+  concurrently, and each group of resources is completed before the next group
+  is started, so that resources are applied after the resources they depend on.
+  Results are reported in the order the resources are specified and progress is
+  written to stderr.  When processing concurrently, resources that follow a
+  failed resource in the same group may also have been applied.
 `
 	parsedArgs, err := docopt.Parse(doc, args, true, "", false, false)
 	if err != nil {
@@ -101,15 +111,7 @@ Description:
 			fmt.Printf("Successfully applied %d resource(s)\n", results.numHandled)
 		}
 	} else {
-		fmt.Printf("Partial success: ")
-		if results.singleKind != "" {
-			fmt.Printf("applied the first %d out of %d '%s' resources:\n",
-				results.numHandled, results.numResources, results.singleKind)
-		} else {
-			fmt.Printf("applied the first %d out of %d resources:\n",
-				results.numHandled, results.numResources)
-		}
-		fmt.Printf("Hit error: %v\n", results.err)
+		printPartialSuccess(results, "applied")
 		os.Exit(1)
 	}
 }
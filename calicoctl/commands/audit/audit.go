@@ -0,0 +1,196 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package audit writes the audit log of the calicoctl commands that modify the datastore.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+	"os"
+	"os/user"
+	"syscall"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/projectcalico/calico-containers/calicoctl/commands/clientmgr"
+)
+
+// The audit log path used to indicate that records are written to the local syslog.
+const syslogPath = "syslog"
+
+// The results of an audited command.
+const (
+	ResultSuccess = "success"
+	ResultPartial = "partial"
+	ResultFailure = "failure"
+)
+
+// Record is a single audit log record, written as a single line of JSON.
+type Record struct {
+	Time      time.Time  `json:"time"`
+	User      string     `json:"user"`
+	Host      string     `json:"host"`
+	Command   []string   `json:"command"`
+	Action    string     `json:"action"`
+	Resources []Resource `json:"resources,omitempty"`
+	Result    string     `json:"result"`
+	Error     string     `json:"error,omitempty"`
+}
+
+// Resource is the change made to a single resource (or configuration value) by an audited
+// command.  Before is nil if the resource did not previously exist, After is nil if the
+// resource does not exist after the command, or the command failed.
+type Resource struct {
+	Kind        string            `json:"kind"`
+	Identifiers map[string]string `json:"identifiers"`
+	Before      interface{}       `json:"before,omitempty"`
+	After       interface{}       `json:"after,omitempty"`
+}
+
+// Logger writes audit records to the configured audit log.  A nil Logger is valid and
+// indicates that audit logging is disabled.
+type Logger struct {
+	cfg clientmgr.AuditLogConfig
+}
+
+// NewLogger returns a Logger using the audit log settings from the calicoctl config, or
+// nil if audit logging is not enabled.
+func NewLogger(cfg clientmgr.AuditLogConfig) *Logger {
+	if cfg.Path == "" {
+		return nil
+	}
+	return &Logger{cfg: cfg}
+}
+
+// Enabled returns true if audit logging is enabled.
+func (l *Logger) Enabled() bool {
+	return l != nil
+}
+
+// Log writes an audit record for the action.  The result is determined from the number of
+// resources that were handled and the error returned by the command.
+func (l *Logger) Log(action string, resources []Resource, numHandled int, cmdErr error) error {
+	if l == nil {
+		return nil
+	}
+
+	r := Record{
+		Time:      time.Now().UTC(),
+		User:      currentUser(),
+		Command:   os.Args,
+		Action:    action,
+		Resources: resources,
+		Result:    ResultSuccess,
+	}
+	r.Host, _ = os.Hostname()
+	if cmdErr != nil {
+		r.Error = cmdErr.Error()
+		if numHandled > 0 {
+			r.Result = ResultPartial
+		} else {
+			r.Result = ResultFailure
+		}
+	}
+
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	log.Debugf("Writing audit record: %s", string(b))
+
+	if l.cfg.Path == syslogPath {
+		return writeSyslog(b)
+	}
+	return l.writeFile(append(b, '\n'))
+}
+
+// currentUser returns the name of the user running calicoctl.  If run through sudo, the
+// invoking user is included.
+func currentUser() string {
+	name := os.Getenv("USER")
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	if sudo := os.Getenv("SUDO_USER"); sudo != "" && sudo != name {
+		name = fmt.Sprintf("%s (sudo from %s)", name, sudo)
+	}
+	return name
+}
+
+// writeSyslog writes the record to the local syslog.
+func writeSyslog(b []byte) error {
+	w, err := syslog.New(syslog.LOG_AUTH|syslog.LOG_NOTICE, "calicoctl")
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	return w.Notice(string(b))
+}
+
+// writeFile appends the record to the audit log file, rotating the file first if the
+// record would take it over the maximum size.  An exclusive lock on a separate lock file
+// is held while rotating and writing, so that concurrent invocations of calicoctl do not
+// interleave records or lose records during rotation.
+func (l *Logger) writeFile(b []byte) error {
+	lock, err := os.OpenFile(l.cfg.Path+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	if err = syscall.Flock(int(lock.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	defer syscall.Flock(int(lock.Fd()), syscall.LOCK_UN)
+
+	if fi, err := os.Stat(l.cfg.Path); err == nil &&
+		fi.Size() > 0 && fi.Size()+int64(len(b)) > int64(l.cfg.MaxSizeMB)*1024*1024 {
+		if err = l.rotate(); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.OpenFile(l.cfg.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// rotate renames the audit log file to <path>.1, shifting the existing backups up by one
+// and removing the oldest backup.  This must be called with the lock held.
+func (l *Logger) rotate() error {
+	log.Infof("Rotating audit log %s", l.cfg.Path)
+	backup := func(n int) string {
+		return fmt.Sprintf("%s.%d", l.cfg.Path, n)
+	}
+	if err := os.Remove(backup(l.cfg.MaxBackups)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for n := l.cfg.MaxBackups - 1; n > 0; n-- {
+		if err := os.Rename(backup(n), backup(n+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.Rename(l.cfg.Path, backup(1))
+}
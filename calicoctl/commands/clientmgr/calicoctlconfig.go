@@ -0,0 +1,210 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clientmgr
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ghodss/yaml"
+	"github.com/projectcalico/calico-containers/calicoctl/resourcemgr"
+)
+
+// CalicoctlConfig contains the settings that are specific to calicoctl rather than to the
+// datastore connection.  These are stored in the spec of the calicoctl config file
+// alongside the datastore connection settings, e.g.
+//
+//	apiVersion: v1
+//	kind: calicoApiConfig
+//	metadata:
+//	spec:
+//	  datastoreType: etcdv2
+//	  etcdEndpoints: http://etcd:2379
+//	  auditLog:
+//	    path: /var/log/calico/calicoctl-audit.log
+//	  allow:
+//	  - kinds: [policy, profile]
+//	    actions: [create, apply, replace]
+//
+// Each setting may also be set using an environment variable, which takes precedence over
+// the config file.
+type CalicoctlConfig struct {
+	AuditLog AuditLogConfig `json:"auditLog"`
+
+	// Whether calicoctl is prevented from modifying the datastore.
+	// Environment variable: CALICOCTL_READ_ONLY.
+	ReadOnly bool `json:"readOnly"`
+
+	// The operations that calicoctl is permitted to perform that modify the datastore.
+	// If empty, all operations are permitted (unless ReadOnly is set).
+	Allow []AllowRule `json:"allow"`
+
+	// The timeout for each datastore operation, e.g. "30s".  Defaults to 30s, a value
+	// of 0 disables the timeout.  Environment variable: CALICOCTL_TIMEOUT.
+	Timeout string `json:"timeout"`
+
+	// The number of times a datastore operation that fails with a transient error is
+	// retried.  Defaults to 2.  Environment variable: CALICOCTL_RETRIES.
+	Retries *int `json:"retries"`
+
+	// The resolved timeout and retries.
+	timeout time.Duration
+	retries int
+}
+
+// AllowRule permits each of the actions to be performed on each of the kinds.  The kind
+// may be any of the names of a resource kind (e.g. policy, policies, pol), "Config" for the
+// configuration managed by "calicoctl config" or "IPAddress" for "calicoctl ipam".  The
+// actions are create, apply, replace and delete for resources, set and unset for
+// configuration, and release for IP addresses.  A kind or action of "*" matches all kinds
+// or actions.
+type AllowRule struct {
+	Kinds   []string `json:"kinds"`
+	Actions []string `json:"actions"`
+}
+
+// AuditLogConfig contains the audit log settings.  The audit log is disabled if the path
+// is blank.
+type AuditLogConfig struct {
+	// The path of the audit log file, or "syslog" to write to the local syslog.
+	// Environment variable: CALICOCTL_AUDIT_LOG.
+	Path string `json:"path"`
+
+	// The size in megabytes at which the audit log file is rotated.  Defaults to 100.
+	MaxSizeMB int `json:"maxSizeMB"`
+
+	// The number of rotated audit log files to keep.  Defaults to 5.
+	MaxBackups int `json:"maxBackups"`
+}
+
+const (
+	defaultAuditLogMaxSizeMB  = 100
+	defaultAuditLogMaxBackups = 5
+	defaultTimeout            = 30 * time.Second
+	defaultRetries            = 2
+)
+
+// calicoctlConfigFile is used to extract the calicoctl settings from the config file.
+type calicoctlConfigFile struct {
+	Spec CalicoctlConfig `json:"spec"`
+}
+
+// LoadCalicoctlConfig loads the calicoctl specific settings from the config file (if it
+// exists) and the environment.
+func LoadCalicoctlConfig(cf string) (*CalicoctlConfig, error) {
+	var c calicoctlConfigFile
+	if b, err := ioutil.ReadFile(cf); err != nil {
+		log.Infof("Config file cannot be read - reading calicoctl settings from environment")
+	} else if err = yaml.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+	cfg := &c.Spec
+
+	if v := os.Getenv("CALICOCTL_AUDIT_LOG"); v != "" {
+		cfg.AuditLog.Path = v
+	}
+	if v := os.Getenv("CALICOCTL_READ_ONLY"); v != "" {
+		ro, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for CALICOCTL_READ_ONLY '%s'", v)
+		}
+		cfg.ReadOnly = ro
+	}
+	if v := os.Getenv("CALICOCTL_TIMEOUT"); v != "" {
+		cfg.Timeout = v
+	}
+	cfg.timeout = defaultTimeout
+	if cfg.Timeout != "" {
+		t, err := time.ParseDuration(cfg.Timeout)
+		if err != nil || t < 0 {
+			return nil, fmt.Errorf("invalid datastore timeout '%s'", cfg.Timeout)
+		}
+		cfg.timeout = t
+	}
+	if v := os.Getenv("CALICOCTL_RETRIES"); v != "" {
+		r, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for CALICOCTL_RETRIES '%s'", v)
+		}
+		cfg.Retries = &r
+	}
+	cfg.retries = defaultRetries
+	if cfg.Retries != nil {
+		if *cfg.Retries < 0 {
+			return nil, fmt.Errorf("invalid datastore retries '%d'", *cfg.Retries)
+		}
+		cfg.retries = *cfg.Retries
+	}
+	if cfg.AuditLog.MaxSizeMB <= 0 {
+		cfg.AuditLog.MaxSizeMB = defaultAuditLogMaxSizeMB
+	}
+	if cfg.AuditLog.MaxBackups <= 0 {
+		cfg.AuditLog.MaxBackups = defaultAuditLogMaxBackups
+	}
+	return cfg, nil
+}
+
+// Permitted returns an ErrNotPermitted error if the local policy in the calicoctl config
+// does not permit the action to be performed on the kind.
+func (c *CalicoctlConfig) Permitted(kind, action string) error {
+	if c.ReadOnly {
+		return ErrNotPermitted{Kind: kind, Action: action, Reason: "calicoctl is configured as read-only"}
+	}
+	if len(c.Allow) == 0 {
+		return nil
+	}
+	for _, rule := range c.Allow {
+		if matchesAny(rule.Kinds, kind, canonicalKind) && matchesAny(rule.Actions, action, strings.ToLower) {
+			return nil
+		}
+	}
+	return ErrNotPermitted{Kind: kind, Action: action, Reason: "the action is not in the allow list"}
+}
+
+// matchesAny returns true if any of the values match the supplied value, or are "*".  The
+// values are normalized using the supplied function before comparing.
+func matchesAny(values []string, value string, normalize func(string) string) bool {
+	for _, v := range values {
+		if v == "*" || normalize(v) == normalize(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// canonicalKind returns the lowercase kind name for any of the names of a resource kind.
+func canonicalKind(name string) string {
+	if ki, err := resourcemgr.LookupKind(name); err == nil {
+		return strings.ToLower(ki.Kind)
+	}
+	return strings.ToLower(name)
+}
+
+// ErrNotPermitted is returned when an operation is not permitted by the local policy in
+// the calicoctl config.
+type ErrNotPermitted struct {
+	Kind   string
+	Action string
+	Reason string
+}
+
+func (e ErrNotPermitted) Error() string {
+	return fmt.Sprintf("operation not permitted by local policy: %s %s (%s)", e.Action, e.Kind, e.Reason)
+}
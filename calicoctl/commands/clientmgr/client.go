@@ -15,6 +15,7 @@
 package clientmgr
 
 import (
+	"fmt"
 	"os"
 
 	log "github.com/Sirupsen/logrus"
@@ -33,6 +34,14 @@ func NewClient(cf string) (*client.Client, error) {
 	}
 	log.Infof("Loaded client config: type=%v %#v", cfg.BackendType, cfg.BackendConfig)
 
+	// Configure the timeout and retries of the datastore operations performed using the
+	// client.
+	ctlCfg, err := LoadCalicoctlConfig(cf)
+	if err != nil {
+		return nil, err
+	}
+	configureRetries(ctlCfg)
+
 	c, err := client.New(*cfg)
 	if err != nil {
 		return nil, err
@@ -41,9 +50,23 @@ func NewClient(cf string) (*client.Client, error) {
 	return c, err
 }
 
-// LoadClientConfig loads the client config from file if the file exists,
-// otherwise will load from environment variables.
+// LoadClientConfig loads the client config from the selected context in the file if a
+// context is selected, otherwise from file if the file exists, otherwise will load from
+// environment variables.
 func LoadClientConfig(cf string) (*api.ClientConfig, error) {
+	ctx, err := selectedContext(cf)
+	if err != nil {
+		return nil, err
+	}
+	if ctx != nil {
+		log.Infof("Loading config from context %s", ctx.Name)
+		b, err := contextConfigBytes(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return client.LoadClientConfigFromBytes(b)
+	}
+
 	if _, err := os.Stat(cf); err != nil {
 		log.Infof("Config file cannot be read - reading config from environment")
 		cf = ""
@@ -51,3 +74,19 @@ func LoadClientConfig(cf string) (*api.ClientConfig, error) {
 
 	return client.LoadClientConfig(cf)
 }
+
+// ConfigSource describes where LoadClientConfig loads the client config from: the
+// selected context, the config file, or the environment variables.
+func ConfigSource(cf string) (string, error) {
+	ctx, err := selectedContext(cf)
+	if err != nil {
+		return "", err
+	}
+	if ctx != nil {
+		return fmt.Sprintf("context '%s' in file %s", ctx.Name, cf), nil
+	}
+	if _, err := os.Stat(cf); err != nil {
+		return "environment variables", nil
+	}
+	return "file " + cf, nil
+}
@@ -0,0 +1,180 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clientmgr
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/ghodss/yaml"
+)
+
+// SelectedContext is the name of the context selected using the global --context option.
+// If blank, the CALICOCTL_CONTEXT environment variable and then the current context in
+// the config file are used.
+var SelectedContext string
+
+// Context is a named set of datastore connection settings.  The config file may contain
+// multiple contexts along with the name of the current context, e.g.
+//
+//	apiVersion: v1
+//	kind: calicoApiConfig
+//	metadata:
+//	spec:
+//	  currentContext: prod
+//	  contexts:
+//	  - name: prod
+//	    spec:
+//	      datastoreType: etcdv2
+//	      etcdEndpoints: https://etcd.prod:2379
+//	  - name: test
+//	    spec:
+//	      datastoreType: etcdv2
+//	      etcdEndpoints: http://etcd.test:2379
+//
+// The spec of a context has the same format as the spec of a config file without contexts.
+type Context struct {
+	Name string                 `json:"name"`
+	Spec map[string]interface{} `json:"spec"`
+}
+
+// contextsSpec is used to extract the contexts from the config file.
+type contextsSpec struct {
+	Spec struct {
+		CurrentContext string    `json:"currentContext"`
+		Contexts       []Context `json:"contexts"`
+	} `json:"spec"`
+}
+
+// LoadContexts returns the name of the current context and the contexts in the config
+// file.  A config file that does not exist contains no contexts.
+func LoadContexts(cf string) (string, []Context, error) {
+	b, err := ioutil.ReadFile(cf)
+	if os.IsNotExist(err) {
+		return "", nil, nil
+	} else if err != nil {
+		return "", nil, err
+	}
+	var c contextsSpec
+	if err = yaml.Unmarshal(b, &c); err != nil {
+		return "", nil, err
+	}
+	return c.Spec.CurrentContext, c.Spec.Contexts, nil
+}
+
+// SaveContexts updates the current context and the contexts in the config file, leaving
+// the other settings in the file unchanged.  The file is created if it does not exist.
+func SaveContexts(cf string, current string, contexts []Context) error {
+	doc := map[string]interface{}{}
+	mode := os.FileMode(0600)
+	if b, err := ioutil.ReadFile(cf); err == nil {
+		if err = yaml.Unmarshal(b, &doc); err != nil {
+			return err
+		}
+		if fi, err := os.Stat(cf); err == nil {
+			mode = fi.Mode()
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if _, ok := doc["apiVersion"]; !ok {
+		doc["apiVersion"] = "v1"
+	}
+	if _, ok := doc["kind"]; !ok {
+		doc["kind"] = "calicoApiConfig"
+	}
+	spec, ok := doc["spec"].(map[string]interface{})
+	if !ok {
+		spec = map[string]interface{}{}
+		doc["spec"] = spec
+	}
+	spec["currentContext"] = current
+	spec["contexts"] = contexts
+
+	b, err := yaml.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(cf, b, mode)
+}
+
+// selectedContext returns the context selected by the --context option, the environment
+// or the current context in the config file, or nil if no context is selected.
+func selectedContext(cf string) (*Context, error) {
+	current, contexts, err := LoadContexts(cf)
+	if err != nil {
+		return nil, err
+	}
+	name := SelectedContext
+	if name == "" {
+		name = os.Getenv("CALICOCTL_CONTEXT")
+	}
+	if name == "" {
+		name = current
+	}
+	if name == "" {
+		return nil, nil
+	}
+	return FindContext(contexts, name)
+}
+
+// FindContext returns the named context.
+func FindContext(contexts []Context, name string) (*Context, error) {
+	for i := range contexts {
+		if contexts[i].Name == name {
+			return &contexts[i], nil
+		}
+	}
+	return nil, fmt.Errorf("context '%s' is not defined in the config file", name)
+}
+
+// contextConfigBytes returns the contents of a config file containing only the connection
+// settings of the context.
+func contextConfigBytes(ctx *Context) ([]byte, error) {
+	return yaml.Marshal(map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "calicoApiConfig",
+		"spec":       ctx.Spec,
+	})
+}
+
+// writeFileAtomic writes the data to a temporary file in the same directory as the target
+// file and then renames it, so that the file is never partially written.
+func writeFileAtomic(path string, data []byte, mode os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	log.Debugf("Writing %s using temporary file %s", path, f.Name())
+	if _, err = f.Write(data); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), mode)
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
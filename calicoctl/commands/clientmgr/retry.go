@@ -0,0 +1,184 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clientmgr
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	calicoErrors "github.com/projectcalico/libcalico-go/lib/errors"
+)
+
+// TimeoutOverride and RetriesOverride are set from the global --timeout and --retries
+// options, and take precedence over the calicoctl config.  A negative value indicates the
+// option was not specified.
+var (
+	TimeoutOverride time.Duration = -1
+	RetriesOverride               = -1
+)
+
+// The timeout and retries used by Read and Write.  These are updated from the calicoctl config when a
+// client is created.
+var (
+	timeout = defaultTimeout
+	retries = defaultRetries
+)
+
+// The initial and maximum delay between retries.  The delay doubles after each retry.
+const (
+	initialRetryDelay = 250 * time.Millisecond
+	maxRetryDelay     = 5 * time.Second
+)
+
+// ErrTimeout is returned when a datastore operation does not complete within the timeout.
+type ErrTimeout struct {
+	Operation string
+	Timeout   time.Duration
+}
+
+func (e ErrTimeout) Error() string {
+	return fmt.Sprintf("timed out after %v waiting for the datastore to %s - check the datastore "+
+		"is reachable (see 'calicoctl datastore check') or increase the --timeout", e.Timeout, e.Operation)
+}
+
+// configureRetries sets the timeout and retries used by Read and Write from the calicoctl config and
+// the global options.
+func configureRetries(cfg *CalicoctlConfig) {
+	timeout, retries = cfg.timeout, cfg.retries
+	if TimeoutOverride >= 0 {
+		timeout = TimeoutOverride
+	}
+	if RetriesOverride >= 0 {
+		retries = RetriesOverride
+	}
+	log.Infof("Datastore timeout %v, retries %d", timeout, retries)
+}
+
+// Read performs a datastore operation that does not modify the datastore, returning the
+// result of the operation.  The operation is retried with exponential backoff if it fails
+// with a transient error, including a timeout.  Each attempt is subject to the timeout, a
+// timeout of zero disables the timeout.  The operation is a description of the operation
+// used in the timeout error message, e.g. "list policies".
+//
+// Note that an operation that times out is abandoned rather than cancelled, so it may
+// still complete.  The function must therefore return its result rather than assign it to
+// variables shared with the caller.
+func Read(operation string, f func() (interface{}, error)) (interface{}, error) {
+	return do(operation, f, isTransient)
+}
+
+// Write performs a datastore operation that modifies the datastore, in the same way as
+// Read.  The operation is only retried if it failed without reaching the datastore, since
+// an operation that timed out or lost its connection may already have been applied, and
+// retrying it may fail (e.g. a create of a resource that now exists) or apply it twice.
+func Write(operation string, f func() (interface{}, error)) (interface{}, error) {
+	return do(operation, f, isUnsent)
+}
+
+// do performs the operation, retrying it with exponential backoff while it fails with an
+// error that the retry function accepts.
+func do(operation string, f func() (interface{}, error), retry func(error) bool) (interface{}, error) {
+	delay := initialRetryDelay
+	for attempt := 0; ; attempt++ {
+		v, err := doWithTimeout(operation, f)
+		if err == nil || attempt >= retries || !retry(err) {
+			return v, err
+		}
+		log.Warnf("Failed to %s (attempt %d of %d), retrying in %v: %v", operation, attempt+1, retries+1, delay, err)
+		time.Sleep(delay)
+		if delay *= 2; delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
+
+// result is the result of a single attempt of an operation.
+type result struct {
+	value interface{}
+	err   error
+}
+
+// doWithTimeout performs the operation, returning an ErrTimeout if it does not complete
+// within the timeout.  The result is passed back over a channel, so an abandoned attempt
+// does not race with the caller or with later attempts.
+func doWithTimeout(operation string, f func() (interface{}, error)) (interface{}, error) {
+	if timeout <= 0 {
+		return f()
+	}
+	done := make(chan result, 1)
+	go func() {
+		v, err := f()
+		done <- result{value: v, err: err}
+	}()
+	select {
+	case r := <-done:
+		return r.value, r.err
+	case <-time.After(timeout):
+		return nil, ErrTimeout{Operation: operation, Timeout: timeout}
+	}
+}
+
+// isTransient returns true if the error may be resolved by retrying the operation.  Errors
+// returned by the datastore about the resources themselves (e.g. the resource does not
+// exist) are not transient.
+func isTransient(err error) bool {
+	switch e := err.(type) {
+	case ErrTimeout:
+		return true
+	case net.Error:
+		return e.Temporary() || e.Timeout()
+	case calicoErrors.ErrorDatastoreError:
+		return isTransient(e.Err)
+	}
+	return isUnavailable(err)
+}
+
+// isUnsent returns true if the error indicates that the operation did not reach the
+// datastore, so that it may be retried even if it modifies the datastore.
+func isUnsent(err error) bool {
+	if e, ok := err.(calicoErrors.ErrorDatastoreError); ok {
+		return isUnsent(e.Err)
+	}
+	return messageContains(err, "cluster is unavailable", "connection refused", "no route to host")
+}
+
+// isUnavailable returns true if the error indicates the datastore could not be reached.
+// The datastore client errors are not typed, so this checks the error message.
+func isUnavailable(err error) bool {
+	if err == io.EOF {
+		return true
+	}
+	return messageContains(err, "cluster is unavailable", "connection refused", "connection reset",
+		"i/o timeout", "no route to host", "unexpected eof")
+}
+
+// messageContains returns true if the error message contains any of the strings, ignoring
+// case.
+func messageContains(err error, strs ...string) bool {
+	if err == nil {
+		return false
+	}
+	msg := strings.ToLower(err.Error())
+	for _, s := range strs {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -23,8 +23,10 @@ import (
 
 	"github.com/docopt/docopt-go"
 	"github.com/projectcalico/calico-containers/calicoctl/commands/argutils"
+	"github.com/projectcalico/calico-containers/calicoctl/commands/audit"
 	"github.com/projectcalico/calico-containers/calicoctl/commands/clientmgr"
 	"github.com/projectcalico/calico-containers/calicoctl/commands/constants"
+	"github.com/projectcalico/libcalico-go/lib/api/unversioned"
 	"github.com/projectcalico/libcalico-go/lib/client"
 	"github.com/projectcalico/libcalico-go/lib/numorstring"
 )
@@ -124,12 +126,58 @@ The table below details the valid config options.
 		os.Exit(1)
 	}
 
-	if parsedArgs["set"].(bool) {
-		err = ct.set(value, node)
-	} else if parsedArgs["unset"].(bool) {
-		err = ct.unset(node)
+	if parsedArgs["get"].(bool) {
+		var v interface{}
+		v, err = clientmgr.Read("get the configuration", func() (interface{}, error) {
+			return ct.get(node)
+		})
+		if err == nil {
+			fmt.Println(v)
+		}
 	} else {
-		err = ct.get(node)
+		// Setting and unsetting the configuration is subject to the local policy.
+		ctlCfg, aerr := clientmgr.LoadCalicoctlConfig(cf)
+		if aerr != nil {
+			fmt.Println(aerr)
+			os.Exit(1)
+		}
+		action := "set"
+		if parsedArgs["unset"].(bool) {
+			action = "unset"
+		}
+		if aerr = ctlCfg.Permitted("Config", action); aerr != nil {
+			fmt.Printf("Error executing command: %s\n", aerr)
+			os.Exit(1)
+		}
+		auditLog := audit.NewLogger(ctlCfg.AuditLog)
+		ar := audit.Resource{
+			Kind:        "Config",
+			Identifiers: map[string]string{"name": name},
+		}
+		if node != "" {
+			ar.Identifiers["node"] = node
+		}
+		if auditLog.Enabled() {
+			ar.Before = getConfigValue(client.Config(), name, node)
+		}
+
+		_, err = clientmgr.Write(action+" the configuration", func() (interface{}, error) {
+			if action == "set" {
+				return nil, ct.set(value, node)
+			}
+			return nil, ct.unset(node)
+		})
+
+		numHandled := 0
+		if err == nil {
+			numHandled = 1
+			if auditLog.Enabled() {
+				ar.After = getConfigValue(client.Config(), name, node)
+			}
+		}
+		if aerr := auditLog.Log("config "+action, []audit.Resource{ar}, numHandled, err); aerr != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write audit log: %v\n", aerr)
+		}
 	}
 
 	if err != nil {
@@ -140,11 +188,34 @@ The table below details the valid config options.
 	return
 }
 
+// getConfigValue returns the current value of the named config option for the node (or
+// the global value if the node is blank).  Returns nil if the value is not explicitly set
+// or cannot be determined.
+func getConfigValue(c client.ConfigInterface, name, node string) interface{} {
+	nodes := []string{}
+	if node != "" {
+		nodes = append(nodes, node)
+	}
+	values, err := clientmgr.Read("get the configuration", func() (interface{}, error) {
+		return listConfigValues(c, nodes)
+	})
+	if err != nil {
+		return nil
+	}
+	for _, v := range values.([]unversioned.Resource) {
+		cv := v.(configValue)
+		if strings.EqualFold(cv.Metadata.Name, name) && cv.Metadata.Node == node {
+			return cv
+		}
+	}
+	return nil
+}
+
 // Config management interface.
 type configType interface {
 	set(value, node string) error
 	unset(node string) error
-	get(node string) error
+	get(node string) (string, error)
 }
 
 // loglevel implements the configType interface.
@@ -168,7 +239,7 @@ func (l loglevel) unset(node string) error {
 	}
 }
 
-func (l loglevel) get(node string) error {
+func (l loglevel) get(node string) (string, error) {
 	var level string
 	var location client.ConfigLocation
 	var err error
@@ -179,14 +250,12 @@ func (l loglevel) get(node string) error {
 		level, location, err = l.c.GetNodeLogLevel(node)
 	}
 	if err != nil {
-		return err
+		return "", err
 	}
 	if location == client.ConfigLocationGlobal {
-		fmt.Printf("%s (inherited from global)\n", level)
-	} else {
-		fmt.Printf("%s\n", level)
+		return level + " (inherited from global)", nil
 	}
-	return nil
+	return level, nil
 }
 
 // nodemesh implements the configType interface.
@@ -217,21 +286,19 @@ func (n nodemesh) unset(node string) error {
 	return n.c.SetNodeToNodeMesh(client.GlobalDefaultNodeToNodeMesh)
 }
 
-func (n nodemesh) get(node string) error {
+func (n nodemesh) get(node string) (string, error) {
 	if node != "" {
-		return errors.New("--node should not be specified")
+		return "", errors.New("--node should not be specified")
 	}
 
 	enabled, err := n.c.GetNodeToNodeMesh()
 	if err != nil {
-		return err
+		return "", err
 	}
 	if enabled {
-		fmt.Println("on")
-	} else {
-		fmt.Println("off")
+		return "on", nil
 	}
-	return nil
+	return "off", nil
 }
 
 // ipip implements the configType interface.
@@ -262,21 +329,19 @@ func (i ipip) unset(node string) error {
 	return i.c.SetGlobalIPIP(client.GlobalDefaultIPIP)
 }
 
-func (i ipip) get(node string) error {
+func (i ipip) get(node string) (string, error) {
 	if node != "" {
-		return errors.New("--node should not be specified")
+		return "", errors.New("--node should not be specified")
 	}
 
 	enabled, err := i.c.GetGlobalIPIP()
 	if err != nil {
-		return err
+		return "", err
 	}
 	if enabled {
-		fmt.Println("on")
-	} else {
-		fmt.Println("off")
+		return "on", nil
 	}
-	return nil
+	return "off", nil
 }
 
 // asnum implements the configType interface.
@@ -305,15 +370,14 @@ func (a asnum) unset(node string) error {
 	return a.c.SetGlobalASNumber(client.GlobalDefaultASNumber)
 }
 
-func (a asnum) get(node string) error {
+func (a asnum) get(node string) (string, error) {
 	if node != "" {
-		return errors.New("--node should not be specified")
+		return "", errors.New("--node should not be specified")
 	}
 
 	asn, err := a.c.GetGlobalASNumber()
 	if err != nil {
-		return err
+		return "", err
 	}
-	fmt.Println(asn.String())
-	return nil
+	return asn.String(), nil
 }
@@ -0,0 +1,78 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/docopt/docopt-go"
+	"github.com/projectcalico/calico-containers/calicoctl/commands/context"
+)
+
+// Context takes keyword with a context name then calls the subcommands.
+func Context(args []string) {
+	doc := `Usage:
+  calicoctl context <command> [<args>...]
+
+    list         List the contexts in the config file.
+    use          Set the current context.
+    show         Show the datastore settings of a context.
+    set          Create or update a context.
+
+Options:
+  -h --help      Show this screen.
+
+Description:
+  Context management commands for calicoctl.
+
+  A context is a named set of datastore connection settings stored in the
+  calicoctl config file.  The config file may hold multiple contexts, one of
+  which is the current context.  The context used by a command is, in order of
+  precedence:
+    -  the context specified by the global --context option
+    -  the context specified by the CALICOCTL_CONTEXT environment variable
+    -  the current context in the config file.
+  If no context is selected, the datastore settings in the config file are
+  used as normal, falling back to the environment variables.
+
+  See 'calicoctl context <command> --help' to read about a specific subcommand.
+`
+	arguments, err := docopt.Parse(doc, args, true, "", true, false)
+	if err != nil {
+		fmt.Printf("Invalid option: 'calicoctl %s'. Use flag '--help' to read about a specific subcommand.\n", strings.Join(args, " "))
+		os.Exit(1)
+	}
+	if arguments["<command>"] == nil {
+		return
+	}
+
+	command := arguments["<command>"].(string)
+	args = append([]string{"context", command}, arguments["<args>"].([]string)...)
+
+	switch command {
+	case "list":
+		context.List(args)
+	case "use":
+		context.Use(args)
+	case "show":
+		context.Show(args)
+	case "set":
+		context.Set(args)
+	default:
+		fmt.Println(doc)
+	}
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package context
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/docopt/docopt-go"
+	"github.com/projectcalico/calico-containers/calicoctl/commands/clientmgr"
+)
+
+// List displays the contexts in the config file.
+func List(args []string) {
+	doc := `Usage:
+  calicoctl context list [--config=<CONFIG>]
+
+Options:
+  -h --help             Show this screen.
+  -c --config=<CONFIG>  Path to the file containing connection configuration in
+                        YAML or JSON format.
+                        [default: /etc/calico/calicoctl.cfg]
+
+Description:
+  The context list command lists the contexts in the config file.  The current
+  context is marked with an asterisk.
+`
+	parsedArgs, err := docopt.Parse(doc, args, true, "", false, false)
+	if err != nil {
+		fmt.Printf("Invalid option: 'calicoctl %s'. Use flag '--help' to read about a specific subcommand.\n", strings.Join(args, " "))
+		os.Exit(1)
+	}
+	if len(parsedArgs) == 0 {
+		return
+	}
+
+	current, contexts, err := clientmgr.LoadContexts(parsedArgs["--config"].(string))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	writer := tabwriter.NewWriter(os.Stdout, 5, 1, 3, ' ', 0)
+	fmt.Fprintf(writer, "CURRENT\tNAME\tDATASTORETYPE\t\n")
+	for _, ctx := range contexts {
+		marker := ""
+		if ctx.Name == current {
+			marker = "*"
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%v\t\n", marker, ctx.Name, valueOrBlank(ctx.Spec["datastoreType"]))
+	}
+	writer.Flush()
+}
+
+// valueOrBlank returns the value as a string, or blank if the value is not set.
+func valueOrBlank(v interface{}) string {
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package context
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/docopt/docopt-go"
+	"github.com/projectcalico/calico-containers/calicoctl/commands/clientmgr"
+)
+
+// The options of the set command, and the corresponding context settings.
+var settingOptions = []struct {
+	option  string
+	setting string
+}{
+	{"--datastore-type", "datastoreType"},
+	{"--etcd-endpoints", "etcdEndpoints"},
+	{"--etcd-username", "etcdUsername"},
+	{"--etcd-password", "etcdPassword"},
+	{"--etcd-key-file", "etcdKeyFile"},
+	{"--etcd-cert-file", "etcdCertFile"},
+	{"--etcd-ca-cert-file", "etcdCACertFile"},
+}
+
+// Set creates or updates a context in the config file.
+func Set(args []string) {
+	doc := `Usage:
+  calicoctl context set <NAME> [--datastore-type=<TYPE>]
+                        [--etcd-endpoints=<ENDPOINTS>]
+                        [--etcd-username=<USERNAME>]
+                        [--etcd-password=<PASSWORD>]
+                        [--etcd-key-file=<FILE>]
+                        [--etcd-cert-file=<FILE>]
+                        [--etcd-ca-cert-file=<FILE>]
+                        [--current] [--config=<CONFIG>]
+
+Examples:
+  # Create a context for the production cluster and make it current.
+  calicoctl context set prod --datastore-type=etcdv2 \
+    --etcd-endpoints=https://etcd.prod:2379 --current
+
+Options:
+  -h --help                       Show this screen.
+     --datastore-type=<TYPE>      The datastore type.
+     --etcd-endpoints=<ENDPOINTS> A comma-separated list of etcd endpoints.
+     --etcd-username=<USERNAME>   The etcd username.
+     --etcd-password=<PASSWORD>   The etcd password.
+     --etcd-key-file=<FILE>       The etcd client key file.
+     --etcd-cert-file=<FILE>      The etcd client certificate file.
+     --etcd-ca-cert-file=<FILE>   The etcd CA certificate file.
+     --current                    Make the context the current context.
+  -c --config=<CONFIG>            Path to the file containing connection
+                                  configuration in YAML or JSON format.
+                                  [default: /etc/calico/calicoctl.cfg]
+
+Description:
+  The context set command creates a context in the config file, or updates
+  the specified settings of an existing context.  Settings that are not
+  specified are unchanged, and a setting may be removed by setting it to an
+  empty value.  The config file is created if it does not exist.
+`
+	parsedArgs, err := docopt.Parse(doc, args, true, "", false, false)
+	if err != nil {
+		fmt.Printf("Invalid option: 'calicoctl %s'. Use flag '--help' to read about a specific subcommand.\n", strings.Join(args, " "))
+		os.Exit(1)
+	}
+	if len(parsedArgs) == 0 {
+		return
+	}
+
+	cf := parsedArgs["--config"].(string)
+	name := parsedArgs["<NAME>"].(string)
+	current, contexts, err := clientmgr.LoadContexts(cf)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	ctx, err := clientmgr.FindContext(contexts, name)
+	if err != nil {
+		contexts = append(contexts, clientmgr.Context{Name: name})
+		ctx = &contexts[len(contexts)-1]
+	}
+	if ctx.Spec == nil {
+		ctx.Spec = map[string]interface{}{}
+	}
+	for _, so := range settingOptions {
+		if v := parsedArgs[so.option]; v != nil {
+			if v.(string) == "" {
+				delete(ctx.Spec, so.setting)
+			} else {
+				ctx.Spec[so.setting] = v.(string)
+			}
+		}
+	}
+
+	if parsedArgs["--current"].(bool) {
+		current = name
+	}
+	if err = clientmgr.SaveContexts(cf, current, contexts); err != nil {
+		fmt.Printf("Error updating config file: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Successfully updated context '%s'\n", name)
+}
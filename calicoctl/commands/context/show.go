@@ -0,0 +1,96 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package context
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/docopt/docopt-go"
+	"github.com/ghodss/yaml"
+	"github.com/projectcalico/calico-containers/calicoctl/commands/clientmgr"
+)
+
+// The context settings that are masked when displaying a context.
+var secretSettings = []string{"etcdPassword"}
+
+// Show displays the datastore settings of a context.
+func Show(args []string) {
+	doc := `Usage:
+  calicoctl context show [<NAME>] [--config=<CONFIG>]
+
+Options:
+  -h --help             Show this screen.
+  -c --config=<CONFIG>  Path to the file containing connection configuration in
+                        YAML or JSON format.
+                        [default: /etc/calico/calicoctl.cfg]
+
+Description:
+  The context show command displays the datastore settings of the named
+  context in YAML format, or of the selected context if no name is specified.
+  Passwords are masked.
+`
+	parsedArgs, err := docopt.Parse(doc, args, true, "", false, false)
+	if err != nil {
+		fmt.Printf("Invalid option: 'calicoctl %s'. Use flag '--help' to read about a specific subcommand.\n", strings.Join(args, " "))
+		os.Exit(1)
+	}
+	if len(parsedArgs) == 0 {
+		return
+	}
+
+	current, contexts, err := clientmgr.LoadContexts(parsedArgs["--config"].(string))
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	name := clientmgr.SelectedContext
+	if parsedArgs["<NAME>"] != nil {
+		name = parsedArgs["<NAME>"].(string)
+	}
+	if name == "" {
+		name = os.Getenv("CALICOCTL_CONTEXT")
+	}
+	if name == "" {
+		name = current
+	}
+	if name == "" {
+		fmt.Println("No context is selected")
+		os.Exit(1)
+	}
+	ctx, err := clientmgr.FindContext(contexts, name)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	spec := make(map[string]interface{}, len(ctx.Spec))
+	for k, v := range ctx.Spec {
+		spec[k] = v
+	}
+	for _, k := range secretSettings {
+		if _, ok := spec[k]; ok {
+			spec[k] = "********"
+		}
+	}
+	output, err := yaml.Marshal(clientmgr.Context{Name: ctx.Name, Spec: spec})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Print(string(output))
+}
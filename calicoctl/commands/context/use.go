@@ -0,0 +1,67 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package context
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/docopt/docopt-go"
+	"github.com/projectcalico/calico-containers/calicoctl/commands/clientmgr"
+)
+
+// Use sets the current context in the config file.
+func Use(args []string) {
+	doc := `Usage:
+  calicoctl context use <NAME> [--config=<CONFIG>]
+
+Options:
+  -h --help             Show this screen.
+  -c --config=<CONFIG>  Path to the file containing connection configuration in
+                        YAML or JSON format.
+                        [default: /etc/calico/calicoctl.cfg]
+
+Description:
+  The context use command sets the current context in the config file.  The
+  current context is used by subsequent commands unless a context is selected
+  using the --context option or the CALICOCTL_CONTEXT environment variable.
+`
+	parsedArgs, err := docopt.Parse(doc, args, true, "", false, false)
+	if err != nil {
+		fmt.Printf("Invalid option: 'calicoctl %s'. Use flag '--help' to read about a specific subcommand.\n", strings.Join(args, " "))
+		os.Exit(1)
+	}
+	if len(parsedArgs) == 0 {
+		return
+	}
+
+	cf := parsedArgs["--config"].(string)
+	name := parsedArgs["<NAME>"].(string)
+	_, contexts, err := clientmgr.LoadContexts(cf)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if _, err = clientmgr.FindContext(contexts, name); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err = clientmgr.SaveContexts(cf, name, contexts); err != nil {
+		fmt.Printf("Error updating config file: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Switched to context '%s'\n", name)
+}
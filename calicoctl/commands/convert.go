@@ -0,0 +1,602 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/docopt/docopt-go"
+	"github.com/ghodss/yaml"
+	"github.com/projectcalico/calico-containers/calicoctl/resourcemgr"
+	"github.com/projectcalico/libcalico-go/lib/api"
+	"github.com/projectcalico/libcalico-go/lib/api/unversioned"
+	cnet "github.com/projectcalico/libcalico-go/lib/net"
+	"github.com/projectcalico/libcalico-go/lib/numorstring"
+)
+
+// The labels used to represent Kubernetes namespaces on Calico endpoints.  By default the
+// namespace of an endpoint is stored in the namespace label, and each label of the
+// namespace is stored with the namespace label prefix.
+const (
+	k8sNamespaceLabel       = "calico/k8s_ns"
+	k8sNamespaceLabelPrefix = "k8s_ns/label/"
+)
+
+// The orders of the converted policies.  The isolation policies are ordered after all of
+// the allow policies, so that traffic allowed by any of the Kubernetes policies is allowed.
+const (
+	k8sPolicyOrder          = 1000
+	k8sIsolationPolicyOrder = 2000
+)
+
+// The Kubernetes NetworkPolicy types.  These include only the fields that are required
+// for the conversion, so that calicoctl does not depend on a particular Kubernetes API
+// version.
+type k8sNetworkPolicy struct {
+	Kind     string `json:"kind"`
+	Metadata struct {
+		Name      string `json:"name"`
+		Namespace string `json:"namespace"`
+	} `json:"metadata"`
+	Spec struct {
+		PodSelector k8sLabelSelector `json:"podSelector"`
+		Ingress     []k8sPolicyRule  `json:"ingress"`
+		Egress      []k8sPolicyRule  `json:"egress"`
+		PolicyTypes []string         `json:"policyTypes"`
+	} `json:"spec"`
+}
+
+// k8sPolicyRule is a NetworkPolicy ingress rule (using From) or egress rule (using To).
+type k8sPolicyRule struct {
+	Ports []k8sPolicyPort `json:"ports"`
+	From  []k8sPolicyPeer `json:"from"`
+	To    []k8sPolicyPeer `json:"to"`
+}
+
+type k8sPolicyPort struct {
+	Protocol string          `json:"protocol"`
+	Port     json.RawMessage `json:"port"`
+	EndPort  *int            `json:"endPort"`
+}
+
+type k8sPolicyPeer struct {
+	PodSelector       *k8sLabelSelector `json:"podSelector"`
+	NamespaceSelector *k8sLabelSelector `json:"namespaceSelector"`
+	IPBlock           *struct {
+		CIDR   string   `json:"cidr"`
+		Except []string `json:"except"`
+	} `json:"ipBlock"`
+}
+
+type k8sLabelSelector struct {
+	MatchLabels      map[string]string `json:"matchLabels"`
+	MatchExpressions []struct {
+		Key      string   `json:"key"`
+		Operator string   `json:"operator"`
+		Values   []string `json:"values"`
+	} `json:"matchExpressions"`
+}
+
+// k8sConverter converts Kubernetes NetworkPolicies to Calico policies, recording the
+// constructs that could not be translated.
+type k8sConverter struct {
+	// The label holding the namespace of an endpoint.  If empty, pod selectors are not
+	// restricted to the namespace of the NetworkPolicy.
+	namespaceLabel string
+
+	notes []string
+}
+
+func Convert(args []string) {
+	doc := `Usage:
+  calicoctl convert --from=<FORMAT> --filename=<FILENAME> [--output=<OUTPUT>]
+                    [--namespace-label=<LABEL> | --no-namespace-scope]
+
+Examples:
+  # Convert the Kubernetes NetworkPolicies in np.yaml to Calico policies.
+  calicoctl convert --from=k8s-networkpolicy -f ./np.yaml
+
+  # Convert and apply the policies.
+  calicoctl convert --from=k8s-networkpolicy -f ./np.yaml | calicoctl apply -f -
+
+  # Convert the policies for endpoints that store their namespace in the
+  # label "namespace".
+  calicoctl convert --from=k8s-networkpolicy -f ./np.yaml --namespace-label=namespace
+
+Options:
+  -h --help                    Show this screen.
+     --from=<FORMAT>           The format of the file.  One of:
+                               k8s-networkpolicy.
+  -f --filename=<FILENAME>     Filename to convert.  If set to "-" loads from
+                               stdin.
+  -o --output=<OUTPUT FORMAT>  Output format.  One of: yaml, json.
+                               [default: yaml]
+     --namespace-label=<LABEL> The label holding the namespace of an
+                               endpoint.  [default: calico/k8s_ns]
+     --no-namespace-scope      Do not restrict pod selectors to the namespace
+                               of the NetworkPolicy.
+
+Description:
+  The convert command converts resources in another format to Calico
+  resources, and writes them to stdout in a format that can be used with
+  'calicoctl create' and 'calicoctl apply'.  The file is not modified and the
+  datastore is not accessed.  Any constructs that cannot be translated are
+  reported on stderr.
+
+  The k8s-networkpolicy format converts Kubernetes NetworkPolicy resources
+  (and lists of NetworkPolicy resources) to Calico policies.  The file may
+  contain multiple YAML documents.  Each NetworkPolicy is converted to a
+  policy named <namespace>.<name> with order 1000, containing a rule to allow
+  each combination of peer and protocol in the NetworkPolicy.  The pods,
+  namespaces, IP blocks and ports of the NetworkPolicy are translated as
+  follows:
+
+    podSelector        A selector on the labels of the endpoint, restricted to
+                       endpoints with the namespace label (calico/k8s_ns,
+                       or as set by --namespace-label) set to the namespace
+                       of the NetworkPolicy.  With --no-namespace-scope the
+                       selector is not restricted to the namespace.
+    namespaceSelector  A selector on the namespace labels of the endpoint,
+                       which are labels with the prefix k8s_ns/label/.
+    ipBlock            A net, with a single except entry translated as a
+                       notNet.
+    ports              The protocol and destination ports.  Named ports
+                       cannot be translated.
+
+  In Kubernetes, traffic to or from a pod that is selected by any
+  NetworkPolicy is denied unless a NetworkPolicy allows it.  This is
+  represented by an isolation policy named <namespace>.<name>.isolation with
+  order 2000, which denies the traffic in the directions of the policy types
+  of the NetworkPolicy.  Calico policies with an order greater than 2000 do
+  not apply to the traffic to and from these endpoints.
+
+  A peer or rule that cannot be translated is omitted, so the converted
+  policies never allow more traffic than the NetworkPolicies.
+`
+	parsedArgs, err := docopt.Parse(doc, args, true, "", false, false)
+	if err != nil {
+		fmt.Printf("Invalid option: 'calicoctl %s'. Use flag '--help' to read about a specific subcommand.\n", strings.Join(args, " "))
+		os.Exit(1)
+	}
+	if len(parsedArgs) == 0 {
+		return
+	}
+
+	from := parsedArgs["--from"].(string)
+	if from != "k8s-networkpolicy" {
+		fmt.Printf("unrecognized format '%s'\n", from)
+		os.Exit(1)
+	}
+
+	var rp resourcePrinter
+	switch output := parsedArgs["--output"].(string); output {
+	case "yaml":
+		rp = resourcePrinterYAML{}
+	case "json":
+		rp = resourcePrinterJSON{}
+	default:
+		fmt.Printf("unrecognized output format '%s'\n", output)
+		os.Exit(1)
+	}
+
+	nps, err := loadK8sNetworkPolicies(parsedArgs["--filename"].(string))
+	if err != nil {
+		fmt.Printf("Error executing command: %v\n", err)
+		os.Exit(1)
+	}
+
+	conv := &k8sConverter{namespaceLabel: parsedArgs["--namespace-label"].(string)}
+	if parsedArgs["--no-namespace-scope"].(bool) {
+		conv.namespaceLabel = ""
+	}
+	resources := []unversioned.Resource{}
+	for _, np := range nps {
+		for _, p := range conv.convertNetworkPolicy(np) {
+			if err := resourcemgr.Validate(p); err != nil {
+				fmt.Printf("Error executing command: converted policy '%s' is not valid: %v\n", p.Metadata.Name, err)
+				os.Exit(1)
+			}
+			resources = append(resources, p)
+		}
+	}
+
+	for _, note := range conv.notes {
+		fmt.Fprintf(os.Stderr, "WARNING: %s\n", note)
+	}
+	if err = rp.print(os.Stdout, resources); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// loadK8sNetworkPolicies loads the NetworkPolicies from the file, which may contain
+// multiple YAML documents, each of which is a NetworkPolicy or a list of NetworkPolicies.
+func loadK8sNetworkPolicies(f string) ([]k8sNetworkPolicy, error) {
+	var b []byte
+	var err error
+	if f == "-" {
+		b, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		b, err = ioutil.ReadFile(f)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	nps := []k8sNetworkPolicy{}
+	for i, d := range splitYAMLDocuments(b) {
+		var list struct {
+			Kind  string            `json:"kind"`
+			Items []json.RawMessage `json:"items"`
+		}
+		if err = yaml.Unmarshal(d, &list); err != nil {
+			return nil, fmt.Errorf("document %d: %v", i+1, err)
+		}
+		items := [][]byte{d}
+		switch list.Kind {
+		case "NetworkPolicy":
+		case "NetworkPolicyList", "List":
+			items = items[:0]
+			for _, item := range list.Items {
+				items = append(items, item)
+			}
+		default:
+			return nil, fmt.Errorf("document %d: unexpected kind '%s', expecting NetworkPolicy", i+1, list.Kind)
+		}
+		for _, item := range items {
+			var np k8sNetworkPolicy
+			if err = yaml.Unmarshal(item, &np); err != nil {
+				return nil, fmt.Errorf("document %d: %v", i+1, err)
+			}
+			if np.Kind != "NetworkPolicy" {
+				return nil, fmt.Errorf("document %d: unexpected kind '%s' in list, expecting NetworkPolicy", i+1, np.Kind)
+			}
+			if np.Metadata.Namespace == "" {
+				np.Metadata.Namespace = "default"
+			}
+			nps = append(nps, np)
+		}
+	}
+	if len(nps) == 0 {
+		return nil, fmt.Errorf("the file does not contain any NetworkPolicies")
+	}
+	return nps, nil
+}
+
+// splitYAMLDocuments splits the YAML into documents, ignoring empty documents.
+func splitYAMLDocuments(b []byte) [][]byte {
+	docs := [][]byte{}
+	var current bytes.Buffer
+	flush := func() {
+		if len(bytes.TrimSpace(current.Bytes())) > 0 {
+			docs = append(docs, append([]byte(nil), current.Bytes()...))
+		}
+		current.Reset()
+	}
+	for _, line := range bytes.SplitAfter(b, []byte("\n")) {
+		if strings.TrimRight(string(line), " \t\r\n") == "---" {
+			flush()
+			continue
+		}
+		current.Write(line)
+	}
+	flush()
+	return docs
+}
+
+// note records a construct of the NetworkPolicy that could not be translated.
+func (c *k8sConverter) note(np k8sNetworkPolicy, format string, args ...interface{}) {
+	c.notes = append(c.notes, fmt.Sprintf("NetworkPolicy %s/%s: %s",
+		np.Metadata.Namespace, np.Metadata.Name, fmt.Sprintf(format, args...)))
+}
+
+// convertNetworkPolicy returns the Calico policy that allows the traffic allowed by the
+// NetworkPolicy, and the isolation policy that denies other traffic.
+func (c *k8sConverter) convertNetworkPolicy(np k8sNetworkPolicy) []*api.Policy {
+	ns := np.Metadata.Namespace
+	name := ns + "." + np.Metadata.Name
+	selector, ok := c.podSelector(np, &np.Spec.PodSelector, ns)
+	if !ok {
+		c.note(np, "the policy is not converted because the podSelector cannot be translated")
+		return nil
+	}
+	if selector == "" {
+		selector = "all()"
+	}
+
+	// As in Kubernetes, a NetworkPolicy without policy types applies to ingress, and to
+	// egress if it has any egress rules.
+	ingress, egress := false, false
+	if len(np.Spec.PolicyTypes) == 0 {
+		ingress, egress = true, len(np.Spec.Egress) > 0
+	}
+	for _, t := range np.Spec.PolicyTypes {
+		switch t {
+		case "Ingress":
+			ingress = true
+		case "Egress":
+			egress = true
+		default:
+			c.note(np, "unknown policy type '%s' is ignored", t)
+		}
+	}
+
+	order := float64(k8sPolicyOrder)
+	p := api.NewPolicy()
+	p.Metadata.Name = name
+	p.Spec.Order = &order
+	p.Spec.Selector = selector
+	if ingress {
+		for i, r := range np.Spec.Ingress {
+			p.Spec.IngressRules = append(p.Spec.IngressRules, c.convertRule(np, fmt.Sprintf("ingress rule %d", i+1), r, r.From, true)...)
+		}
+	}
+	if egress {
+		for i, r := range np.Spec.Egress {
+			p.Spec.EgressRules = append(p.Spec.EgressRules, c.convertRule(np, fmt.Sprintf("egress rule %d", i+1), r, r.To, false)...)
+		}
+	}
+
+	isolationOrder := float64(k8sIsolationPolicyOrder)
+	isolation := api.NewPolicy()
+	isolation.Metadata.Name = name + ".isolation"
+	isolation.Spec.Order = &isolationOrder
+	isolation.Spec.Selector = selector
+	if ingress {
+		isolation.Spec.IngressRules = []api.Rule{{Action: "deny"}}
+	}
+	if egress {
+		isolation.Spec.EgressRules = []api.Rule{{Action: "deny"}}
+	}
+	return []*api.Policy{p, isolation}
+}
+
+// convertRule returns the Calico rules that allow the traffic allowed by a NetworkPolicy
+// rule: one rule for each combination of peer and protocol.
+func (c *k8sConverter) convertRule(np k8sNetworkPolicy, desc string, r k8sPolicyRule, peers []k8sPolicyPeer, ingress bool) []api.Rule {
+	protocols, ok := c.convertPorts(np, desc, r.Ports)
+	if !ok {
+		return nil
+	}
+
+	// A rule without peers matches all sources (or destinations).
+	entities := []api.EntityRule{{}}
+	if len(peers) > 0 {
+		entities = entities[:0]
+		for i := range peers {
+			if e, ok := c.convertPeer(np, fmt.Sprintf("%s peer %d", desc, i+1), &peers[i]); ok {
+				entities = append(entities, e)
+			}
+		}
+	}
+
+	rules := []api.Rule{}
+	for _, e := range entities {
+		for _, pp := range protocols {
+			rule := api.Rule{Action: "allow", Protocol: pp.protocol}
+			if ingress {
+				rule.Source = e
+			} else {
+				rule.Destination = e
+			}
+			rule.Destination.Ports = pp.ports
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// protocolPorts is the protocol and destination ports of a Calico rule.
+type protocolPorts struct {
+	protocol *numorstring.Protocol
+	ports    []numorstring.Port
+}
+
+// convertPorts groups the NetworkPolicy ports by protocol.  If there are no ports, a
+// single entry matching all protocols is returned.  Returns false if there are ports but
+// none of them could be translated, since the rule would otherwise match all ports.
+func (c *k8sConverter) convertPorts(np k8sNetworkPolicy, desc string, ports []k8sPolicyPort) ([]protocolPorts, bool) {
+	if len(ports) == 0 {
+		return []protocolPorts{{}}, true
+	}
+
+	byProtocol := map[string]*protocolPorts{}
+	allPorts := map[string]bool{}
+	protocols := []string{}
+	for _, port := range ports {
+		proto := strings.ToLower(port.Protocol)
+		if proto == "" {
+			proto = "tcp"
+		}
+		if proto != "tcp" && proto != "udp" {
+			c.note(np, "%s: protocol %s cannot be translated", desc, port.Protocol)
+			continue
+		}
+
+		// The port is either omitted (all ports), a number, or a named port.
+		var cp *numorstring.Port
+		if len(port.Port) > 0 && string(port.Port) != "null" {
+			var min int
+			if err := json.Unmarshal(port.Port, &min); err != nil {
+				c.note(np, "%s: named port %s cannot be translated", desc, string(port.Port))
+				continue
+			}
+			max := min
+			if port.EndPort != nil {
+				max = *port.EndPort
+			}
+			if min < 1 || max < min || max > 65535 {
+				c.note(np, "%s: port range %d-%d cannot be translated", desc, min, max)
+				continue
+			}
+			p, err := numorstring.PortFromRange(uint16(min), uint16(max))
+			if err != nil {
+				c.note(np, "%s: port range %d-%d cannot be translated", desc, min, max)
+				continue
+			}
+			cp = &p
+		}
+
+		pp, ok := byProtocol[proto]
+		if !ok {
+			p := numorstring.ProtocolFromString(proto)
+			pp = &protocolPorts{protocol: &p}
+			byProtocol[proto] = pp
+			protocols = append(protocols, proto)
+		}
+		if cp == nil {
+			allPorts[proto] = true
+		} else {
+			pp.ports = append(pp.ports, *cp)
+		}
+	}
+	if len(protocols) == 0 {
+		c.note(np, "%s is omitted because none of its ports can be translated", desc)
+		return nil, false
+	}
+
+	sort.Strings(protocols)
+	result := []protocolPorts{}
+	for _, proto := range protocols {
+		pp := *byProtocol[proto]
+		if allPorts[proto] {
+			pp.ports = nil
+		}
+		result = append(result, pp)
+	}
+	return result, true
+}
+
+// convertPeer returns the Calico source or destination criteria equivalent to the
+// NetworkPolicy peer.  Returns false if the peer cannot be translated.
+func (c *k8sConverter) convertPeer(np k8sNetworkPolicy, desc string, peer *k8sPolicyPeer) (api.EntityRule, bool) {
+	e := api.EntityRule{}
+	if peer.IPBlock != nil {
+		_, n, err := cnet.ParseCIDR(peer.IPBlock.CIDR)
+		if err != nil {
+			c.note(np, "%s is omitted because the CIDR %s is not valid", desc, peer.IPBlock.CIDR)
+			return e, false
+		}
+		e.Net = n
+		switch len(peer.IPBlock.Except) {
+		case 0:
+		case 1:
+			if _, e.NotNet, err = cnet.ParseCIDR(peer.IPBlock.Except[0]); err != nil {
+				c.note(np, "%s is omitted because the CIDR %s is not valid", desc, peer.IPBlock.Except[0])
+				return e, false
+			}
+		default:
+			c.note(np, "%s is omitted because an ipBlock with more than one except entry cannot be translated", desc)
+			return e, false
+		}
+		return e, true
+	}
+
+	var ok bool
+	switch {
+	case peer.NamespaceSelector != nil:
+		var nsSel, podSel string
+		if nsSel, ok = c.labelSelector(np, peer.NamespaceSelector, k8sNamespaceLabelPrefix); !ok {
+			break
+		}
+		if nsSel == "" && c.namespaceLabel != "" {
+			nsSel = fmt.Sprintf("has(%s)", c.namespaceLabel)
+		}
+		e.Selector = nsSel
+		if peer.PodSelector != nil {
+			if podSel, ok = c.labelSelector(np, peer.PodSelector, ""); ok {
+				e.Selector = joinSelectors(nsSel, podSel)
+			}
+		}
+	case peer.PodSelector != nil:
+		e.Selector, ok = c.podSelector(np, peer.PodSelector, np.Metadata.Namespace)
+	default:
+		c.note(np, "%s is omitted because it does not specify any pods, namespaces or IP blocks", desc)
+		return e, false
+	}
+	if !ok {
+		c.note(np, "%s is omitted because its selector cannot be translated", desc)
+	}
+	return e, ok
+}
+
+// podSelector returns the Calico selector for the pods in the namespace selected by the
+// Kubernetes label selector.  The selector is only restricted to the namespace if the
+// converter has a namespace label.
+func (c *k8sConverter) podSelector(np k8sNetworkPolicy, ls *k8sLabelSelector, ns string) (string, bool) {
+	sel, ok := c.labelSelector(np, ls, "")
+	if !ok {
+		return "", false
+	}
+	if c.namespaceLabel == "" {
+		return sel, true
+	}
+	return joinSelectors(fmt.Sprintf("%s == '%s'", c.namespaceLabel, ns), sel), true
+}
+
+// joinSelectors returns the selector matching both selectors, either of which may be
+// empty.
+func joinSelectors(a, b string) string {
+	switch {
+	case a == "":
+		return b
+	case b == "":
+		return a
+	}
+	return a + " && " + b
+}
+
+// labelSelector returns the Calico selector equivalent to the Kubernetes label selector,
+// with the prefix added to each label key.  An empty label selector returns an empty
+// selector, which selects everything.
+func (c *k8sConverter) labelSelector(np k8sNetworkPolicy, ls *k8sLabelSelector, prefix string) (string, bool) {
+	terms := []string{}
+	keys := make([]string, 0, len(ls.MatchLabels))
+	for k := range ls.MatchLabels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		terms = append(terms, fmt.Sprintf("%s%s == '%s'", prefix, k, ls.MatchLabels[k]))
+	}
+
+	for _, expr := range ls.MatchExpressions {
+		key := prefix + expr.Key
+		values := make([]string, len(expr.Values))
+		for i, v := range expr.Values {
+			values[i] = "'" + v + "'"
+		}
+		switch expr.Operator {
+		case "In":
+			terms = append(terms, fmt.Sprintf("%s in { %s }", key, strings.Join(values, ", ")))
+		case "NotIn":
+			terms = append(terms, fmt.Sprintf("%s not in { %s }", key, strings.Join(values, ", ")))
+		case "Exists":
+			terms = append(terms, fmt.Sprintf("has(%s)", key))
+		case "DoesNotExist":
+			terms = append(terms, fmt.Sprintf("! has(%s)", key))
+		default:
+			c.note(np, "unknown label selector operator '%s'", expr.Operator)
+			return "", false
+		}
+	}
+	return strings.Join(terms, " && "), true
+}
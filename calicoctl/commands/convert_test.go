@@ -0,0 +1,199 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/projectcalico/libcalico-go/lib/numorstring"
+)
+
+// writeTempFile writes the contents to a temporary file and returns its name.
+func writeTempFile(contents string) string {
+	f, err := ioutil.TempFile("", "calicoctl-convert")
+	Expect(err).NotTo(HaveOccurred())
+	defer f.Close()
+	_, err = f.WriteString(contents)
+	Expect(err).NotTo(HaveOccurred())
+	return f.Name()
+}
+
+// k8sPort returns a NetworkPolicy port with a numeric or named port.
+func k8sPort(protocol string, port interface{}) k8sPolicyPort {
+	p := k8sPolicyPort{Protocol: protocol}
+	if port != nil {
+		b, err := json.Marshal(port)
+		Expect(err).NotTo(HaveOccurred())
+		p.Port = b
+	}
+	return p
+}
+
+// mustPortFromRange returns the port range, which must be valid.
+func mustPortFromRange(min, max uint16) numorstring.Port {
+	p, err := numorstring.PortFromRange(min, max)
+	Expect(err).NotTo(HaveOccurred())
+	return p
+}
+
+var _ = Describe("Test loading Kubernetes NetworkPolicies", func() {
+	var file string
+
+	AfterEach(func() {
+		os.Remove(file)
+	})
+
+	It("should load multiple documents and lists of NetworkPolicies", func() {
+		file = writeTempFile(`kind: NetworkPolicy
+metadata:
+  name: web
+  namespace: prod
+spec:
+  podSelector:
+    matchLabels:
+      app: web
+---
+---
+kind: NetworkPolicyList
+items:
+- kind: NetworkPolicy
+  metadata:
+    name: db
+- kind: NetworkPolicy
+  metadata:
+    name: cache
+    namespace: prod
+`)
+		nps, err := loadK8sNetworkPolicies(file)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(nps).To(HaveLen(3))
+		Expect(nps[0].Metadata.Name).To(Equal("web"))
+		Expect(nps[0].Spec.PodSelector.MatchLabels).To(Equal(map[string]string{"app": "web"}))
+		Expect(nps[1].Metadata.Name).To(Equal("db"))
+		Expect(nps[1].Metadata.Namespace).To(Equal("default"))
+		Expect(nps[2].Metadata.Namespace).To(Equal("prod"))
+	})
+
+	DescribeTable("should reject files without NetworkPolicies",
+		func(contents, expectedErr string) {
+			file = writeTempFile(contents)
+			_, err := loadK8sNetworkPolicies(file)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(ContainSubstring(expectedErr))
+		},
+		Entry("empty file", "---\n", "does not contain any NetworkPolicies"),
+		Entry("other kind", "kind: Pod\n", "document 1: unexpected kind 'Pod'"),
+		Entry("other kind in a list",
+			"kind: NetworkPolicy\n---\nkind: List\nitems:\n- kind: Service\n",
+			"document 2: unexpected kind 'Service' in list"),
+	)
+
+	It("should report a missing file", func() {
+		_, err := loadK8sNetworkPolicies("/does/not/exist.yaml")
+		Expect(err).To(HaveOccurred())
+	})
+})
+
+var _ = Describe("Test converting Kubernetes NetworkPolicy ports", func() {
+	tcp := numorstring.ProtocolFromString("tcp")
+	udp := numorstring.ProtocolFromString("udp")
+	endPort := 8090
+
+	DescribeTable("should group the ports by protocol",
+		func(ports []k8sPolicyPort, expected []protocolPorts, expectedOK bool, numNotes int) {
+			c := &k8sConverter{}
+			pps, ok := c.convertPorts(k8sNetworkPolicy{}, "ingress rule 1", ports)
+			Expect(ok).To(Equal(expectedOK))
+			Expect(pps).To(Equal(expected))
+			Expect(c.notes).To(HaveLen(numNotes))
+		},
+		Entry("no ports", nil, []protocolPorts{{}}, true, 0),
+		Entry("default protocol",
+			[]k8sPolicyPort{k8sPort("", 80), k8sPort("TCP", 443)},
+			[]protocolPorts{{protocol: &tcp, ports: []numorstring.Port{numorstring.SinglePort(80), numorstring.SinglePort(443)}}},
+			true, 0),
+		Entry("multiple protocols",
+			[]k8sPolicyPort{k8sPort("UDP", 53), k8sPort("TCP", 53)},
+			[]protocolPorts{
+				{protocol: &tcp, ports: []numorstring.Port{numorstring.SinglePort(53)}},
+				{protocol: &udp, ports: []numorstring.Port{numorstring.SinglePort(53)}},
+			},
+			true, 0),
+		Entry("all ports of a protocol",
+			[]k8sPolicyPort{k8sPort("TCP", 80), k8sPort("TCP", nil)},
+			[]protocolPorts{{protocol: &tcp}},
+			true, 0),
+		Entry("port range",
+			[]k8sPolicyPort{{Protocol: "TCP", Port: json.RawMessage("8080"), EndPort: &endPort}},
+			[]protocolPorts{{protocol: &tcp, ports: []numorstring.Port{mustPortFromRange(8080, 8090)}}},
+			true, 0),
+		Entry("untranslatable ports are omitted",
+			[]k8sPolicyPort{k8sPort("TCP", "http"), k8sPort("SCTP", 80), k8sPort("TCP", 70000), k8sPort("UDP", 53)},
+			[]protocolPorts{{protocol: &udp, ports: []numorstring.Port{numorstring.SinglePort(53)}}},
+			true, 3),
+		Entry("no translatable ports",
+			[]k8sPolicyPort{k8sPort("TCP", "http")},
+			nil, false, 2),
+	)
+})
+
+var _ = Describe("Test converting Kubernetes NetworkPolicies", func() {
+	np := func(policyTypes []string, egress bool) k8sNetworkPolicy {
+		var np k8sNetworkPolicy
+		np.Metadata.Name = "web"
+		np.Metadata.Namespace = "prod"
+		np.Spec.PodSelector.MatchLabels = map[string]string{"app": "web"}
+		np.Spec.Ingress = []k8sPolicyRule{{}}
+		if egress {
+			np.Spec.Egress = []k8sPolicyRule{{}}
+		}
+		np.Spec.PolicyTypes = policyTypes
+		return np
+	}
+
+	DescribeTable("should apply the policy in the directions of the policy types",
+		func(policyTypes []string, egress, expectedIngress, expectedEgress bool) {
+			c := &k8sConverter{namespaceLabel: k8sNamespaceLabel}
+			ps := c.convertNetworkPolicy(np(policyTypes, egress))
+			Expect(ps).To(HaveLen(2))
+			Expect(ps[1].Spec.IngressRules != nil).To(Equal(expectedIngress))
+			Expect(ps[1].Spec.EgressRules != nil).To(Equal(expectedEgress))
+		},
+		Entry("no policy types", nil, false, true, false),
+		Entry("no policy types with egress rules", nil, true, true, true),
+		Entry("ingress only with egress rules", []string{"Ingress"}, true, true, false),
+		Entry("egress only", []string{"Egress"}, true, false, true),
+		Entry("ingress and egress", []string{"Ingress", "Egress"}, false, true, true),
+	)
+
+	DescribeTable("should scope pod selectors by the namespace label",
+		func(namespaceLabel, expectedSelector string) {
+			c := &k8sConverter{namespaceLabel: namespaceLabel}
+			ps := c.convertNetworkPolicy(np(nil, false))
+			Expect(ps).To(HaveLen(2))
+			Expect(ps[0].Spec.Selector).To(Equal(expectedSelector))
+			Expect(ps[1].Spec.Selector).To(Equal(expectedSelector))
+		},
+		Entry("default label", k8sNamespaceLabel, "calico/k8s_ns == 'prod' && app == 'web'"),
+		Entry("other label", "namespace", "namespace == 'prod' && app == 'web'"),
+		Entry("no namespace scoping", "", "app == 'web'"),
+	)
+})
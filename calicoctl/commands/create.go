@@ -27,7 +27,8 @@ import (
 
 func Create(args []string) {
 	doc := constants.DatastoreIntro + `Usage:
-  calicoctl create --filename=<FILENAME> [--skip-exists] [--config=<CONFIG>]
+  calicoctl create --filename=<FILENAME> [--skip-exists]
+                   [--parallelism=<N>] [--config=<CONFIG>]
 
 Examples:
   # Create a policy using the data in policy.yaml.
@@ -42,6 +43,8 @@ Options:
                             "-" loads from stdin.
      --skip-exists          Skip over and treat as successful any attempts to
                             create an entry that already exists.
+     --parallelism=<N>      The number of resources to create concurrently.
+                            [default: 1]
   -c --config=<CONFIG>      Path to the file containing connection
                             configuration in YAML or JSON format.
                             [default: /etc/calico/calicoctl.cfg]
@@ -50,8 +53,7 @@ Description:
   The create command is used to create a set of resources by filename or stdin.
   JSON and YAML formats are accepted.
 
-  Valid resource types are node, bgpPeer, hostEndpoint, workloadEndpoint,
-  ipPool, policy, and profile.
+  The valid resource types are listed by 'calicoctl api-resources'.
 
   Attempting to create a resource that already exists is treated as a
   terminating error unless the --skip-exists flag is set.  If this flag is set,
@@ -64,6 +66,14 @@ Description:
   The resources are created in the order they are specified.  In the event of a
   failure creating a specific resource it is possible to work out which
   resource failed based on the number of resources successfully created.
+
+  The --parallelism option sets the number of resources that are created
+  concurrently.  Consecutive resources of the same type are created
+  concurrently, and each group of resources is completed before the next group
+  is started, so that resources are created after the resources they depend on.
+  Results are reported in the order the resources are specified and progress is
+  written to stderr.  When processing concurrently, resources that follow a
+  failed resource in the same group may also have been created.
 `
 	parsedArgs, err := docopt.Parse(doc, args, true, "", false, false)
 	if err != nil {
@@ -98,15 +108,7 @@ Description:
 			fmt.Printf("Successfully created %d resource(s)\n", results.numHandled)
 		}
 	} else {
-		fmt.Printf("Partial success: ")
-		if results.singleKind != "" {
-			fmt.Printf("created the first %d out of %d '%s' resources:\n",
-				results.numHandled, results.numResources, results.singleKind)
-		} else {
-			fmt.Printf("created the first %d out of %d resources:\n",
-				results.numHandled, results.numResources)
-		}
-		fmt.Printf("Hit error: %v\n", results.err)
+		printPartialSuccess(results, "created")
 		os.Exit(1)
 	}
 }
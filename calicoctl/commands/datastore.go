@@ -0,0 +1,59 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/docopt/docopt-go"
+	"github.com/projectcalico/calico-containers/calicoctl/commands/datastore"
+)
+
+// Datastore takes keyword with a datastore command then calls the subcommands.
+func Datastore(args []string) {
+	doc := `Usage:
+  calicoctl datastore <command> [<args>...]
+
+    check        Check the connectivity to and health of the datastore.
+
+Options:
+  -h --help      Show this screen.
+
+Description:
+  Datastore specific commands for calicoctl.
+
+  See 'calicoctl datastore <command> --help' to read about a specific subcommand.
+`
+	arguments, err := docopt.Parse(doc, args, true, "", true, false)
+	if err != nil {
+		fmt.Printf("Invalid option: 'calicoctl %s'. Use flag '--help' to read about a specific subcommand.\n", strings.Join(args, " "))
+		os.Exit(1)
+	}
+	if arguments["<command>"] == nil {
+		return
+	}
+
+	command := arguments["<command>"].(string)
+	args = append([]string{"datastore", command}, arguments["<args>"].([]string)...)
+
+	switch command {
+	case "check":
+		datastore.Check(args)
+	default:
+		fmt.Println(doc)
+	}
+}
@@ -0,0 +1,633 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package datastore
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docopt/docopt-go"
+	"github.com/projectcalico/calico-containers/calicoctl/commands/clientmgr"
+	"github.com/projectcalico/calico-containers/calicoctl/commands/constants"
+	"github.com/projectcalico/libcalico-go/lib/api"
+	"github.com/projectcalico/libcalico-go/lib/backend/etcd"
+)
+
+// The result of each step of the check.
+type checkResult string
+
+const (
+	resultPass checkResult = "PASS"
+	resultWarn checkResult = "WARN"
+	resultFail checkResult = "FAIL"
+	resultSkip checkResult = "SKIP"
+)
+
+// The exit codes of the check command.  The exit code identifies the first step that
+// failed.
+const (
+	exitConfig         = 2
+	exitEndpoints      = 3
+	exitReachability   = 4
+	exitTLS            = 5
+	exitAuthentication = 6
+	exitRead           = 7
+	exitWrite          = 8
+)
+
+// The prefix under which Calico data is stored in etcd.
+const calicoPrefix = "/calico"
+
+// The directory under the Calico prefix in which the write check writes its temporary key.
+const checkDir = calicoPrefix + "/calicoctl-check"
+
+// The etcd error codes that are expected when removing the write check directory.
+const (
+	etcdErrorKeyNotFound = 100
+	etcdErrorDirNotEmpty = 108
+)
+
+// Certificates that expire within this period are reported as a warning.
+const certExpiryWarning = 30 * 24 * time.Hour
+
+// step is the result of a single step of the check.
+type step struct {
+	Name   string      `json:"name"`
+	Result checkResult `json:"result"`
+	Detail string      `json:"detail"`
+}
+
+// report accumulates the results of each step of the check.
+type report struct {
+	Steps    []step `json:"steps"`
+	ExitCode int    `json:"exitCode"`
+}
+
+func (r *report) add(name string, result checkResult, detail string, exitCode int) {
+	r.Steps = append(r.Steps, step{Name: name, Result: result, Detail: detail})
+	if result == resultFail && r.ExitCode == 0 {
+		r.ExitCode = exitCode
+	}
+}
+
+func (r *report) failed() bool {
+	return r.ExitCode != 0
+}
+
+// skipRemaining adds a skipped result for each of the named steps.
+func (r *report) skipRemaining(names ...string) {
+	for _, name := range names {
+		r.add(name, resultSkip, "skipped due to previous failure", 0)
+	}
+}
+
+// Check checks each step of connecting to the datastore and reports the results.
+func Check(args []string) {
+	doc := constants.DatastoreIntro + `Usage:
+  calicoctl datastore check [--no-write] [--timeout=<TIMEOUT>]
+                            [--output=<OUTPUT>] [--config=<CONFIG>]
+
+Options:
+  -h --help                    Show this screen.
+     --no-write                Do not check write access to the datastore.
+     --timeout=<TIMEOUT>       The timeout for each network operation.
+                               [default: 5s]
+  -o --output=<OUTPUT FORMAT>  Output format.  One of: ps, json.
+                               [default: ps]
+  -c --config=<CONFIG>         Path to the file containing connection
+                               configuration in YAML or JSON format.
+                               [default: /etc/calico/calicoctl.cfg]
+
+Description:
+  The datastore check command loads the datastore configuration and checks
+  each step of connecting to the datastore, reporting the result of each step
+  separately.  The steps are:
+
+    config           Load the configuration, reporting whether it was loaded
+                     from a context, a file or the environment variables.
+    endpoints        Parse the datastore endpoints and resolve the hostnames.
+    reachability     Open a TCP connection to each endpoint.
+    tls              Perform the TLS handshake with each HTTPS endpoint, and
+                     check the validity and expiry of the server and client
+                     certificates.
+    authentication   Check whether authentication is enabled in the datastore,
+                     and whether credentials are configured to match.
+    read             Read the Calico data (the /calico prefix) using the
+                     configured credentials.
+    write            Write and delete a temporary key under the /calico prefix,
+                     then remove the directory containing it.  The key is
+                     written with a short TTL so that it is removed even if the
+                     delete fails.
+
+  The datastore rejects both invalid credentials and insufficient permissions
+  with the same error, so the credentials are verified by the read step, and a
+  read failure may indicate either problem.
+
+  Each step is reported as PASS, WARN, FAIL or SKIP.  When a step fails, the
+  steps that depend on it are skipped.  The exit code identifies the first
+  step that failed:
+
+    0   All steps passed (possibly with warnings).
+    1   Invalid command options.
+    2   config
+    3   endpoints
+    4   reachability
+    5   tls
+    6   authentication
+    7   read
+    8   write
+
+  Only the etcdv2 datastore is currently supported.
+`
+	parsedArgs, err := docopt.Parse(doc, args, true, "", false, false)
+	if err != nil {
+		fmt.Printf("Invalid option: 'calicoctl %s'. Use flag '--help' to read about a specific subcommand.\n", strings.Join(args, " "))
+		os.Exit(1)
+	}
+	if len(parsedArgs) == 0 {
+		return
+	}
+
+	output := parsedArgs["--output"].(string)
+	if output != "ps" && output != "json" {
+		fmt.Printf("unrecognized output format '%s'\n", output)
+		os.Exit(1)
+	}
+	timeout, err := time.ParseDuration(parsedArgs["--timeout"].(string))
+	if err != nil || timeout <= 0 {
+		fmt.Printf("invalid timeout '%s'\n", parsedArgs["--timeout"])
+		os.Exit(1)
+	}
+
+	c := checker{
+		cf:      parsedArgs["--config"].(string),
+		timeout: timeout,
+		write:   !parsedArgs["--no-write"].(bool),
+	}
+	r := c.run()
+
+	if output == "json" {
+		b, err := json.MarshalIndent(r, "", "  ")
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		fmt.Println(string(b))
+	} else {
+		writer := tabwriter.NewWriter(os.Stdout, 5, 1, 3, ' ', 0)
+		fmt.Fprintf(writer, "STEP\tRESULT\tDETAIL\t\n")
+		for _, s := range r.Steps {
+			fmt.Fprintf(writer, "%s\t%s\t%s\t\n", s.Name, s.Result, s.Detail)
+		}
+		writer.Flush()
+	}
+	os.Exit(r.ExitCode)
+}
+
+// checker performs the datastore check.
+type checker struct {
+	cf      string
+	timeout time.Duration
+	write   bool
+
+	etcdcfg   *etcd.EtcdConfig
+	endpoints []*url.URL
+	reachable []*url.URL
+	tlsConfig *tls.Config
+}
+
+// run performs each step of the check in turn.
+func (c *checker) run() *report {
+	r := &report{}
+
+	if !c.checkConfig(r) {
+		r.skipRemaining("endpoints", "reachability", "tls", "authentication", "read", "write")
+		return r
+	}
+	if !c.checkEndpoints(r) {
+		r.skipRemaining("reachability", "tls", "authentication", "read", "write")
+		return r
+	}
+	if !c.checkReachability(r) {
+		r.skipRemaining("tls", "authentication", "read", "write")
+		return r
+	}
+	if !c.checkTLS(r) {
+		r.skipRemaining("authentication", "read", "write")
+		return r
+	}
+
+	client := &http.Client{
+		Timeout:   c.timeout,
+		Transport: &http.Transport{TLSClientConfig: c.tlsConfig},
+	}
+	endpoint := c.reachable[0]
+	if !c.checkAuthentication(r, client, endpoint) {
+		r.skipRemaining("read", "write")
+		return r
+	}
+	if !c.checkRead(r, client, endpoint) {
+		r.skipRemaining("write")
+		return r
+	}
+	if c.write {
+		c.checkWrite(r, client, endpoint)
+	} else {
+		r.add("write", resultSkip, "disabled by --no-write", 0)
+	}
+	return r
+}
+
+// checkConfig loads the client config.
+func (c *checker) checkConfig(r *report) bool {
+	source, err := clientmgr.ConfigSource(c.cf)
+	if err != nil {
+		r.add("config", resultFail, err.Error(), exitConfig)
+		return false
+	}
+	cfg, err := clientmgr.LoadClientConfig(c.cf)
+	if err != nil {
+		r.add("config", resultFail, fmt.Sprintf("error loading config from %s: %v", source, err), exitConfig)
+		return false
+	}
+	if cfg.BackendType != api.EtcdV2 {
+		r.add("config", resultFail, fmt.Sprintf("unsupported datastore type '%s'", cfg.BackendType), exitConfig)
+		return false
+	}
+	c.etcdcfg = cfg.BackendConfig.(*etcd.EtcdConfig)
+	r.add("config", resultPass, fmt.Sprintf("loaded %s config from %s", cfg.BackendType, source), 0)
+	return true
+}
+
+// checkEndpoints parses the endpoints and resolves the hostnames.
+func (c *checker) checkEndpoints(r *report) bool {
+	var raw []string
+	if c.etcdcfg.EtcdEndpoints != "" {
+		raw = strings.Split(c.etcdcfg.EtcdEndpoints, ",")
+	} else {
+		scheme := c.etcdcfg.EtcdScheme
+		if scheme == "" {
+			scheme = "http"
+		}
+		raw = []string{scheme + "://" + c.etcdcfg.EtcdAuthority}
+	}
+
+	resolved := []string{}
+	problems := []string{}
+	for _, e := range raw {
+		u, err := url.Parse(strings.TrimSpace(e))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("invalid endpoint '%s'", e))
+			continue
+		}
+		if _, err = net.LookupHost(hostname(u)); err != nil {
+			problems = append(problems, fmt.Sprintf("cannot resolve %s: %v", hostname(u), err))
+			continue
+		}
+		c.endpoints = append(c.endpoints, u)
+		resolved = append(resolved, u.String())
+	}
+
+	switch {
+	case len(c.endpoints) == 0:
+		r.add("endpoints", resultFail, strings.Join(problems, "; "), exitEndpoints)
+		return false
+	case len(problems) > 0:
+		r.add("endpoints", resultWarn, fmt.Sprintf("resolved %s; %s",
+			strings.Join(resolved, ","), strings.Join(problems, "; ")), 0)
+	default:
+		r.add("endpoints", resultPass, "resolved "+strings.Join(resolved, ","), 0)
+	}
+	return true
+}
+
+// checkReachability opens a TCP connection to each endpoint.
+func (c *checker) checkReachability(r *report) bool {
+	problems := []string{}
+	for _, u := range c.endpoints {
+		conn, err := net.DialTimeout("tcp", hostPort(u), c.timeout)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("cannot connect to %s: %v", hostPort(u), err))
+			continue
+		}
+		conn.Close()
+		c.reachable = append(c.reachable, u)
+	}
+
+	switch {
+	case len(c.reachable) == 0:
+		r.add("reachability", resultFail, strings.Join(problems, "; "), exitReachability)
+		return false
+	case len(problems) > 0:
+		r.add("reachability", resultWarn, fmt.Sprintf("%d of %d endpoints reachable; %s",
+			len(c.reachable), len(c.endpoints), strings.Join(problems, "; ")), 0)
+	default:
+		r.add("reachability", resultPass, fmt.Sprintf("%d endpoints reachable", len(c.reachable)), 0)
+	}
+	return true
+}
+
+// checkTLS loads the TLS certificates and performs the TLS handshake with each reachable
+// HTTPS endpoint.
+func (c *checker) checkTLS(r *report) bool {
+	https := []*url.URL{}
+	for _, u := range c.reachable {
+		if u.Scheme == "https" {
+			https = append(https, u)
+		}
+	}
+	if len(https) == 0 {
+		r.add("tls", resultSkip, "no HTTPS endpoints", 0)
+		return true
+	}
+
+	c.tlsConfig = &tls.Config{}
+	warnings := []string{}
+	if c.etcdcfg.EtcdCACertFile != "" {
+		pem, err := ioutil.ReadFile(c.etcdcfg.EtcdCACertFile)
+		if err != nil {
+			r.add("tls", resultFail, fmt.Sprintf("cannot read CA certificate: %v", err), exitTLS)
+			return false
+		}
+		c.tlsConfig.RootCAs = x509.NewCertPool()
+		if !c.tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			r.add("tls", resultFail, "no valid certificates in CA certificate file", exitTLS)
+			return false
+		}
+	}
+	if c.etcdcfg.EtcdCertFile != "" || c.etcdcfg.EtcdKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.etcdcfg.EtcdCertFile, c.etcdcfg.EtcdKeyFile)
+		if err != nil {
+			r.add("tls", resultFail, fmt.Sprintf("cannot load client certificate: %v", err), exitTLS)
+			return false
+		}
+		leaf, err := x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			r.add("tls", resultFail, fmt.Sprintf("invalid client certificate: %v", err), exitTLS)
+			return false
+		}
+		if msg, ok := checkExpiry("client certificate", leaf); !ok {
+			r.add("tls", resultFail, msg, exitTLS)
+			return false
+		} else if msg != "" {
+			warnings = append(warnings, msg)
+		}
+		c.tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	for _, u := range https {
+		dialer := &net.Dialer{Timeout: c.timeout}
+		conn, err := tls.DialWithDialer(dialer, "tcp", hostPort(u), c.tlsConfig)
+		if err != nil {
+			r.add("tls", resultFail, fmt.Sprintf("TLS handshake with %s failed: %v", hostPort(u), err), exitTLS)
+			return false
+		}
+		certs := conn.ConnectionState().PeerCertificates
+		conn.Close()
+		if len(certs) > 0 {
+			if msg, ok := checkExpiry("server certificate of "+hostPort(u), certs[0]); !ok {
+				r.add("tls", resultFail, msg, exitTLS)
+				return false
+			} else if msg != "" {
+				warnings = append(warnings, msg)
+			}
+		}
+	}
+
+	if len(warnings) > 0 {
+		r.add("tls", resultWarn, strings.Join(warnings, "; "), 0)
+	} else {
+		r.add("tls", resultPass, fmt.Sprintf("TLS handshake succeeded with %d endpoints", len(https)), 0)
+	}
+	return true
+}
+
+// checkExpiry returns false if the certificate is not yet valid or has expired, and a
+// warning message if the certificate expires soon.
+func checkExpiry(name string, cert *x509.Certificate) (string, bool) {
+	now := time.Now()
+	switch {
+	case now.Before(cert.NotBefore):
+		return fmt.Sprintf("%s is not valid until %s", name, cert.NotBefore.Format(time.RFC3339)), false
+	case now.After(cert.NotAfter):
+		return fmt.Sprintf("%s expired at %s", name, cert.NotAfter.Format(time.RFC3339)), false
+	case now.Add(certExpiryWarning).After(cert.NotAfter):
+		return fmt.Sprintf("%s expires at %s", name, cert.NotAfter.Format(time.RFC3339)), true
+	}
+	return "", true
+}
+
+// checkAuthentication checks whether authentication is enabled in the datastore, and
+// whether credentials are configured to match.  The credentials themselves are verified by
+// the read check, since etcd does not distinguish invalid credentials from insufficient
+// permissions.
+func (c *checker) checkAuthentication(r *report, client *http.Client, endpoint *url.URL) bool {
+	resp, body, err := c.do(client, "GET", endpoint, "/v2/auth/enable", nil)
+	if err != nil {
+		r.add("authentication", resultFail, err.Error(), exitAuthentication)
+		return false
+	}
+	user := c.etcdcfg.EtcdUsername
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		r.add("authentication", resultSkip, "the datastore does not support authentication", 0)
+		return true
+	default:
+		r.add("authentication", resultFail, "checking authentication failed: "+etcdMessage(body), exitAuthentication)
+		return false
+	}
+
+	var status struct {
+		Enabled bool `json:"enabled"`
+	}
+	if err := json.Unmarshal(body, &status); err != nil {
+		r.add("authentication", resultFail, fmt.Sprintf("invalid authentication status: %v", err), exitAuthentication)
+		return false
+	}
+	switch {
+	case status.Enabled && user == "":
+		r.add("authentication", resultWarn, "authentication is enabled but no credentials are configured, requests use the guest role", 0)
+	case status.Enabled:
+		r.add("authentication", resultPass, "authentication is enabled, using the credentials of "+user, 0)
+	case user != "":
+		r.add("authentication", resultWarn, "authentication is disabled, the credentials of "+user+" are ignored", 0)
+	default:
+		r.add("authentication", resultPass, "authentication is disabled", 0)
+	}
+	return true
+}
+
+// checkRead checks that the Calico data may be read using the configured credentials.
+func (c *checker) checkRead(r *report, client *http.Client, endpoint *url.URL) bool {
+	resp, body, err := c.do(client, "GET", endpoint, keysPath(calicoPrefix), nil)
+	if err != nil {
+		r.add("read", resultFail, err.Error(), exitRead)
+		return false
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		r.add("read", resultPass, "read "+calicoPrefix, 0)
+	case http.StatusNotFound:
+		r.add("read", resultWarn, calicoPrefix+" does not exist, the datastore has not been initialized", 0)
+	case http.StatusUnauthorized:
+		r.add("read", resultFail, "the credentials were rejected or do not permit reading "+calicoPrefix+": "+etcdMessage(body), exitRead)
+		return false
+	default:
+		r.add("read", resultFail, fmt.Sprintf("reading %s failed: %s", calicoPrefix, etcdMessage(body)), exitRead)
+		return false
+	}
+	return true
+}
+
+// checkWrite checks that data may be written under the Calico prefix by writing and
+// deleting a temporary key, then removing the directory containing it.
+func (c *checker) checkWrite(r *report, client *http.Client, endpoint *url.URL) {
+	host, _ := os.Hostname()
+	key := fmt.Sprintf("%s/%s-%d", checkDir, host, os.Getpid())
+	form := url.Values{"value": {time.Now().UTC().Format(time.RFC3339)}, "ttl": {"60"}}
+	resp, body, err := c.do(client, "PUT", endpoint, keysPath(key), form)
+	if err != nil {
+		r.add("write", resultFail, err.Error(), exitWrite)
+		return
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		r.add("write", resultFail, fmt.Sprintf("writing %s failed: %s", key, etcdMessage(body)), exitWrite)
+		return
+	}
+	resp, body, err = c.do(client, "DELETE", endpoint, keysPath(key), nil)
+	if err != nil {
+		r.add("write", resultFail, err.Error(), exitWrite)
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		r.add("write", resultFail, fmt.Sprintf("deleting %s failed: %s", key, etcdMessage(body)), exitWrite)
+		return
+	}
+
+	// Remove the directory, which is left in place when the key is deleted.  The directory
+	// is not empty if another check is running concurrently, in which case that check
+	// removes it.
+	resp, body, err = c.do(client, "DELETE", endpoint, keysPath(checkDir), url.Values{"dir": {"true"}})
+	if err != nil {
+		r.add("write", resultFail, err.Error(), exitWrite)
+		return
+	}
+	if resp.StatusCode != http.StatusOK {
+		if code := etcdErrorCode(body); code != etcdErrorKeyNotFound && code != etcdErrorDirNotEmpty {
+			r.add("write", resultWarn, fmt.Sprintf("wrote and deleted %s, but deleting %s failed: %s", key, checkDir, etcdMessage(body)), 0)
+			return
+		}
+	}
+	r.add("write", resultPass, "wrote and deleted "+key, 0)
+}
+
+// keysPath returns the path of the key in the etcd v2 keys API.
+func keysPath(key string) string {
+	return "/v2/keys" + key
+}
+
+// do performs an etcd v2 API request, returning the response and the response body.  The
+// form is sent as the query for GET and DELETE requests, and as the body otherwise.
+func (c *checker) do(client *http.Client, method string, endpoint *url.URL, path string, form url.Values) (*http.Response, []byte, error) {
+	u := *endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + path
+	if form != nil && (method == "GET" || method == "DELETE") {
+		u.RawQuery = form.Encode()
+		form = nil
+	}
+	var req *http.Request
+	var err error
+	if form != nil {
+		req, err = http.NewRequest(method, u.String(), strings.NewReader(form.Encode()))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+	} else {
+		req, err = http.NewRequest(method, u.String(), nil)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.etcdcfg.EtcdUsername != "" {
+		req.SetBasicAuth(c.etcdcfg.EtcdUsername, c.etcdcfg.EtcdPassword)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	return resp, body, err
+}
+
+// etcdMessage returns the error message from an etcd error response body.
+func etcdMessage(body []byte) string {
+	var e struct {
+		Message string `json:"message"`
+		Cause   string `json:"cause"`
+	}
+	if err := json.Unmarshal(body, &e); err != nil || e.Message == "" {
+		return strings.TrimSpace(string(body))
+	}
+	if e.Cause != "" {
+		return e.Message + " (" + e.Cause + ")"
+	}
+	return e.Message
+}
+
+// etcdErrorCode returns the error code from an etcd error response body, or zero if the
+// body is not an etcd error.
+func etcdErrorCode(body []byte) int {
+	var e struct {
+		ErrorCode int `json:"errorCode"`
+	}
+	if err := json.Unmarshal(body, &e); err != nil {
+		return 0
+	}
+	return e.ErrorCode
+}
+
+// hostname returns the hostname of the endpoint.
+func hostname(u *url.URL) string {
+	if host, _, err := net.SplitHostPort(u.Host); err == nil {
+		return host
+	}
+	return strings.Trim(u.Host, "[]")
+}
+
+// hostPort returns the host and port of the endpoint, using the default port of the scheme
+// if the port is not specified.
+func hostPort(u *url.URL) string {
+	if _, _, err := net.SplitHostPort(u.Host); err == nil {
+		return u.Host
+	}
+	port := "80"
+	if u.Scheme == "https" {
+		port = "443"
+	}
+	return net.JoinHostPort(hostname(u), port)
+}
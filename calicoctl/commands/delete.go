@@ -27,10 +27,10 @@ import (
 
 func Delete(args []string) {
 	doc := constants.DatastoreIntro + `Usage:
-  calicoctl delete ([--scope=<SCOPE>] [--node=<NODE>] [--orchestrator=<ORCH>]
-                    [--workload=<WORKLOAD>] (<KIND> [<NAME>]) |
+  calicoctl delete (` + identifierUsage(20, 20) + ` |
                    --filename=<FILE>)
-                   [--skip-not-exists] [--config=<CONFIG>]
+                   [--skip-not-exists] [--parallelism=<N>]
+                   [--config=<CONFIG>]
 
 Examples:
   # Delete a policy using the type and name specified in policy.yaml.
@@ -48,16 +48,9 @@ Options:
                             don't exist.
   -f --filename=<FILENAME>  Filename to use to delete the resource.  If set to
                             "-" loads from stdin.
-  -n --node=<NODE>          The node (this may be the hostname of the compute
-                            server if your installation does not explicitly set
-                            the names of each Calico node).
-     --orchestrator=<ORCH>  The orchestrator (valid for workload endpoints).
-     --workload=<WORKLOAD>  The workload (valid for workload endpoints).
-     --scope=<SCOPE>        The scope of the resource type.  One of global,
-                            node.  This is only valid for BGP peers and is used
-                            to indicate whether the peer is a global peer or
-                            node-specific.
-  -c --config=<CONFIG>      Path to the file containing connection
+     --parallelism=<N>      The number of resources to delete concurrently.
+                            [default: 1]
+` + identifierOptionsHelp(28) + `  -c --config=<CONFIG>      Path to the file containing connection
                             configuration in YAML or JSON format.
                             [default: /etc/calico/calicoctl.cfg]
 
@@ -66,9 +59,9 @@ Description:
   or by type and identifiers.  JSON and YAML formats are accepted for file and
   stdin format.
 
-  Valid resource types are node, bgpPeer, hostEndpoint, workloadEndpoint,
-  ipPool, policy, and profile.  The <TYPE> is case insensitive and may be
-  pluralized.
+  The valid resource types are listed by 'calicoctl api-resources'.  The <KIND>
+  is case insensitive and may be pluralized or replaced by one of the short
+  names of the resource type.
 
   Attempting to delete a resource that does not exists is treated as a
   terminating error unless the --skip-not-exists flag is set.  If this flag is
@@ -85,6 +78,14 @@ Description:
   The resources are deleted in the order they are specified.  In the event of a
   failure deleting a specific resource it is possible to work out which
   resource failed based on the number of resources successfully deleted.
+
+  The --parallelism option sets the number of resources that are deleted
+  concurrently.  Consecutive resources of the same type are deleted
+  concurrently, and each group of resources is completed before the next group
+  is started, so that the groups are deleted in the order they are specified.
+  Results are reported in the order the resources are specified and progress is
+  written to stderr.  When processing concurrently, resources that follow a
+  failed resource in the same group may also have been deleted.
 `
 	parsedArgs, err := docopt.Parse(doc, args, true, "", false, false)
 	if err != nil {
@@ -119,15 +120,7 @@ Description:
 			fmt.Printf("Successfully deleted %d resource(s)\n", results.numHandled)
 		}
 	} else {
-		fmt.Printf("Partial success: ")
-		if results.singleKind != "" {
-			fmt.Printf("deleted the first %d out of %d '%s' resources:\n",
-				results.numHandled, results.numResources, results.singleKind)
-		} else {
-			fmt.Printf("deleted the first %d out of %d resources:\n",
-				results.numHandled, results.numResources)
-		}
-		fmt.Printf("Hit error: %v\n", results.err)
+		printPartialSuccess(results, "deleted")
 		os.Exit(1)
 	}
 }
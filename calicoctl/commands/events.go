@@ -0,0 +1,452 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/docopt/docopt-go"
+	"github.com/projectcalico/calico-containers/calicoctl/commands/clientmgr"
+	"github.com/projectcalico/calico-containers/calicoctl/commands/constants"
+	"github.com/projectcalico/libcalico-go/lib/api"
+	"github.com/projectcalico/libcalico-go/lib/api/unversioned"
+	"github.com/projectcalico/libcalico-go/lib/client"
+)
+
+func Events(args []string) {
+	doc := constants.DatastoreIntro + `Usage:
+  calicoctl events [--interval=<INTERVAL>] [--output=<OUTPUT>]
+                   [--config=<CONFIG>]
+
+Examples:
+  # Display each change to the Calico resources and configuration.
+  calicoctl events
+
+  # Display each change in JSON format.
+  calicoctl events -o json
+
+Options:
+  -h --help                    Show this screen.
+     --interval=<INTERVAL>     The interval at which the datastore is polled
+                               for changes.  [default: 2s]
+  -o --output=<OUTPUT FORMAT>  Output format.  One of: ps, json.
+                               [default: ps]
+  -c --config=<CONFIG>         Filename containing connection configuration in
+                               YAML or JSON format.
+                               [default: /etc/calico/calicoctl.cfg]
+
+Description:
+  The events command displays a single stream of the changes to all of the
+  Calico resources and to the system-wide and node-specific configuration
+  managed by 'calicoctl config'.  The stream is displayed until interrupted.
+
+  Each event contains the following:
+    TIME          The time at which the change was detected.
+    TYPE          The type of change.  One of ADDED, MODIFIED, DELETED.
+    KIND          The kind of resource, or Config for configuration.
+    IDENTIFIERS   The metadata identifying the resource, or the name (and for
+                  node-specific configuration the node) of the configuration.
+    DIFF          For a modified resource, the changed fields in the format
+                  <path>: <old value> -> <new value>.  A field that is not set
+                  is displayed as <none>.
+
+  The JSON output displays one JSON document per event, which is suitable for
+  shipping to a log pipeline.
+
+  The current datastore does not provide a change history or watch API, so the
+  changes are determined by polling the datastore.  Multiple changes to the
+  same resource within the polling interval are reported as a single change.
+  Changes made before the command is started are not displayed.
+`
+	parsedArgs, err := docopt.Parse(doc, args, true, "", false, false)
+	if err != nil {
+		fmt.Printf("Invalid option: 'calicoctl %s'. Use flag '--help' to read about a specific subcommand.\n", strings.Join(args, " "))
+		os.Exit(1)
+	}
+	if len(parsedArgs) == 0 {
+		return
+	}
+
+	var ep changeEventPrinter
+	switch parsedArgs["--output"].(string) {
+	case "ps":
+		ep = changeEventPrinterPS{}
+	case "json":
+		ep = changeEventPrinterJSON{}
+	default:
+		fmt.Printf("unrecognized output format '%s'\n", parsedArgs["--output"])
+		os.Exit(1)
+	}
+
+	interval, err := time.ParseDuration(parsedArgs["--interval"].(string))
+	if err != nil || interval <= 0 {
+		fmt.Printf("invalid interval '%s'\n", parsedArgs["--interval"])
+		os.Exit(1)
+	}
+
+	cf := parsedArgs["--config"].(string)
+	c, err := clientmgr.NewClient(cf)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	// The resources are listed using the same processing as "calicoctl get all".
+	listArgs := map[string]interface{}{
+		"<KIND>":   "all",
+		"--config": cf,
+	}
+
+	differ := newResourceDiffer()
+	seeded := false
+	if err := ep.printHeader(os.Stdout); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	for i := 0; ; i++ {
+		if i > 0 {
+			time.Sleep(interval)
+		}
+
+		// Errors querying the datastore may be transient, so report the error and
+		// continue to poll.  The initial state is not reported, so keep trying to
+		// obtain it until successful.
+		resources, err := listAllResources(c, listArgs)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error getting resources: %v\n", err)
+			continue
+		}
+		events, err := differ.update(resources)
+		if err != nil {
+			fmt.Printf("Error determining changes: %v\n", err)
+			os.Exit(1)
+		}
+		if !seeded {
+			seeded = true
+			continue
+		}
+
+		now := time.Now().UTC()
+		for _, event := range events {
+			ce, err := newChangeEvent(now, event)
+			if err != nil {
+				fmt.Printf("Error determining changes: %v\n", err)
+				os.Exit(1)
+			}
+			if err = ep.print(os.Stdout, ce); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		}
+	}
+}
+
+// listAllResources returns a flattened list of all resources and configuration values.
+func listAllResources(c *client.Client, listArgs map[string]interface{}) ([]unversioned.Resource, error) {
+	results := executeConfigCommand(listArgs, actionList)
+	if results.err != nil {
+		return nil, results.err
+	}
+	resources := convertToSliceOfResources(results.resources)
+
+	nodes := []string{}
+	for _, r := range resources {
+		switch n := r.(type) {
+		case api.Node:
+			nodes = append(nodes, n.Metadata.Name)
+		case *api.Node:
+			nodes = append(nodes, n.Metadata.Name)
+		}
+	}
+	configs, err := clientmgr.Read("get the configuration", func() (interface{}, error) {
+		return listConfigValues(c.Config(), nodes)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return append(resources, configs.([]unversioned.Resource)...), nil
+}
+
+// configValue is a pseudo-resource representing a single configuration value managed by
+// "calicoctl config".  This allows configuration changes to be tracked in the same way as
+// resource changes.
+type configValue struct {
+	unversioned.TypeMetadata
+	Metadata configValueMetadata `json:"metadata"`
+	Value    string              `json:"value"`
+}
+
+type configValueMetadata struct {
+	Name string `json:"name"`
+	Node string `json:"node,omitempty"`
+}
+
+func newConfigValue(name, node, value string) configValue {
+	return configValue{
+		TypeMetadata: unversioned.TypeMetadata{Kind: "Config"},
+		Metadata:     configValueMetadata{Name: name, Node: node},
+		Value:        value,
+	}
+}
+
+// listConfigValues returns the global configuration values, and the node-specific
+// configuration values for each of the specified nodes.
+func listConfigValues(c client.ConfigInterface, nodes []string) ([]unversioned.Resource, error) {
+	configs := []unversioned.Resource{}
+
+	level, err := c.GetGlobalLogLevel()
+	if err != nil {
+		return nil, err
+	}
+	configs = append(configs, newConfigValue("logLevel", "", level))
+
+	mesh, err := c.GetNodeToNodeMesh()
+	if err != nil {
+		return nil, err
+	}
+	configs = append(configs, newConfigValue("nodeToNodeMesh", "", onOff(mesh)))
+
+	asn, err := c.GetGlobalASNumber()
+	if err != nil {
+		return nil, err
+	}
+	configs = append(configs, newConfigValue("asNumber", "", asn.String()))
+
+	ipip, err := c.GetGlobalIPIP()
+	if err != nil {
+		return nil, err
+	}
+	configs = append(configs, newConfigValue("ipip", "", onOff(ipip)))
+
+	// Only include node-specific values that are explicitly set on the node, inherited
+	// values are covered by the global value.
+	for _, node := range nodes {
+		level, location, err := c.GetNodeLogLevel(node)
+		if err != nil {
+			return nil, err
+		}
+		if location == client.ConfigLocationNode {
+			configs = append(configs, newConfigValue("logLevel", node, level))
+		}
+	}
+	return configs, nil
+}
+
+// onOff returns the "calicoctl config" representation of a boolean value.
+func onOff(b bool) string {
+	if b {
+		return "on"
+	}
+	return "off"
+}
+
+// changeEvent is a single change to a resource or configuration value.
+type changeEvent struct {
+	Time        time.Time         `json:"time"`
+	Type        watchEventType    `json:"type"`
+	Kind        string            `json:"kind"`
+	Identifiers map[string]string `json:"identifiers"`
+	Diff        []fieldChange     `json:"diff,omitempty"`
+}
+
+// fieldChange is a change to a single field of a resource.  The values are the JSON
+// encoded values of the field, or blank if the field is not set.
+type fieldChange struct {
+	Path string `json:"path"`
+	Old  string `json:"old,omitempty"`
+	New  string `json:"new,omitempty"`
+}
+
+// newChangeEvent creates a changeEvent from the watch event.
+func newChangeEvent(t time.Time, event watchEvent) (changeEvent, error) {
+	ce := changeEvent{
+		Time: t,
+		Type: event.Type,
+		Kind: event.Object.GetTypeMetadata().Kind,
+	}
+
+	current, err := flattenResource(event.Object)
+	if err != nil {
+		return ce, err
+	}
+	ce.Identifiers = identifiersFromFields(current)
+
+	if event.Type != watchModified || event.previous == nil {
+		return ce, nil
+	}
+	previous, err := flattenResource(event.previous)
+	if err != nil {
+		return ce, err
+	}
+	paths := []string{}
+	for path := range current {
+		paths = append(paths, path)
+	}
+	for path := range previous {
+		if _, ok := current[path]; !ok {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		if previous[path] != current[path] {
+			ce.Diff = append(ce.Diff, fieldChange{Path: path, Old: previous[path], New: current[path]})
+		}
+	}
+	return ce, nil
+}
+
+// flattenResource returns a map of the JSON encoded values of each leaf field in the
+// resource, keyed off the dot-separated path of the field.  Elements of lists are keyed
+// off their index.
+func flattenResource(r unversioned.Resource) (map[string]string, error) {
+	var data interface{}
+	if b, err := json.Marshal(r); err != nil {
+		return nil, err
+	} else if err = json.Unmarshal(b, &data); err != nil {
+		return nil, err
+	}
+
+	fields := map[string]string{}
+	var flatten func(prefix string, v interface{}) error
+	flatten = func(prefix string, v interface{}) error {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			for k, e := range t {
+				if err := flatten(joinPath(prefix, k), e); err != nil {
+					return err
+				}
+			}
+		case []interface{}:
+			for i, e := range t {
+				if err := flatten(joinPath(prefix, fmt.Sprint(i)), e); err != nil {
+					return err
+				}
+			}
+		case nil:
+		default:
+			b, err := json.Marshal(t)
+			if err != nil {
+				return err
+			}
+			fields[prefix] = string(b)
+		}
+		return nil
+	}
+	if err := flatten("", data); err != nil {
+		return nil, err
+	}
+
+	// The kind and API version are the same for both versions of the resource, and
+	// are displayed separately.
+	delete(fields, "kind")
+	delete(fields, "apiVersion")
+	return fields, nil
+}
+
+// resourceIdentifiers returns the metadata fields that identify the resource, keyed off
+// the dot-separated path of the field within the metadata.  Labels are not included.
+func resourceIdentifiers(r unversioned.Resource) (map[string]string, error) {
+	fields, err := flattenResource(r)
+	if err != nil {
+		return nil, err
+	}
+	return identifiersFromFields(fields), nil
+}
+
+// identifiersFromFields returns the identifying metadata fields from the flattened fields
+// of a resource.
+func identifiersFromFields(fields map[string]string) map[string]string {
+	ids := map[string]string{}
+	for path, value := range fields {
+		if strings.HasPrefix(path, "metadata.") && !strings.HasPrefix(path, "metadata.labels.") {
+			ids[strings.TrimPrefix(path, "metadata.")] = strings.Trim(value, `"`)
+		}
+	}
+	return ids
+}
+
+func joinPath(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// changeEventPrinter is implemented by each of the events output formats.
+type changeEventPrinter interface {
+	printHeader(w io.Writer) error
+	print(w io.Writer, event changeEvent) error
+}
+
+// changeEventPrinterPS displays each event as a single line.  The events are displayed as
+// they occur, so the columns are not aligned.
+type changeEventPrinterPS struct{}
+
+func (p changeEventPrinterPS) printHeader(w io.Writer) error {
+	_, err := fmt.Fprintln(w, "TIME   TYPE   KIND   IDENTIFIERS   DIFF")
+	return err
+}
+
+func (p changeEventPrinterPS) print(w io.Writer, event changeEvent) error {
+	keys := []string{}
+	for k := range event.Identifiers {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	ids := make([]string, len(keys))
+	for i, k := range keys {
+		ids[i] = k + "=" + event.Identifiers[k]
+	}
+
+	diffs := make([]string, len(event.Diff))
+	for i, d := range event.Diff {
+		diffs[i] = fmt.Sprintf("%s: %s -> %s", d.Path, valueOrNone(d.Old), valueOrNone(d.New))
+	}
+
+	_, err := fmt.Fprintf(w, "%s   %s   %s   %s   %s\n",
+		event.Time.Format(time.RFC3339), event.Type, event.Kind,
+		strings.Join(ids, ","), strings.Join(diffs, ", "))
+	return err
+}
+
+func valueOrNone(v string) string {
+	if v == "" {
+		return "<none>"
+	}
+	return v
+}
+
+// changeEventPrinterJSON displays each event as a single line JSON document.
+type changeEventPrinterJSON struct{}
+
+func (p changeEventPrinterJSON) printHeader(w io.Writer) error {
+	return nil
+}
+
+func (p changeEventPrinterJSON) print(w io.Writer, event changeEvent) error {
+	b, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", string(b))
+	return err
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/projectcalico/libcalico-go/lib/api"
+	"github.com/projectcalico/libcalico-go/lib/api/unversioned"
+)
+
+var _ = Describe("Test resource change events", func() {
+	var wep *api.WorkloadEndpoint
+	var differ *resourceDiffer
+
+	BeforeEach(func() {
+		wep = api.NewWorkloadEndpoint()
+		wep.Metadata.Node = "node1"
+		wep.Metadata.Orchestrator = "k8s"
+		wep.Metadata.Workload = "default.web"
+		wep.Metadata.Name = "eth0"
+		wep.Metadata.Labels = map[string]string{"app": "web"}
+
+		differ = newResourceDiffer()
+		events, err := differ.update([]unversioned.Resource{*wep})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Type).To(Equal(watchAdded))
+	})
+
+	It("should report a label change as a modification with a field diff", func() {
+		updated := *wep
+		updated.Metadata.Labels = map[string]string{"app": "db"}
+		events, err := differ.update([]unversioned.Resource{updated})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Type).To(Equal(watchModified))
+
+		ce, err := newChangeEvent(time.Now(), events[0])
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ce.Identifiers).To(Equal(map[string]string{
+			"node":         "node1",
+			"orchestrator": "k8s",
+			"workload":     "default.web",
+			"name":         "eth0",
+		}))
+		Expect(ce.Diff).To(Equal([]fieldChange{
+			{Path: "metadata.labels.app", Old: `"web"`, New: `"db"`},
+		}))
+	})
+
+	It("should report a removed resource as a deletion", func() {
+		other := *wep
+		other.Metadata.Name = "eth1"
+		events, err := differ.update([]unversioned.Resource{other})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(HaveLen(2))
+		Expect(events[0].Type).To(Equal(watchAdded))
+		Expect(events[1].Type).To(Equal(watchDeleted))
+	})
+
+	It("should not report an unchanged resource", func() {
+		events, err := differ.update([]unversioned.Resource{*wep})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(events).To(BeEmpty())
+	})
+})
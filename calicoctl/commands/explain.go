@@ -0,0 +1,151 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/docopt/docopt-go"
+	"github.com/projectcalico/calico-containers/calicoctl/resourcemgr"
+)
+
+func Explain(args []string) {
+	doc := `Usage:
+  calicoctl explain <KIND> [--columns]
+
+Examples:
+  # Describe the fields of a policy resource.
+  calicoctl explain policy
+
+  # Describe the fields of the ingress rules of a policy resource.
+  calicoctl explain policy.spec.ingress
+
+  # List the column headings that may be used in the get output for a workload
+  # endpoint.
+  calicoctl explain workloadEndpoint --columns
+
+Options:
+  -h --help      Show this screen.
+     --columns   List the column headings that may be used in the ps-style,
+                 wide and custom-columns output of the get command.
+
+Description:
+  The explain command describes the structure of a resource type, or of a field
+  within a resource type.  The field is specified by appending the path to the
+  field to the resource type using "." as a separator, e.g. policy.spec.order.
+  Each element of the path is the JSON/YAML key of the field.
+
+  For each field the following is displayed:
+    -  the JSON/YAML key of the field
+    -  the type of the field
+    -  whether the field is required
+    -  the validation constraints applied to the value of the field.
+
+  The valid resource types are listed by 'calicoctl api-resources'.  The <KIND>
+  is case insensitive and may be pluralized or replaced by one of the short
+  names of the resource type.
+`
+	parsedArgs, err := docopt.Parse(doc, args, true, "", false, false)
+	if err != nil {
+		fmt.Printf("Invalid option: 'calicoctl %s'. Use flag '--help' to read about a specific subcommand.\n", strings.Join(args, " "))
+		os.Exit(1)
+	}
+	if len(parsedArgs) == 0 {
+		return
+	}
+
+	// The kind may include a path to a field.  Create a resource of the requested kind
+	// to look up the resource manager.
+	path := strings.Split(parsedArgs["<KIND>"].(string), ".")
+	kind := path[0]
+	resource, err := getResourceFromArguments(map[string]interface{}{}, kind)
+	if err != nil {
+		fmt.Printf("Error executing command: %v\n", err)
+		os.Exit(1)
+	}
+	rm := resourcemgr.GetResourceManager(resource)
+	kind = resource.GetTypeMetadata().Kind
+
+	if parsedArgs["--columns"].(bool) {
+		if len(path) > 1 {
+			fmt.Println("Error executing command: a field may not be specified with --columns")
+			os.Exit(1)
+		}
+		printColumns(os.Stdout, rm)
+		return
+	}
+
+	fi, err := rm.GetFieldInfo(path[1:])
+	if err != nil {
+		fmt.Printf("Error executing command: %v\n", err)
+		os.Exit(1)
+	}
+	printFieldInfo(os.Stdout, kind, path[1:], fi)
+}
+
+// printFieldInfo writes the description of a field (and the fields it contains) to the
+// writer.
+func printFieldInfo(w io.Writer, kind string, path []string, fi resourcemgr.FieldInfo) {
+	tw := tabwriter.NewWriter(w, 5, 1, 3, ' ', 0)
+	fmt.Fprintf(tw, "KIND:\t%s\n", kind)
+	if len(path) > 0 {
+		fmt.Fprintf(tw, "FIELD:\t%s\n", strings.Join(path, "."))
+		fmt.Fprintf(tw, "KEY:\t%s\n", fi.Key)
+	}
+	fmt.Fprintf(tw, "TYPE:\t%s\n", fi.Type)
+	if len(path) > 0 {
+		fmt.Fprintf(tw, "REQUIRED:\t%v\n", fi.Required)
+		if len(fi.Validation) > 0 {
+			fmt.Fprintf(tw, "VALIDATION:\t%s\n", strings.Join(fi.Validation, ","))
+		}
+	}
+	tw.Flush()
+
+	if len(fi.Fields) == 0 {
+		return
+	}
+
+	fmt.Fprintf(w, "\nFIELDS:\n")
+	tw = tabwriter.NewWriter(w, 5, 1, 3, ' ', 0)
+	fmt.Fprintf(tw, "  KEY\tTYPE\tREQUIRED\tVALIDATION\t\n")
+	for _, f := range fi.Fields {
+		fmt.Fprintf(tw, "  %s\t%s\t%v\t%s\t\n", f.Key, f.Type, f.Required, strings.Join(f.Validation, ","))
+	}
+	tw.Flush()
+}
+
+// printColumns writes the table headings that are valid for the resource to the writer,
+// indicating which are included in the default and wide output.
+func printColumns(w io.Writer, rm resourcemgr.ResourceManager) {
+	inDefault := make(map[string]bool)
+	for _, h := range rm.GetTableDefaultHeadings(false) {
+		inDefault[h] = true
+	}
+	inWide := make(map[string]bool)
+	for _, h := range rm.GetTableDefaultHeadings(true) {
+		inWide[h] = true
+	}
+
+	tw := tabwriter.NewWriter(w, 5, 1, 3, ' ', 0)
+	fmt.Fprintf(tw, "HEADING\tPS\tWIDE\t\n")
+	for _, h := range rm.GetTableHeadings() {
+		fmt.Fprintf(tw, "%s\t%v\t%v\t\n", h, inDefault[h], inWide[h])
+	}
+	tw.Flush()
+}
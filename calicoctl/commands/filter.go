@@ -0,0 +1,185 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/projectcalico/libcalico-go/lib/api/unversioned"
+	"github.com/projectcalico/libcalico-go/lib/selector"
+)
+
+// fieldRequirement is a single requirement of a field selector, e.g. spec.order=100.
+type fieldRequirement struct {
+	path   []string
+	value  string
+	negate bool
+}
+
+// resourceFilter filters resources using a label selector and a field selector.
+type resourceFilter struct {
+	selector selector.Selector
+	fields   []fieldRequirement
+}
+
+// newResourceFilter creates a resourceFilter from the label selector expression and the
+// field selector.  The field selector is a comma-separated list of <path>=<value> or
+// <path>!=<value> requirements, where the path is the dot-separated path of JSON/YAML keys,
+// e.g. "metadata.node=node1,spec.interfaceName!=eth0".  Returns nil if neither the selector
+// nor the field selector is specified.
+func newResourceFilter(sel, fields string) (*resourceFilter, error) {
+	if sel == "" && fields == "" {
+		return nil, nil
+	}
+
+	f := &resourceFilter{}
+	if sel != "" {
+		s, err := selector.Parse(sel)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector '%s': %v", sel, err)
+		}
+		f.selector = s
+	}
+	if fields != "" {
+		for _, req := range strings.Split(fields, ",") {
+			fr := fieldRequirement{}
+			parts := strings.SplitN(req, "!=", 2)
+			if len(parts) == 2 {
+				fr.negate = true
+			} else {
+				parts = strings.SplitN(req, "=", 2)
+			}
+			if len(parts) != 2 || parts[0] == "" {
+				return nil, fmt.Errorf("invalid field selector '%s', expecting <path>=<value> or <path>!=<value>", req)
+			}
+			fr.path = strings.Split(parts[0], ".")
+			fr.value = parts[1]
+			f.fields = append(f.fields, fr)
+		}
+	}
+	return f, nil
+}
+
+// filter returns the resources that match the filter.  The resources may include resource
+// lists, in which case the list is replaced by a copy of the list containing only the
+// matching items.
+func (f *resourceFilter) filter(resources []unversioned.Resource) []unversioned.Resource {
+	if f == nil {
+		return resources
+	}
+
+	filtered := []unversioned.Resource{}
+	for _, r := range resources {
+		if !strings.HasSuffix(r.GetTypeMetadata().Kind, "List") {
+			if f.matches(r) {
+				filtered = append(filtered, r)
+			}
+			continue
+		}
+
+		// This is a resource list.  Create a copy of the list and filter the items.
+		v := reflect.Indirect(reflect.ValueOf(r))
+		list := reflect.New(v.Type())
+		list.Elem().Set(v)
+		items := list.Elem().FieldByName("Items")
+		matched := reflect.MakeSlice(items.Type(), 0, items.Len())
+		for i := 0; i < items.Len(); i++ {
+			if f.matches(items.Index(i).Interface().(unversioned.Resource)) {
+				matched = reflect.Append(matched, items.Index(i))
+			}
+		}
+		items.Set(matched)
+		filtered = append(filtered, list.Interface().(unversioned.Resource))
+	}
+	return filtered
+}
+
+// matches returns true if the resource matches the filter.  Resources that do not have
+// labels are treated as having no labels.
+func (f *resourceFilter) matches(r unversioned.Resource) bool {
+	if f.selector != nil && !f.selector.Evaluate(resourceLabels(r)) {
+		return false
+	}
+	if len(f.fields) == 0 {
+		return true
+	}
+
+	// Convert the resource to a generic map so that the fields may be looked up by
+	// their JSON/YAML keys.
+	var m interface{}
+	if b, err := json.Marshal(r); err != nil {
+		return false
+	} else if err = json.Unmarshal(b, &m); err != nil {
+		return false
+	}
+	for _, fr := range f.fields {
+		value, ok := lookupField(m, fr.path)
+		equal := ok && value == fr.value
+		if equal == fr.negate {
+			return false
+		}
+	}
+	return true
+}
+
+// lookupField returns the string representation of the value at the path in the generic
+// (unmarshalled JSON) data, and whether the value exists.  Keys are matched ignoring case.
+func lookupField(data interface{}, path []string) (string, bool) {
+	for _, p := range path {
+		m, ok := data.(map[string]interface{})
+		if !ok {
+			return "", false
+		}
+		found := false
+		for k, v := range m {
+			if strings.EqualFold(k, p) {
+				data = v
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "", false
+		}
+	}
+	if data == nil {
+		return "", false
+	}
+	return fmt.Sprint(data), true
+}
+
+// resourceLabels returns the labels of the resource (the Metadata.Labels field), or nil if
+// the resource does not have labels.
+func resourceLabels(r unversioned.Resource) map[string]string {
+	v := reflect.Indirect(reflect.ValueOf(r))
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	md := v.FieldByName("Metadata")
+	if !md.IsValid() || md.Kind() != reflect.Struct {
+		return nil
+	}
+	labels := md.FieldByName("Labels")
+	if !labels.IsValid() {
+		return nil
+	}
+	if l, ok := labels.Interface().(map[string]string); ok {
+		return l
+	}
+	return nil
+}
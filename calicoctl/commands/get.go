@@ -16,6 +16,7 @@ package commands
 
 import (
 	"os"
+	"time"
 
 	"github.com/docopt/docopt-go"
 
@@ -23,15 +24,20 @@ import (
 	"strings"
 
 	log "github.com/Sirupsen/logrus"
+	"github.com/projectcalico/calico-containers/calicoctl/commands/argutils"
 	"github.com/projectcalico/calico-containers/calicoctl/commands/constants"
+	"github.com/projectcalico/libcalico-go/lib/api/unversioned"
 )
 
 func Get(args []string) {
 	doc := constants.DatastoreIntro + `Usage:
-  calicoctl get ([--scope=<SCOPE>] [--node=<NODE>] [--orchestrator=<ORCH>]
-                 [--workload=<WORKLOAD>] (<KIND> [<NAME>]) |
+  calicoctl get (` + identifierUsage(17, 17) + ` |
                 --filename=<FILENAME>)
-                [--output=<OUTPUT>] [--config=<CONFIG>]
+                [--selector=<SELECTOR>] [--field-selector=<FIELDS>]
+                [--watch [--watch-interval=<INTERVAL>]]
+                [--output=<OUTPUT>] [--output-file=<OUTFILE>]
+                [--template-legacy] [--config=<CONFIG>]
+  calicoctl get --help-templates
 
 Examples:
   # List all policy in default output format.
@@ -40,23 +46,56 @@ Examples:
   # List a specific policy in YAML format
   calicoctl get -o yaml policy my-policy-1
 
+  # List all policies and profiles.
+  calicoctl get policy,profile
+
+  # List the workload and host endpoints on node "node1".
+  calicoctl get workloadendpoints,hostendpoints --node=node1
+
+  # List all resources of every type.
+  calicoctl get all
+
+  # List the workload endpoints with the label "app" set to "db".
+  calicoctl get workloadendpoints --selector="app == 'db'"
+
+  # List the workload endpoints using interface "cali1234".
+  calicoctl get workloadendpoints --field-selector=spec.interfaceName=cali1234
+
+  # Watch for changes to workload endpoints on node "node1".
+  calicoctl get workloadendpoints --node=node1 --watch
+
+  # List the value of the "app" label on each workload endpoint.
+  calicoctl get workloadendpoints -o go-template='{{range .Items}}
+    {{- label "app" .Metadata.Labels | default "-"}}{{"\n"}}{{end}}'
+
 Options:
   -h --help                    Show this screen.
+     --help-templates          List the functions available to go-template,
+                               go-template-file and custom-columns output.
   -f --filename=<FILENAME>     Filename to use to get the resource.  If set to
                                "-" loads from stdin.
   -o --output=<OUTPUT FORMAT>  Output format.  One of: yaml, json, ps, wide,
                                custom-columns=..., go-template=...,
                                go-template-file=...   [Default: ps]
-  -n --node=<NODE>             The node (this may be the hostname of the
-                               compute server if your installation does not
-                               explicitly set the names of each Calico node).
-     --orchestrator=<ORCH>     The orchestrator (valid for workload endpoints).
-     --workload=<WORKLOAD>     The workload (valid for workload endpoints).
-     --scope=<SCOPE>           The scope of the resource type.  One of global,
-                               node.  This is only valid for BGP peers and is
-                               used to indicate whether the peer is a global
-                               peer or node-specific.
-  -c --config=<CONFIG>         Path to the file containing connection
+     --output-file=<OUTFILE>   Write the output to the specified file instead
+                               of stdout.  The file is only replaced once all
+                               of the output has been successfully written.
+     --template-legacy         Execute go-template and go-template-file
+                               templates against the raw list of results
+                               rather than the template root object.
+  -l --selector=<SELECTOR>     Only display resources whose labels match the
+                               selector expression, e.g. "app == 'db'".
+     --field-selector=<FIELDS> Only display resources whose fields match the
+                               comma-separated list of <path>=<value> or
+                               <path>!=<value> requirements, where <path> is
+                               the dot-separated path of the field, e.g.
+                               metadata.node=node1.
+  -w --watch                   After displaying the requested resources, watch
+                               for changes and display each change.
+     --watch-interval=<INTERVAL>
+                               The interval at which the datastore is polled
+                               for changes when watching.  [default: 2s]
+` + identifierOptionsHelp(31) + `  -c --config=<CONFIG>         Path to the file containing connection
                                configuration in YAML or JSON format.
                                [default: /etc/calico/calicoctl.cfg]
 
@@ -65,17 +104,23 @@ Description:
   or by type and identifiers.  JSON and YAML formats are accepted for file and
   stdin format.
 
-  Valid resource types are node, bgpPeer, hostEndpoint, workloadEndpoint,
-  ipPool, policy and profile.  The <TYPE> is case insensitive and may be
-  pluralized.
+  The valid resource types are listed by 'calicoctl api-resources'.  The <KIND>
+  is case insensitive and may be pluralized or replaced by one of the short
+  names of the resource type.
 
   Attempting to get resources that do not exist will simply return no results.
 
-  When getting resources by type, only a single type may be specified at a
-  time.  The name and other identifiers (hostname, scope) are optional, and are
-  wildcarded when omitted. Thus if you specify no identifiers at all (other
-  than type), then all configured resources of the requested type will be
-  returned.
+  When getting resources by type, multiple types may be specified as a
+  comma-separated list, or the type "all" may be specified to get resources of
+  every type.  The name and other identifiers (hostname, scope) are optional,
+  and are wildcarded when omitted. Thus if you specify no identifiers at all
+  (other than type), then all configured resources of the requested types will
+  be returned.  The name may only be specified when a single type is requested,
+  the other identifiers apply to each of the requested types that use them.
+
+  When multiple types are requested the ps-style output displays a separate
+  table for each type, titled with the type.  The YAML and JSON output displays
+  a single list containing resources of each of the requested types.
 
   By default the results are output in a ps-style table output.  There are
   alternative ways to display the data using the --output option:
@@ -96,6 +141,46 @@ Description:
   input to all of the resource management commands (create, apply, replace,
   delete, get).
 
+  The --output-file option writes the output to a file rather than to stdout.
+  The output is written to a temporary file which is renamed to the requested
+  file once complete, so an existing file is never left partially written.
+
+  The --selector and --field-selector options filter the returned resources.
+  The selector uses the same syntax as the selector of a policy and matches
+  against the labels of the resource.  Resources that do not have labels are
+  treated as having no labels.
+
+  The --watch option displays the requested resources, then polls the datastore
+  and displays each subsequent change to the resources until interrupted.  Each
+  change is one of ADDED, MODIFIED or DELETED.  For the ps-style output, each
+  change is displayed as a table row prefixed with the type of change.  For the
+  YAML and JSON output, each change is displayed as a separate document
+  containing the type of change and the resource.  The --watch option may not
+  be used with the --output-file option.
+
+  The golang templates are executed against a root object with the following
+  fields:
+
+    .Kind                 The kind of the returned resources, or "List" if
+                          more than one kind of resource is returned.
+    .Items                The returned resources.  This is always a flat list
+                          of resources, as per the YAML and JSON output.
+    .Type                 When watching, the type of change (ADDED, MODIFIED
+                          or DELETED).  Items contains the changed resource.
+
+  For example, to display the names of all policies:
+    calicoctl get policy -o go-template='{{range .Items}}{{.Metadata.Name}} {{end}}'
+
+  Previous versions of calicoctl executed the template against the raw list of
+  results, which may contain lists of resources depending on whether resources
+  were requested by kind or by file.  The --template-legacy option may be used
+  to retain this behavior.
+
+  The golang templates may use a curated set of functions in addition to the
+  standard golang template functions, for example to format labels, convert
+  values to YAML or JSON, or test whether an IP address is within a CIDR.  Use
+  'calicoctl get --help-templates' to list the available functions.
+
   Please refer to the docs at http://docs.projectcalico.org for more details on
   the output formats, including example outputs, resource structure (required
   for the golang template definitions) and the valid column names (required for
@@ -109,6 +194,10 @@ Description:
 	if len(parsedArgs) == 0 {
 		return
 	}
+	if parsedArgs["--help-templates"].(bool) {
+		fmt.Print(templateFuncsHelp())
+		return
+	}
 
 	var rp resourcePrinter
 	output := parsedArgs["--output"].(string)
@@ -140,13 +229,19 @@ Description:
 				fmt.Printf("need to specify a template")
 				os.Exit(1)
 			}
-			rp = resourcePrinterTemplate{template: outputValue}
+			rp = resourcePrinterTemplate{
+				template: outputValue,
+				legacy:   parsedArgs["--template-legacy"].(bool),
+			}
 		case "go-template-file":
 			if outputValue == "" {
 				fmt.Printf("need to specify a template file")
 				os.Exit(1)
 			}
-			rp = resourcePrinterTemplateFile{templateFile: outputValue}
+			rp = resourcePrinterTemplateFile{
+				templateFile: outputValue,
+				legacy:       parsedArgs["--template-legacy"].(bool),
+			}
 		case "custom-columns":
 			if outputValue == "" {
 				fmt.Printf("need to specify at least one column")
@@ -161,6 +256,29 @@ Description:
 		os.Exit(1)
 	}
 
+	filter, err := newResourceFilter(
+		argutils.ArgStringOrBlank(parsedArgs, "--selector"),
+		argutils.ArgStringOrBlank(parsedArgs, "--field-selector"),
+	)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	watch := parsedArgs["--watch"].(bool)
+	var interval time.Duration
+	if watch {
+		if argutils.ArgStringOrBlank(parsedArgs, "--output-file") != "" {
+			fmt.Println("--watch may not be used with --output-file")
+			os.Exit(1)
+		}
+		interval, err = time.ParseDuration(parsedArgs["--watch-interval"].(string))
+		if err != nil || interval <= 0 {
+			fmt.Printf("invalid watch interval '%s'\n", parsedArgs["--watch-interval"])
+			os.Exit(1)
+		}
+	}
+
 	results := executeConfigCommand(parsedArgs, actionList)
 	log.Infof("results: %+v", results)
 
@@ -168,9 +286,65 @@ Description:
 		fmt.Printf("Error getting resources: %v\n", results.err)
 		os.Exit(1)
 	}
+	results.resources = filter.filter(results.resources)
 
-	err = rp.print(results.resources)
-	if err != nil {
+	// Write the output to stdout, or atomically to the output file if requested.
+	if outputFile := argutils.ArgStringOrBlank(parsedArgs, "--output-file"); outputFile != "" {
+		w, err := newAtomicFileWriter(outputFile)
+		if err != nil {
+			fmt.Printf("Error writing output file: %v\n", err)
+			os.Exit(1)
+		}
+		if err = rp.print(w, results.resources); err != nil {
+			w.abort()
+			fmt.Printf("Error writing output file: %v\n", err)
+			os.Exit(1)
+		}
+		if err = w.commit(); err != nil {
+			fmt.Printf("Error writing output file: %v\n", err)
+			os.Exit(1)
+		}
+	} else if err = rp.print(os.Stdout, results.resources); err != nil {
 		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if watch {
+		watchResources(parsedArgs, rp, filter, results.resources, interval)
+	}
+}
+
+// watchResources polls for the resources identified by the arguments and displays each
+// change to the resources since the previous poll.  The initial set of resources is the set
+// that has already been displayed.  This does not return.
+func watchResources(args map[string]interface{}, rp resourcePrinter, filter *resourceFilter,
+	initial []unversioned.Resource, interval time.Duration) {
+	differ := newResourceDiffer()
+	if _, err := differ.update(convertToSliceOfResources(initial)); err != nil {
+		fmt.Printf("Error watching resources: %v\n", err)
+		os.Exit(1)
+	}
+
+	for {
+		time.Sleep(interval)
+
+		// Errors querying the datastore may be transient, so report the error and
+		// continue to watch.
+		results := executeConfigCommand(args, actionList)
+		if results.err != nil {
+			fmt.Fprintf(os.Stderr, "Error getting resources: %v\n", results.err)
+			continue
+		}
+		events, err := differ.update(convertToSliceOfResources(filter.filter(results.resources)))
+		if err != nil {
+			fmt.Printf("Error watching resources: %v\n", err)
+			os.Exit(1)
+		}
+		for _, event := range events {
+			if err = rp.printEvent(os.Stdout, event); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		}
 	}
 }
@@ -0,0 +1,25 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"github.com/projectcalico/calico-containers/calicoctl/commands/policy"
+)
+
+// Graph displays the graph of the policies and profiles that apply to each endpoint, and
+// the endpoints that are allowed to send traffic to each other.
+func Graph(args []string) {
+	policy.Graph(args)
+}
@@ -23,6 +23,7 @@ import (
 
 	docopt "github.com/docopt/docopt-go"
 	"github.com/projectcalico/calico-containers/calicoctl/commands/argutils"
+	"github.com/projectcalico/calico-containers/calicoctl/commands/audit"
 	"github.com/projectcalico/calico-containers/calicoctl/commands/clientmgr"
 	"github.com/projectcalico/calico-containers/calicoctl/commands/constants"
 )
@@ -65,6 +66,18 @@ Description:
 		os.Exit(1)
 	}
 
+	// Releasing an IP address is subject to the local policy.
+	ctlCfg, err := clientmgr.LoadCalicoctlConfig(cf)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err = ctlCfg.Permitted("IPAddress", "release"); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	auditLog := audit.NewLogger(ctlCfg.AuditLog)
+
 	ipamClient := client.IPAM()
 	passedIP := parsedArgs["--ip"].(string)
 
@@ -73,15 +86,39 @@ Description:
 
 	// Call ReleaseIPs releases the IP and returns an empty slice as unallocatedIPs if
 	// release was successful else it returns back the slice with the IP passed in.
-	unallocatedIPs, err := ipamClient.ReleaseIPs(ips)
+	var unallocatedIPs []net.IP
+	unallocated, err := clientmgr.Write("release the IP address", func() (interface{}, error) {
+		return ipamClient.ReleaseIPs(ips)
+	})
+	if err == nil {
+		unallocatedIPs = unallocated.([]net.IP)
+	}
+
+	// Couldn't release the IP if the slice is not empty or IP might already be
+	// released/unassigned.  The command fails, and is recorded as a failure in the audit log.
+	result := err
+	if err == nil && len(unallocatedIPs) != 0 {
+		result = fmt.Errorf("IP address %s is not assigned", ip)
+	}
+	ar := audit.Resource{
+		Kind:        "IPAddress",
+		Identifiers: map[string]string{"ip": ip.String()},
+	}
+	numHandled := 0
+	if result == nil {
+		numHandled = 1
+		ar.Before = map[string]bool{"assigned": true}
+		ar.After = map[string]bool{"assigned": false}
+	}
+	if aerr := auditLog.Log("ipam release", []audit.Resource{ar}, numHandled, result); aerr != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write audit log: %v\n", aerr)
+	}
+
 	if err != nil {
 		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
-
-	// Couldn't release the IP if the slice is not empty or IP might already be released/unassigned.
-	// This is not exactly an error, so not returning it to the caller.
-	if len(unallocatedIPs) != 0 {
+	if result != nil {
 		fmt.Printf("IP address %s is not assigned\n", ip)
 		os.Exit(1)
 	}
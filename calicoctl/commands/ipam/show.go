@@ -63,7 +63,19 @@ Description:
 	ipamClient := client.IPAM()
 	passedIP := parsedArgs["--ip"].(string)
 	ip := argutils.ValidateIP(passedIP)
-	attr, err := ipamClient.GetAssignmentAttributes(ip)
+	var attr map[string]string
+	v, err := clientmgr.Read("get the IP address attributes", func() (interface{}, error) {
+		return ipamClient.GetAssignmentAttributes(ip)
+	})
+	if err == nil {
+		attr = v.(map[string]string)
+	}
+
+	// A timeout is an error, as the assignment of the IP address is unknown.
+	if _, ok := err.(clientmgr.ErrTimeout); ok {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 
 	// IP address is not assigned, this prints message like
 	// `IP 192.168.71.1 is not assigned in block`. This is not exactly an error,
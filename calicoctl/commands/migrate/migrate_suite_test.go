@@ -0,0 +1,13 @@
+package migrate_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Migrate Suite")
+}
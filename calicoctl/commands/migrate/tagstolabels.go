@@ -0,0 +1,460 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/docopt/docopt-go"
+	"github.com/ghodss/yaml"
+	"github.com/projectcalico/calico-containers/calicoctl/commands/audit"
+	"github.com/projectcalico/calico-containers/calicoctl/commands/clientmgr"
+	"github.com/projectcalico/calico-containers/calicoctl/commands/constants"
+	"github.com/projectcalico/calico-containers/calicoctl/resourcemgr"
+	"github.com/projectcalico/libcalico-go/lib/api"
+	"github.com/projectcalico/libcalico-go/lib/api/unversioned"
+	"github.com/projectcalico/libcalico-go/lib/client"
+)
+
+// The value of the labels that replace profile tags.  Tag references are replaced by
+// selectors that only check for the presence of the label, so any value is equivalent.
+const tagLabelValue = "true"
+
+// migrationChange is an update to a single resource, along with a description of each
+// change made to the resource.
+type migrationChange struct {
+	kind         string
+	identifiers  map[string]string
+	before       unversioned.Resource
+	after        unversioned.Resource
+	descriptions []string
+}
+
+// tagResources is the set of resources read from the datastore that are migrated.
+type tagResources struct {
+	profiles []api.Profile
+	policies []api.Policy
+}
+
+// TagsToLabels replaces the tags of profiles with labels on the profiles, which are
+// inherited by the endpoints that use the profiles, and replaces references to tags in
+// policy and profile rules with selectors.
+func TagsToLabels(args []string) {
+	doc := constants.DatastoreIntro + `Usage:
+  calicoctl migrate tags-to-labels [--apply] [--remove-tags]
+                                   [--label-prefix=<PREFIX>]
+                                   [--rollback-file=<FILE>] [--config=<CONFIG>]
+
+Examples:
+  # Display the changes required to migrate from tags to labels.
+  calicoctl migrate tags-to-labels
+
+  # Make the changes, saving the current resources to rollback.yaml.
+  calicoctl migrate tags-to-labels --apply --rollback-file=rollback.yaml
+
+  # Undo the changes.
+  calicoctl replace -f rollback.yaml
+
+Options:
+  -h --help                  Show this screen.
+     --apply                 Make the changes.  Without this option the changes
+                             are displayed but not made.
+     --remove-tags           Remove the tags from the profiles once they have
+                             been replaced.
+     --label-prefix=<PREFIX> The prefix of the label that replaces each tag.
+                             [default: tag/]
+     --rollback-file=<FILE>  The file to save the current version of each
+                             changed resource to, before making the changes.
+                             [default: calicoctl-tags-to-labels-rollback.yaml]
+  -c --config=<CONFIG>       Path to the file containing connection
+                             configuration in YAML or JSON format.
+                             [default: /etc/calico/calicoctl.cfg]
+
+Description:
+  The migrate tags-to-labels command replaces the tags of profiles (which
+  are deprecated) with labels and selectors that select the same endpoints:
+
+    - Each profile is given a label for each of its tags, which is inherited
+      by the workload endpoints and host endpoints that use the profile.  The
+      label name is the tag with the label prefix, and the label value is
+      "true".  A profile that already has the label is unchanged.
+    - Each tag or notTag in the rules of the policies and profiles is replaced
+      by a selector or notSelector that checks for the label, for example the
+      tag "db" becomes the selector "has(tag/db)".  A rule that already has a
+      selector is given the combination of both.
+    - With --remove-tags, the tags are removed from the profiles.
+
+  By default the command is a dry run, which displays the changes without
+  making them.  Re-run the command with --apply to make the changes.  Before
+  making any changes, the current version of each resource that is changed
+  is saved to the rollback file, which must not already exist.  Restore the
+  resources with 'calicoctl replace -f <FILE>'.
+
+  The labels are added to the profiles first, followed by the changes to the
+  policies and then the changes to the rules and tags of the profiles, so
+  that the selectors only replace tags once the endpoints inherit the labels.
+  A profile may therefore be updated twice.  If any update fails, the
+  resources already updated are restored.
+
+  The endpoints themselves are not changed.  Endpoints that are created after
+  the migration inherit the labels from their profiles.
+`
+	parsedArgs, err := docopt.Parse(doc, args, true, "", false, false)
+	if err != nil {
+		fmt.Printf("Invalid option: 'calicoctl %s'. Use flag '--help' to read about a specific subcommand.\n", strings.Join(args, " "))
+		os.Exit(1)
+	}
+	if len(parsedArgs) == 0 {
+		return
+	}
+
+	cf := parsedArgs["--config"].(string)
+	c, err := clientmgr.NewClient(cf)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	resources, err := listTagResources(c)
+	if err != nil {
+		fmt.Printf("Error executing command: %v\n", err)
+		os.Exit(1)
+	}
+
+	changes, err := planTagsToLabels(resources, parsedArgs["--label-prefix"].(string), parsedArgs["--remove-tags"].(bool))
+	if err != nil {
+		fmt.Printf("Error executing command: %v\n", err)
+		os.Exit(1)
+	}
+	if len(changes) == 0 {
+		fmt.Println("No changes are required.")
+		return
+	}
+	printChanges(os.Stdout, changes)
+
+	if !parsedArgs["--apply"].(bool) {
+		fmt.Printf("\nDry run: %d resource(s) would be changed.  Re-run with --apply to make the changes.\n", numResources(changes))
+		return
+	}
+
+	ctlCfg, err := clientmgr.LoadCalicoctlConfig(cf)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	for _, ch := range changes {
+		if err = ctlCfg.Permitted(ch.kind, "replace"); err != nil {
+			fmt.Printf("Error executing command: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	rollbackFile := parsedArgs["--rollback-file"].(string)
+	if err = saveRollback(rollbackFile, changes); err != nil {
+		fmt.Printf("Error executing command: failed to save rollback file: %v\n", err)
+		os.Exit(1)
+	}
+	if err = applyChanges(c, ctlCfg, changes); err != nil {
+		fmt.Printf("Error executing command: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("\nChanged %d resource(s).  To undo the changes run 'calicoctl replace -f %s'.\n", numResources(changes), rollbackFile)
+}
+
+// listTagResources lists the profiles and policies in the datastore.
+func listTagResources(c *client.Client) (*tagResources, error) {
+	r := &tagResources{}
+
+	profiles, err := clientmgr.Read("list profiles", func() (interface{}, error) {
+		return c.Profiles().List(api.ProfileMetadata{})
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.profiles = profiles.(*api.ProfileList).Items
+
+	policies, err := clientmgr.Read("list policies", func() (interface{}, error) {
+		return c.Policies().List(api.PolicyMetadata{})
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.policies = policies.(*api.PolicyList).Items
+	return r, nil
+}
+
+// planTagsToLabels returns the changes to the resources, in the order they must be made:
+// the labels of the profiles, then the policies, then the rules and tags of the profiles.
+// Each changed resource is validated.
+func planTagsToLabels(r *tagResources, prefix string, removeTags bool) ([]migrationChange, error) {
+	changes := []migrationChange{}
+	labelled := make([]api.Profile, len(r.profiles))
+	for i, p := range r.profiles {
+		labelled[i] = p
+		labels, desc := addTagLabels(p.Metadata.Labels, p.Spec.Tags, prefix)
+		if len(desc) == 0 {
+			continue
+		}
+		labelled[i].Metadata.Labels = labels
+		changes = append(changes, migrationChange{
+			kind:         p.Kind,
+			identifiers:  map[string]string{"name": p.Metadata.Name},
+			before:       p,
+			after:        labelled[i],
+			descriptions: desc,
+		})
+	}
+
+	for _, p := range r.policies {
+		after := p
+		var ingress, egress []string
+		after.Spec.IngressRules, ingress = replaceTagRules(p.Spec.IngressRules, "ingress", prefix)
+		after.Spec.EgressRules, egress = replaceTagRules(p.Spec.EgressRules, "egress", prefix)
+		if desc := append(ingress, egress...); len(desc) > 0 {
+			changes = append(changes, migrationChange{
+				kind:         p.Kind,
+				identifiers:  map[string]string{"name": p.Metadata.Name},
+				before:       p,
+				after:        after,
+				descriptions: desc,
+			})
+		}
+	}
+	for _, p := range labelled {
+		after := p
+		var ingress, egress []string
+		after.Spec.IngressRules, ingress = replaceTagRules(p.Spec.IngressRules, "ingress", prefix)
+		after.Spec.EgressRules, egress = replaceTagRules(p.Spec.EgressRules, "egress", prefix)
+		desc := append(ingress, egress...)
+		if removeTags && len(p.Spec.Tags) > 0 {
+			after.Spec.Tags = nil
+			desc = append(desc, fmt.Sprintf("remove tags %s", strings.Join(p.Spec.Tags, ",")))
+		}
+		if len(desc) > 0 {
+			changes = append(changes, migrationChange{
+				kind:         p.Kind,
+				identifiers:  map[string]string{"name": p.Metadata.Name},
+				before:       p,
+				after:        after,
+				descriptions: desc,
+			})
+		}
+	}
+
+	for _, ch := range changes {
+		if err := resourcemgr.Validate(ch.after); err != nil {
+			return nil, fmt.Errorf("the migrated %s %s is not valid: %v", ch.kind, identifierString(ch.identifiers), err)
+		}
+	}
+	return changes, nil
+}
+
+// addTagLabels returns a copy of the labels with a label for each tag, along with a
+// description of each label added.  Labels that already exist are unchanged.
+func addTagLabels(labels map[string]string, tags []string, prefix string) (map[string]string, []string) {
+	updated := map[string]string{}
+	for k, v := range labels {
+		updated[k] = v
+	}
+	desc := []string{}
+	for _, tag := range tags {
+		key := prefix + tag
+		if _, ok := updated[key]; ok {
+			continue
+		}
+		updated[key] = tagLabelValue
+		desc = append(desc, fmt.Sprintf("add label %s=%s", key, tagLabelValue))
+	}
+	return updated, desc
+}
+
+// replaceTagRules returns a copy of the rules with each tag and notTag replaced by a
+// selector that checks for the label, along with a description of each replacement.
+func replaceTagRules(rules []api.Rule, direction, prefix string) ([]api.Rule, []string) {
+	if len(rules) == 0 {
+		return rules, nil
+	}
+	updated := make([]api.Rule, len(rules))
+	copy(updated, rules)
+	desc := []string{}
+	for i := range updated {
+		for _, e := range []struct {
+			name   string
+			entity *api.EntityRule
+		}{
+			{"source", &updated[i].Source},
+			{"destination", &updated[i].Destination},
+		} {
+			if e.entity.Tag != "" {
+				sel := fmt.Sprintf("has(%s%s)", prefix, e.entity.Tag)
+				if e.entity.Selector != "" {
+					sel = fmt.Sprintf("(%s) && %s", e.entity.Selector, sel)
+				}
+				desc = append(desc, fmt.Sprintf("%s rule %d: replace %s tag %s with selector %q",
+					direction, i+1, e.name, e.entity.Tag, sel))
+				e.entity.Selector = sel
+				e.entity.Tag = ""
+			}
+			if e.entity.NotTag != "" {
+				// Traffic is excluded if it has the tag or matches the existing
+				// notSelector, so the expressions are combined with "or".
+				sel := fmt.Sprintf("has(%s%s)", prefix, e.entity.NotTag)
+				if e.entity.NotSelector != "" {
+					sel = fmt.Sprintf("(%s) || %s", e.entity.NotSelector, sel)
+				}
+				desc = append(desc, fmt.Sprintf("%s rule %d: replace %s notTag %s with notSelector %q",
+					direction, i+1, e.name, e.entity.NotTag, sel))
+				e.entity.NotSelector = sel
+				e.entity.NotTag = ""
+			}
+		}
+	}
+	return updated, desc
+}
+
+// saveRollback writes the current version of each changed resource to the file, in a
+// format that may be restored using calicoctl replace.  A resource that is changed more
+// than once is saved as it was before the first change.  An existing file is not
+// replaced, since it may contain the rollback data of an earlier migration.
+func saveRollback(file string, changes []migrationChange) error {
+	resources := []unversioned.Resource{}
+	saved := map[string]bool{}
+	for _, ch := range changes {
+		key := ch.kind + " " + identifierString(ch.identifiers)
+		if !saved[key] {
+			saved[key] = true
+			resources = append(resources, ch.before)
+		}
+	}
+	b, err := yaml.Marshal(resources)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if os.IsExist(err) {
+		return fmt.Errorf("%s already exists", file)
+	} else if err != nil {
+		return err
+	}
+	if _, err = f.Write(b); err != nil {
+		f.Close()
+		os.Remove(file)
+		return err
+	}
+	return f.Close()
+}
+
+// applyChanges updates each resource in turn.  If an update fails, the resources that have
+// already been updated are restored.  The changes are recorded in the audit log.
+func applyChanges(c *client.Client, ctlCfg *clientmgr.CalicoctlConfig, changes []migrationChange) error {
+	resources := []audit.Resource{}
+	var err error
+	done := 0
+	for ; done < len(changes); done++ {
+		ch := changes[done]
+		ar := audit.Resource{Kind: ch.kind, Identifiers: ch.identifiers, Before: ch.before}
+		var updated unversioned.Resource
+		if updated, err = updateResource(c, ch.after); err != nil {
+			err = fmt.Errorf("failed to update %s %s: %v", ch.kind, identifierString(ch.identifiers), err)
+			break
+		}
+		ar.After = updated
+		resources = append(resources, ar)
+	}
+
+	if err != nil {
+		for i := done - 1; i >= 0; i-- {
+			ch := changes[i]
+			if _, rerr := updateResource(c, ch.before); rerr != nil {
+				err = fmt.Errorf("%v; failed to restore %s %s: %v", err, ch.kind, identifierString(ch.identifiers), rerr)
+				continue
+			}
+			resources[i].After = ch.before
+		}
+	}
+
+	auditLog := audit.NewLogger(ctlCfg.AuditLog)
+	numHandled := 0
+	if err == nil {
+		numHandled = len(changes)
+	}
+	if aerr := auditLog.Log("replace", resources, numHandled, err); aerr != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write audit log: %v\n", aerr)
+	}
+	return err
+}
+
+// updateResource updates a profile or policy in the datastore.
+func updateResource(c *client.Client, r unversioned.Resource) (unversioned.Resource, error) {
+	updated, err := clientmgr.Write("update "+r.GetTypeMetadata().Kind, func() (interface{}, error) {
+		switch r := r.(type) {
+		case api.Profile:
+			u, err := c.Profiles().Update(&r)
+			if err != nil {
+				return nil, err
+			}
+			return *u, nil
+		case api.Policy:
+			u, err := c.Policies().Update(&r)
+			if err != nil {
+				return nil, err
+			}
+			return *u, nil
+		}
+		return nil, fmt.Errorf("unsupported resource kind %s", r.GetTypeMetadata().Kind)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated.(unversioned.Resource), nil
+}
+
+// numResources returns the number of different resources changed.
+func numResources(changes []migrationChange) int {
+	keys := map[string]bool{}
+	for _, ch := range changes {
+		keys[ch.kind+" "+identifierString(ch.identifiers)] = true
+	}
+	return len(keys)
+}
+
+// identifierString returns the identifiers in the form name=value, sorted by name.
+func identifierString(ids map[string]string) string {
+	keys := make([]string, 0, len(ids))
+	for k := range ids {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + ids[k]
+	}
+	return strings.Join(parts, ",")
+}
+
+// printChanges writes each changed resource followed by a description of each change.
+func printChanges(w io.Writer, changes []migrationChange) {
+	for _, ch := range changes {
+		fmt.Fprintf(w, "%s %s\n", ch.kind, identifierString(ch.identifiers))
+		for _, d := range ch.descriptions {
+			fmt.Fprintf(w, "  %s\n", d)
+		}
+	}
+}
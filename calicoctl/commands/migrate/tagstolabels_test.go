@@ -0,0 +1,131 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migrate
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/projectcalico/libcalico-go/lib/api"
+)
+
+// taggedProfile returns a profile with the tags and labels.
+func taggedProfile(name string, tags []string, labels map[string]string) api.Profile {
+	p := api.NewProfile()
+	p.Metadata.Name = name
+	p.Metadata.Labels = labels
+	p.Spec.Tags = tags
+	return *p
+}
+
+// ingressPolicy returns a policy with the ingress rules.
+func ingressPolicy(name string, rules ...api.Rule) api.Policy {
+	p := api.NewPolicy()
+	p.Metadata.Name = name
+	p.Spec.IngressRules = rules
+	return *p
+}
+
+var _ = DescribeTable("Test replace tag rules",
+	func(rule, expected api.Rule, numChanges int) {
+		updated, desc := replaceTagRules([]api.Rule{rule}, "ingress", "tag/")
+		Expect(updated).To(Equal([]api.Rule{expected}))
+		Expect(desc).To(HaveLen(numChanges))
+	},
+	Entry("a rule without tags",
+		api.Rule{Action: "allow", Source: api.EntityRule{Selector: "app == 'web'"}},
+		api.Rule{Action: "allow", Source: api.EntityRule{Selector: "app == 'web'"}}, 0),
+	Entry("a tag",
+		api.Rule{Action: "allow", Source: api.EntityRule{Tag: "web"}},
+		api.Rule{Action: "allow", Source: api.EntityRule{Selector: "has(tag/web)"}}, 1),
+	Entry("a notTag",
+		api.Rule{Action: "deny", Destination: api.EntityRule{NotTag: "db"}},
+		api.Rule{Action: "deny", Destination: api.EntityRule{NotSelector: "has(tag/db)"}}, 1),
+	Entry("a tag with a selector must match both",
+		api.Rule{Action: "allow", Source: api.EntityRule{Tag: "web", Selector: "app == 'web'"}},
+		api.Rule{Action: "allow", Source: api.EntityRule{Selector: "(app == 'web') && has(tag/web)"}}, 1),
+	Entry("a notTag with a notSelector excludes either",
+		api.Rule{Action: "allow", Source: api.EntityRule{NotTag: "db", NotSelector: "app == 'db'"}},
+		api.Rule{Action: "allow", Source: api.EntityRule{NotSelector: "(app == 'db') || has(tag/db)"}}, 1),
+	Entry("a tag and a notTag",
+		api.Rule{Action: "allow", Source: api.EntityRule{Tag: "web", NotTag: "db"}},
+		api.Rule{Action: "allow", Source: api.EntityRule{Selector: "has(tag/web)", NotSelector: "has(tag/db)"}}, 2),
+)
+
+var _ = DescribeTable("Test add tag labels",
+	func(labels map[string]string, tags []string, expected map[string]string, numChanges int) {
+		updated, desc := addTagLabels(labels, tags, "tag/")
+		Expect(updated).To(Equal(expected))
+		Expect(desc).To(HaveLen(numChanges))
+	},
+	Entry("no tags", map[string]string{"app": "web"}, nil, map[string]string{"app": "web"}, 0),
+	Entry("a tag",
+		map[string]string{"app": "web"}, []string{"web"},
+		map[string]string{"app": "web", "tag/web": "true"}, 1),
+	Entry("an existing label is unchanged",
+		map[string]string{"tag/web": "false"}, []string{"web", "db"},
+		map[string]string{"tag/web": "false", "tag/db": "true"}, 1),
+)
+
+var _ = Describe("Test plan tags to labels", func() {
+	It("should label the profiles before changing the policies and profile rules", func() {
+		r := &tagResources{
+			profiles: []api.Profile{taggedProfile("web", []string{"web"}, nil)},
+			policies: []api.Policy{ingressPolicy("allow-web", api.Rule{Action: "allow", Source: api.EntityRule{Tag: "web"}})},
+		}
+		r.profiles[0].Spec.IngressRules = []api.Rule{{Action: "allow", Source: api.EntityRule{Tag: "web"}}}
+
+		changes, err := planTagsToLabels(r, "tag/", true)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(HaveLen(3))
+		Expect(changes[0].kind).To(Equal("profile"))
+		Expect(changes[0].descriptions).To(Equal([]string{"add label tag/web=true"}))
+		Expect(changes[1].kind).To(Equal("policy"))
+		Expect(changes[2].kind).To(Equal("profile"))
+		Expect(changes[2].descriptions).To(Equal([]string{
+			`ingress rule 1: replace source tag web with selector "has(tag/web)"`,
+			"remove tags web",
+		}))
+
+		// The second change to the profile keeps the label, and the original profile is
+		// the version that is restored.
+		after := changes[2].after.(api.Profile)
+		Expect(after.Metadata.Labels).To(Equal(map[string]string{"tag/web": "true"}))
+		Expect(after.Spec.Tags).To(BeNil())
+		Expect(changes[0].before).To(Equal(r.profiles[0]))
+		Expect(numResources(changes)).To(Equal(2))
+	})
+
+	It("should not label a profile that already has the label", func() {
+		r := &tagResources{
+			profiles: []api.Profile{taggedProfile("web", []string{"web"}, map[string]string{"tag/web": "true"})},
+		}
+		changes, err := planTagsToLabels(r, "tag/", false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(BeEmpty())
+	})
+
+	It("should replace a tag that no profile has", func() {
+		r := &tagResources{
+			policies: []api.Policy{ingressPolicy("allow-old", api.Rule{Action: "allow", Source: api.EntityRule{Tag: "old"}})},
+		}
+		changes, err := planTagsToLabels(r, "tag/", false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(changes).To(HaveLen(1))
+		after := changes[0].after.(api.Policy)
+		Expect(after.Spec.IngressRules[0].Source).To(Equal(api.EntityRule{Selector: "has(tag/old)"}))
+	})
+})
@@ -0,0 +1,87 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// atomicFileWriter is an io.Writer that writes to a temporary file in the same directory
+// as the target file.  The target file is only replaced (by renaming the temporary file)
+// when the output is committed, so readers of the target file never see partial output
+// and a failure part way through leaves any existing file untouched.
+type atomicFileWriter struct {
+	file *os.File
+	path string
+}
+
+// newAtomicFileWriter creates a new atomicFileWriter for the specified target file.
+func newAtomicFileWriter(path string) (*atomicFileWriter, error) {
+	dir, base := filepath.Split(path)
+	if dir == "" {
+		dir = "."
+	}
+	f, err := ioutil.TempFile(dir, "."+base+".")
+	if err != nil {
+		return nil, err
+	}
+	return &atomicFileWriter{file: f, path: path}, nil
+}
+
+// Write implements the io.Writer interface.
+func (a *atomicFileWriter) Write(p []byte) (int, error) {
+	return a.file.Write(p)
+}
+
+// commit flushes the temporary file to disk and renames it to the target file.
+func (a *atomicFileWriter) commit() error {
+	if err := a.file.Sync(); err != nil {
+		a.abort()
+		return err
+	}
+	if err := a.file.Close(); err != nil {
+		a.abort()
+		return err
+	}
+
+	// The temporary file is created with restrictive permissions.  Preserve the mode
+	// of the file we are replacing, or use the standard mode for a new file.
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(a.path); err == nil {
+		mode = fi.Mode()
+	}
+	if err := os.Chmod(a.file.Name(), mode); err != nil {
+		a.abort()
+		return err
+	}
+	if err := os.Rename(a.file.Name(), a.path); err != nil {
+		a.abort()
+		return err
+	}
+	log.Infof("Output written to %s", a.path)
+	return nil
+}
+
+// abort discards the temporary file leaving the target file untouched.
+func (a *atomicFileWriter) abort() {
+	a.file.Close()
+	if err := os.Remove(a.file.Name()); err != nil && !os.IsNotExist(err) {
+		log.Warnf("Unable to remove temporary file %s: %v", a.file.Name(), err)
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/projectcalico/calico-containers/calicoctl/commands/audit"
+	"github.com/projectcalico/libcalico-go/lib/api/unversioned"
+)
+
+// The minimum interval between progress reports.
+const progressInterval = time.Second
+
+// resourceOutcome is the outcome of performing the action on a single resource.
+type resourceOutcome struct {
+	// The resource supplied to the action.
+	supplied unversioned.Resource
+
+	// Whether the action was performed.  Once a resource has failed, no further actions
+	// are started.
+	done bool
+
+	// The resource returned by the action, the audit record of the action, and the
+	// error returned by the action.
+	resource unversioned.Resource
+	audit    audit.Resource
+	err      error
+}
+
+// resourceBatches splits the resources into batches of consecutive resources that may be
+// processed concurrently.  Each batch contains resources of a single kind, and a batch
+// never contains the same resource more than once.  The batches, and the resources within
+// each batch, are in the order of the supplied resources.  The batches contain the indices
+// of the resources.
+func resourceBatches(resources []unversioned.Resource) [][]int {
+	batches := [][]int{}
+	var batch []int
+	var kind string
+	keys := map[string]bool{}
+	for i, r := range resources {
+		key, err := resourceKey(r)
+		if batch == nil || r.GetTypeMetadata().Kind != kind || (err == nil && keys[key]) {
+			if batch != nil {
+				batches = append(batches, batch)
+			}
+			batch = []int{}
+			kind = r.GetTypeMetadata().Kind
+			keys = map[string]bool{}
+		}
+		batch = append(batch, i)
+		if err == nil {
+			keys[key] = true
+		}
+	}
+	if batch != nil {
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// processResources calls the supplied function for each resource, processing up to
+// parallelism resources concurrently, and returns the outcomes in the order of the
+// supplied resources.  The resources are processed in batches (see resourceBatches), with
+// each batch completing before the next is started.  Once a resource has failed no
+// further resources are started, so with a parallelism of 1 processing stops at the first
+// failure.  Progress is written to stderr when processing concurrently.
+func processResources(resources []unversioned.Resource, parallelism int, f func(unversioned.Resource) resourceOutcome) []resourceOutcome {
+	outcomes := make([]resourceOutcome, len(resources))
+	for i, r := range resources {
+		outcomes[i].supplied = r
+	}
+	p := newProgress(len(resources), parallelism > 1 && len(resources) > 1)
+
+	var mutex sync.Mutex
+	failed := false
+	for _, batch := range resourceBatches(resources) {
+		sem := make(chan struct{}, parallelism)
+		var wg sync.WaitGroup
+		for _, i := range batch {
+			sem <- struct{}{}
+			mutex.Lock()
+			stop := failed
+			mutex.Unlock()
+			if stop {
+				<-sem
+				break
+			}
+
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				o := f(resources[i])
+				o.supplied = resources[i]
+				o.done = true
+				outcomes[i] = o
+
+				mutex.Lock()
+				if o.err != nil {
+					failed = true
+				}
+				mutex.Unlock()
+				p.increment()
+				<-sem
+			}(i)
+		}
+		wg.Wait()
+		if failed {
+			break
+		}
+	}
+	p.finish()
+	return outcomes
+}
+
+// progress writes the number of processed resources to stderr, at most once per
+// progressInterval.
+type progress struct {
+	enabled   bool
+	total     int
+	mutex     sync.Mutex
+	processed int
+	last      time.Time
+}
+
+func newProgress(total int, enabled bool) *progress {
+	return &progress{enabled: enabled, total: total, last: time.Now()}
+}
+
+// increment records that a resource has been processed.
+func (p *progress) increment() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.processed++
+	if p.enabled && time.Since(p.last) >= progressInterval {
+		p.last = time.Now()
+		fmt.Fprintf(os.Stderr, "Processed %d of %d resources\n", p.processed, p.total)
+	}
+}
+
+// finish writes the final number of processed resources.
+func (p *progress) finish() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.enabled {
+		fmt.Fprintf(os.Stderr, "Processed %d of %d resources\n", p.processed, p.total)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/docopt/docopt-go"
+	"github.com/projectcalico/calico-containers/calicoctl/commands/policy"
+)
+
+// Policy takes keyword with a policy command then calls the subcommands.
+func Policy(args []string) {
+	doc := `Usage:
+  calicoctl policy <command> [<args>...]
+
+    for          Show the policies and profiles that apply to an endpoint.
+    lint         Report shadowed, redundant and unused policy rules.
+    move         Move a policy before or after another policy.
+    preview      Preview the endpoints selected by the policies in a file.
+    render       Show the iptables rules that implement the policies.
+    renumber     Renumber the orders of all policies.
+    simulate     Simulate the policy verdict for traffic between two peers.
+    suggest      Suggest policies that allow the connections in a conntrack dump.
+
+Options:
+  -h --help      Show this screen.
+
+Description:
+  Policy analysis commands for calicoctl.
+
+  See 'calicoctl policy <command> --help' to read about a specific subcommand.
+`
+	arguments, err := docopt.Parse(doc, args, true, "", true, false)
+	if err != nil {
+		fmt.Printf("Invalid option: 'calicoctl %s'. Use flag '--help' to read about a specific subcommand.\n", strings.Join(args, " "))
+		os.Exit(1)
+	}
+	if arguments["<command>"] == nil {
+		return
+	}
+
+	command := arguments["<command>"].(string)
+	args = append([]string{"policy", command}, arguments["<args>"].([]string)...)
+
+	switch command {
+	case "for":
+		policy.For(args)
+	case "move":
+		policy.Move(args)
+	case "renumber":
+		policy.Renumber(args)
+	case "lint":
+		policy.Lint(args)
+	case "preview":
+		policy.Preview(args)
+	case "render":
+		policy.Render(args)
+	case "simulate":
+		policy.Simulate(args)
+	case "suggest":
+		policy.Suggest(args)
+	default:
+		fmt.Println(doc)
+	}
+}
@@ -0,0 +1,254 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/ghodss/yaml"
+	"github.com/projectcalico/calico-containers/calicoctl/commands/clientmgr"
+	"github.com/projectcalico/calico-containers/calicoctl/resourcemgr"
+	"github.com/projectcalico/libcalico-go/lib/api"
+	"github.com/projectcalico/libcalico-go/lib/client"
+	calicoErrors "github.com/projectcalico/libcalico-go/lib/errors"
+	"github.com/projectcalico/libcalico-go/lib/selector"
+)
+
+// endpoint contains the details of a workload or host endpoint that determine which
+// policies and profiles apply to it.
+type endpoint struct {
+	Kind        string            `json:"kind"`
+	Identifiers map[string]string `json:"identifiers,omitempty"`
+	Labels      map[string]string `json:"labels"`
+	Profiles    []string          `json:"profiles"`
+}
+
+// getEndpoint returns the endpoint of the specified kind identified by the command line
+// identifiers.  The identifiers must match exactly one endpoint.
+func getEndpoint(c *client.Client, kind string, ids map[string]string) (*endpoint, error) {
+	r, err := resourcemgr.NewResourceFromIdentifiers(kind, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := []endpoint{}
+	switch e := r.(type) {
+	case api.WorkloadEndpoint:
+		l, err := clientmgr.Read("list workload endpoints", func() (interface{}, error) {
+			return c.WorkloadEndpoints().List(e.Metadata)
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, wep := range l.(*api.WorkloadEndpointList).Items {
+			endpoints = append(endpoints, endpoint{
+				Kind: e.Kind,
+				Identifiers: map[string]string{
+					"node":         wep.Metadata.Node,
+					"orchestrator": wep.Metadata.Orchestrator,
+					"workload":     wep.Metadata.Workload,
+					"name":         wep.Metadata.Name,
+				},
+				Labels:   wep.Metadata.Labels,
+				Profiles: wep.Spec.Profiles,
+			})
+		}
+	case api.HostEndpoint:
+		l, err := clientmgr.Read("list host endpoints", func() (interface{}, error) {
+			return c.HostEndpoints().List(e.Metadata)
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, hep := range l.(*api.HostEndpointList).Items {
+			endpoints = append(endpoints, endpoint{
+				Kind: e.Kind,
+				Identifiers: map[string]string{
+					"node": hep.Metadata.Node,
+					"name": hep.Metadata.Name,
+				},
+				Labels:   hep.Metadata.Labels,
+				Profiles: hep.Spec.Profiles,
+			})
+		}
+	default:
+		return nil, fmt.Errorf("resource type '%s' is not an endpoint", kind)
+	}
+
+	switch len(endpoints) {
+	case 0:
+		return nil, errors.New("no matching endpoint found")
+	case 1:
+		return &endpoints[0], nil
+	}
+	return nil, fmt.Errorf("%d endpoints match the identifiers, specify additional identifiers "+
+		"to identify a single endpoint", len(endpoints))
+}
+
+// parseLabels parses a comma-separated list of <key>=<value> labels.
+func parseLabels(s string) (map[string]string, error) {
+	labels := map[string]string{}
+	if strings.TrimSpace(s) == "" {
+		return labels, nil
+	}
+	for _, kv := range strings.Split(s, ",") {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("invalid label '%s', expecting <key>=<value>", kv)
+		}
+		labels[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+	}
+	return labels, nil
+}
+
+// parseList parses a comma-separated list, ignoring empty entries.
+func parseList(s string) []string {
+	l := []string{}
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			l = append(l, v)
+		}
+	}
+	return l
+}
+
+// listPolicies returns all of the policies, in the order they are applied.
+func listPolicies(c *client.Client) ([]api.Policy, error) {
+	l, err := clientmgr.Read("list policies", func() (interface{}, error) {
+		return c.Policies().List(api.PolicyMetadata{})
+	})
+	if err != nil {
+		return nil, err
+	}
+	policies := l.(*api.PolicyList).Items
+	sortPolicies(policies)
+	return policies, nil
+}
+
+// sortPolicies sorts the policies into the order they are applied: by increasing order,
+// with policies that do not specify an order applied last, and then by name.
+func sortPolicies(policies []api.Policy) {
+	sort.Stable(policiesByOrder(policies))
+}
+
+type policiesByOrder []api.Policy
+
+func (p policiesByOrder) Len() int      { return len(p) }
+func (p policiesByOrder) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p policiesByOrder) Less(i, j int) bool {
+	oi, oj := p[i].Spec.Order, p[j].Spec.Order
+	switch {
+	case oi != nil && oj != nil && *oi != *oj:
+		return *oi < *oj
+	case oi != nil && oj == nil:
+		return true
+	case oi == nil && oj != nil:
+		return false
+	}
+	return p[i].Metadata.Name < p[j].Metadata.Name
+}
+
+// orderString returns the display value of the order of the policy.
+func orderString(p api.Policy) string {
+	return formatOrder(p.Spec.Order)
+}
+
+// formatOrder returns the display value of a policy order.
+func formatOrder(order *float64) string {
+	if order == nil {
+		return "<default>"
+	}
+	return fmt.Sprint(*order)
+}
+
+// selectsLabels returns true if the selector expression matches the labels.  An empty
+// selector is equivalent to all(), as it is in Felix.
+func selectsLabels(sel string, labels map[string]string) (bool, error) {
+	s, err := selector.Parse(sel)
+	if err != nil {
+		return false, fmt.Errorf("invalid selector '%s': %v", sel, err)
+	}
+	return s.Evaluate(labels), nil
+}
+
+// inheritLabels returns the labels of an endpoint merged with the labels of its profiles,
+// which are inherited by the endpoint.  The endpoint's own labels take precedence, followed
+// by the labels of the profiles in the order they are listed.
+func inheritLabels(labels map[string]string, profiles []api.Profile) map[string]string {
+	merged := map[string]string{}
+	for i := len(profiles) - 1; i >= 0; i-- {
+		for k, v := range profiles[i].Metadata.Labels {
+			merged[k] = v
+		}
+	}
+	for k, v := range labels {
+		merged[k] = v
+	}
+	return merged
+}
+
+// matchingPolicies returns the policies (which are in the order they are applied) whose
+// selector matches the labels.
+func matchingPolicies(policies []api.Policy, labels map[string]string) ([]api.Policy, error) {
+	matched := []api.Policy{}
+	for _, p := range policies {
+		ok, err := selectsLabels(p.Spec.Selector, labels)
+		if err != nil {
+			return nil, fmt.Errorf("policy '%s' has an %v", p.Metadata.Name, err)
+		}
+		if ok {
+			matched = append(matched, p)
+		}
+	}
+	return matched, nil
+}
+
+// getProfile returns the named profile, or nil if the profile does not exist.
+func getProfile(c *client.Client, name string) (*api.Profile, error) {
+	p, err := clientmgr.Read("get profile "+name, func() (interface{}, error) {
+		return c.Profiles().Get(api.ProfileMetadata{Name: name})
+	})
+	if _, ok := err.(calicoErrors.ErrorResourceDoesNotExist); ok {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return p.(*api.Profile), nil
+}
+
+// printStructured writes the value in the YAML or JSON output format.
+func printStructured(w io.Writer, output string, v interface{}) error {
+	var b []byte
+	var err error
+	switch output {
+	case "yaml":
+		b, err = yaml.Marshal(v)
+	case "json":
+		b, err = json.MarshalIndent(v, "", "  ")
+		b = append(b, '\n')
+	default:
+		return fmt.Errorf("unrecognized output format '%s'", output)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
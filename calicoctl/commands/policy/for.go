@@ -0,0 +1,237 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/docopt/docopt-go"
+	"github.com/projectcalico/calico-containers/calicoctl/commands/argutils"
+	"github.com/projectcalico/calico-containers/calicoctl/commands/clientmgr"
+	"github.com/projectcalico/calico-containers/calicoctl/commands/constants"
+	"github.com/projectcalico/libcalico-go/lib/api"
+	"github.com/projectcalico/libcalico-go/lib/client"
+)
+
+// appliedPolicy is a policy that applies to an endpoint.
+type appliedPolicy struct {
+	Order    string `json:"order"`
+	Name     string `json:"name"`
+	Selector string `json:"selector"`
+}
+
+// appliedProfile is a profile that an endpoint inherits.
+type appliedProfile struct {
+	Name   string   `json:"name"`
+	Exists bool     `json:"exists"`
+	Tags   []string `json:"tags,omitempty"`
+}
+
+// policiesFor is the result of the for command.
+type policiesFor struct {
+	Endpoint endpoint         `json:"endpoint"`
+	Policies []appliedPolicy  `json:"policies"`
+	Profiles []appliedProfile `json:"profiles"`
+}
+
+// For displays the policies and profiles that apply to an endpoint.
+func For(args []string) {
+	doc := constants.DatastoreIntro + `Usage:
+  calicoctl policy for (<KIND> [<NAME>] [--node=<NODE>] [--orchestrator=<ORCH>]
+                        [--workload=<WORKLOAD>] | --labels=<LABELS>)
+                       [--profiles=<PROFILES>] [--output=<OUTPUT>]
+                       [--config=<CONFIG>]
+
+Examples:
+  # Show the policies that apply to the workload endpoint "eth0" of workload
+  # "web1" on node "node1".
+  calicoctl policy for workloadendpoint eth0 --node=node1 --workload=web1
+
+  # Show the policies that would apply to an endpoint with the specified labels.
+  calicoctl policy for --labels=app=web,tier=frontend
+
+Options:
+  -h --help                    Show this screen.
+  -n --node=<NODE>             The node of the endpoint.
+     --orchestrator=<ORCH>     The orchestrator of the workload endpoint.
+     --workload=<WORKLOAD>     The workload of the workload endpoint.
+  -l --labels=<LABELS>         A comma-separated list of <key>=<value> labels of
+                               a hypothetical endpoint.
+     --profiles=<PROFILES>     A comma-separated list of the profiles of the
+                               endpoint, in order.  For an existing endpoint,
+                               this replaces the profiles of the endpoint.
+  -o --output=<OUTPUT FORMAT>  Output format.  One of: ps, yaml, json.
+                               [default: ps]
+  -c --config=<CONFIG>         Path to the file containing connection
+                               configuration in YAML or JSON format.
+                               [default: /etc/calico/calicoctl.cfg]
+
+Description:
+  The policy for command displays the policies that apply to an endpoint, in
+  the order they are applied, followed by the profiles that the endpoint
+  inherits, in the order they are applied.
+
+  The endpoint is either an existing workload endpoint or host endpoint, or a
+  hypothetical endpoint with the labels specified by --labels.  For an existing
+  endpoint, the <KIND> is workloadEndpoint or hostEndpoint (or any of the
+  other names listed by 'calicoctl api-resources') and the identifiers must
+  match exactly one endpoint.
+
+  A policy applies to an endpoint when the policy selector matches the labels
+  of the endpoint, including the labels the endpoint inherits from its
+  profiles (the endpoint's own labels take precedence).  An empty selector
+  matches every endpoint.  Policies are applied in increasing order, with policies
+  that do not specify an order applied last.  Policies with the same order are
+  applied in order of name.
+
+  Profiles are applied after policies, in the order they are listed on the
+  endpoint.
+`
+	parsedArgs, err := docopt.Parse(doc, args, true, "", false, false)
+	if err != nil {
+		fmt.Printf("Invalid option: 'calicoctl %s'. Use flag '--help' to read about a specific subcommand.\n", strings.Join(args, " "))
+		os.Exit(1)
+	}
+	if len(parsedArgs) == 0 {
+		return
+	}
+
+	output := parsedArgs["--output"].(string)
+	if output != "ps" && output != "yaml" && output != "json" {
+		fmt.Printf("unrecognized output format '%s'\n", output)
+		os.Exit(1)
+	}
+
+	cf := parsedArgs["--config"].(string)
+	c, err := clientmgr.NewClient(cf)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	ep, err := endpointFromArgs(c, parsedArgs)
+	if err != nil {
+		fmt.Printf("Error executing command: %v\n", err)
+		os.Exit(1)
+	}
+
+	result, err := getPoliciesFor(c, ep)
+	if err != nil {
+		fmt.Printf("Error executing command: %v\n", err)
+		os.Exit(1)
+	}
+
+	if output == "ps" {
+		printPoliciesFor(os.Stdout, result)
+	} else if err = printStructured(os.Stdout, output, result); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// endpointFromArgs returns the endpoint identified by the command line arguments.  This is
+// either an existing endpoint identified by <KIND> and the identifiers, or a hypothetical
+// endpoint with the labels specified by --labels.  The --profiles option overrides the
+// profiles of the endpoint.
+func endpointFromArgs(c *client.Client, args map[string]interface{}) (*endpoint, error) {
+	var ep *endpoint
+	if labels := args["--labels"]; labels != nil {
+		l, err := parseLabels(labels.(string))
+		if err != nil {
+			return nil, err
+		}
+		ep = &endpoint{Labels: l, Profiles: []string{}}
+	} else {
+		ids := map[string]string{}
+		for _, id := range []string{"<NAME>", "--node", "--orchestrator", "--workload"} {
+			ids[id] = argutils.ArgStringOrBlank(args, id)
+		}
+		var err error
+		if ep, err = getEndpoint(c, args["<KIND>"].(string), ids); err != nil {
+			return nil, err
+		}
+	}
+	if profiles := args["--profiles"]; profiles != nil {
+		ep.Profiles = parseList(profiles.(string))
+	}
+	return ep, nil
+}
+
+// getPoliciesFor returns the policies and profiles that apply to the endpoint.  The
+// policies are selected using the labels of the endpoint and the labels it inherits from
+// its profiles.
+func getPoliciesFor(c *client.Client, ep *endpoint) (*policiesFor, error) {
+	result := &policiesFor{
+		Endpoint: *ep,
+		Policies: []appliedPolicy{},
+		Profiles: []appliedProfile{},
+	}
+	profiles := []api.Profile{}
+	for _, name := range ep.Profiles {
+		p, err := getProfile(c, name)
+		if err != nil {
+			return nil, err
+		}
+		ap := appliedProfile{Name: name, Exists: p != nil}
+		if p != nil {
+			ap.Tags = p.Spec.Tags
+			profiles = append(profiles, *p)
+		}
+		result.Profiles = append(result.Profiles, ap)
+	}
+
+	policies, err := listPolicies(c)
+	if err != nil {
+		return nil, err
+	}
+	matched, err := matchingPolicies(policies, inheritLabels(ep.Labels, profiles))
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range matched {
+		result.Policies = append(result.Policies, appliedPolicy{
+			Order:    orderString(p),
+			Name:     p.Metadata.Name,
+			Selector: p.Spec.Selector,
+		})
+	}
+	return result, nil
+}
+
+// printPoliciesFor writes the policies and profiles in the ps-style output format.
+func printPoliciesFor(w io.Writer, result *policiesFor) {
+	tw := tabwriter.NewWriter(w, 5, 1, 3, ' ', 0)
+	fmt.Fprintf(tw, "ORDER\tPOLICY\tSELECTOR\t\n")
+	for _, p := range result.Policies {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t\n", p.Order, p.Name, p.Selector)
+	}
+	tw.Flush()
+
+	fmt.Fprintln(w)
+	tw = tabwriter.NewWriter(w, 5, 1, 3, ' ', 0)
+	fmt.Fprintf(tw, "PROFILE\tTAGS\t\n")
+	for _, p := range result.Profiles {
+		tags := strings.Join(p.Tags, ",")
+		if !p.Exists {
+			tags = "<profile does not exist>"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t\n", p.Name, tags)
+	}
+	tw.Flush()
+}
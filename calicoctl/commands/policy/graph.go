@@ -0,0 +1,331 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/docopt/docopt-go"
+	"github.com/projectcalico/calico-containers/calicoctl/commands/constants"
+	"github.com/projectcalico/libcalico-go/lib/api"
+)
+
+// The types of edge in the graph.
+const (
+	edgeApplies = "applies"
+	edgeAllows  = "allows"
+)
+
+// graphNode is a policy, profile or endpoint in the graph.
+type graphNode struct {
+	ID    string `json:"id"`
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Node  string `json:"node,omitempty"`
+	Order string `json:"order,omitempty"`
+}
+
+// graphEdge is either a policy or profile that applies to an endpoint, or an endpoint that
+// is allowed to send traffic to another endpoint.
+type graphEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	Type string `json:"type"`
+}
+
+// graph is the result of the graph command.
+type graph struct {
+	Nodes []graphNode `json:"nodes"`
+	Edges []graphEdge `json:"edges"`
+}
+
+// graphFilter limits the endpoints and policies included in the graph.
+type graphFilter struct {
+	node     string
+	selector string
+	policy   string
+}
+
+// Graph displays the graph of the policies and profiles that apply to each endpoint, and
+// the endpoints that are allowed to send traffic to each other.
+func Graph(args []string) {
+	doc := constants.DatastoreIntro + `Usage:
+  calicoctl graph [--node=<NODE>] [--selector=<SELECTOR>] [--policy=<NAME>]
+                  [--protocol=<PROTOCOL>] [--port=<PORT>]
+                  [--filename=<FILENAME>...] [--output=<OUTPUT>]
+                  [--config=<CONFIG>]
+
+Examples:
+  # Render the graph of all endpoints as an image using Graphviz.
+  calicoctl graph | dot -Tsvg > calico.svg
+
+  # Display the graph of the endpoints on node1 in JSON format.
+  calicoctl graph --node=node1 -o json
+
+  # Display the graph of the endpoints selected by the policy allow-db, and the
+  # endpoints allowed to connect to them on TCP port 5432.
+  calicoctl graph --policy=allow-db --port=5432
+
+Options:
+  -h --help                    Show this screen.
+  -n --node=<NODE>             Include only the endpoints on the node.
+  -s --selector=<SELECTOR>     Include only the endpoints that match the
+                               selector.
+     --policy=<NAME>           Include only the named policy and the endpoints
+                               that it selects.
+  -p --protocol=<PROTOCOL>     The protocol of the traffic used to determine
+                               whether endpoints may communicate, as a name or
+                               number.  [default: tcp]
+     --port=<PORT>             The destination port of the traffic used to
+                               determine whether endpoints may communicate.
+  -f --filename=<FILENAME>     Filename of a set of policies, profiles and
+                               endpoints to use instead of the datastore.  May
+                               be specified multiple times.
+  -o --output=<OUTPUT FORMAT>  Output format.  One of: dot, yaml, json.
+                               [default: dot]
+  -c --config=<CONFIG>         Path to the file containing connection
+                               configuration in YAML or JSON format.
+                               [default: /etc/calico/calicoctl.cfg]
+
+Description:
+  The graph command builds a graph of the workload endpoints, host endpoints,
+  policies and profiles, and displays it in Graphviz DOT format or as a list
+  of nodes and edges in YAML or JSON format.
+
+  The graph has two types of edge:
+
+    applies  From a policy or profile to each endpoint that it applies to.
+    allows   From an endpoint to each endpoint it is allowed to send traffic
+             to, as determined by the egress policy of the source and the
+             ingress policy of the destination (in the same way as 'calicoctl
+             policy simulate').
+
+  Whether endpoints may communicate is evaluated for traffic with the protocol
+  and destination port given by --protocol and --port.  Rules that match on
+  ports never match if --port is not specified.
+
+  The --node, --selector and --policy filters limit the endpoints in the
+  graph, and may be combined.  The allows edges include the endpoints that
+  pass the filters, along with any other endpoint they may communicate with.
+  With --policy, the other policies are omitted from the graph, although they
+  are still used to determine whether endpoints may communicate.
+`
+	parsedArgs, err := docopt.Parse(doc, args, true, "", false, false)
+	if err != nil {
+		fmt.Printf("Invalid option: 'calicoctl %s'. Use flag '--help' to read about a specific subcommand.\n", strings.Join(args, " "))
+		os.Exit(1)
+	}
+	if len(parsedArgs) == 0 {
+		return
+	}
+
+	output := parsedArgs["--output"].(string)
+	if output != "dot" && output != "yaml" && output != "json" {
+		fmt.Printf("unrecognized output format '%s'\n", output)
+		os.Exit(1)
+	}
+
+	pkt, err := packetFromArgs(parsedArgs)
+	if err != nil {
+		fmt.Printf("Error executing command: %v\n", err)
+		os.Exit(1)
+	}
+
+	filter := graphFilter{}
+	filter.node, _ = parsedArgs["--node"].(string)
+	filter.selector, _ = parsedArgs["--selector"].(string)
+	filter.policy, _ = parsedArgs["--policy"].(string)
+
+	model, err := loadModel(parsedArgs)
+	if err != nil {
+		fmt.Printf("Error executing command: %v\n", err)
+		os.Exit(1)
+	}
+
+	g, err := model.graph(pkt, filter)
+	if err != nil {
+		fmt.Printf("Error executing command: %v\n", err)
+		os.Exit(1)
+	}
+
+	if output == "dot" {
+		printDot(os.Stdout, g)
+	} else if err = printStructured(os.Stdout, output, g); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// graph builds the graph of the endpoints that pass the filter.  The packet is used to
+// determine whether endpoints may communicate.
+func (m *policyModel) graph(pkt *packet, filter graphFilter) (*graph, error) {
+	g := &graph{Nodes: []graphNode{}, Edges: []graphEdge{}}
+	added := map[string]bool{}
+	addNode := func(n graphNode) {
+		if !added[n.ID] {
+			added[n.ID] = true
+			g.Nodes = append(g.Nodes, n)
+		}
+	}
+
+	filterPolicy := -1
+	if filter.policy != "" {
+		for i := range m.policies {
+			if m.policies[i].Metadata.Name == filter.policy {
+				filterPolicy = i
+				break
+			}
+		}
+		if filterPolicy < 0 {
+			return nil, fmt.Errorf("policy '%s' does not exist", filter.policy)
+		}
+	}
+
+	// Determine the peer for each endpoint and the policies that apply to it once, rather
+	// than for each pair of endpoints.
+	peers := make([]*peer, len(m.endpoints))
+	endpointPolicies := make([][]api.Policy, len(m.endpoints))
+	for i := range m.endpoints {
+		peers[i] = m.newPeer(&m.endpoints[i], nil)
+		var err error
+		if endpointPolicies[i], err = matchingPolicies(m.policies, m.endpoints[i].Labels); err != nil {
+			return nil, err
+		}
+	}
+
+	// Determine the endpoints that pass the filter, along with the policies and profiles
+	// that apply to them.
+	included := make([]bool, len(m.endpoints))
+	for i := range m.endpoints {
+		ep := &m.endpoints[i]
+		if filter.node != "" && ep.Identifiers["node"] != filter.node {
+			continue
+		}
+		if filter.selector != "" {
+			ok, err := selectsLabels(filter.selector, ep.Labels)
+			if err != nil {
+				return nil, fmt.Errorf("--selector: %v", err)
+			}
+			if !ok {
+				continue
+			}
+		}
+		policies := endpointPolicies[i]
+		if filterPolicy >= 0 {
+			selected := false
+			for _, p := range policies {
+				if p.Metadata.Name == filter.policy {
+					selected = true
+					break
+				}
+			}
+			if !selected {
+				continue
+			}
+			policies = m.policies[filterPolicy : filterPolicy+1]
+		}
+
+		included[i] = true
+		epNode := endpointGraphNode(ep)
+		addNode(epNode)
+		for _, p := range policies {
+			n := graphNode{ID: "policy/" + p.Metadata.Name, Type: "policy", Name: p.Metadata.Name, Order: orderString(p)}
+			addNode(n)
+			g.Edges = append(g.Edges, graphEdge{From: n.ID, To: epNode.ID, Type: edgeApplies})
+		}
+		for _, name := range ep.Profiles {
+			n := graphNode{ID: "profile/" + name, Type: "profile", Name: name}
+			addNode(n)
+			g.Edges = append(g.Edges, graphEdge{From: n.ID, To: epNode.ID, Type: edgeApplies})
+		}
+	}
+
+	// Add an edge for each pair of endpoints that may communicate, where at least one of
+	// the endpoints passes the filter.
+	for i := range m.endpoints {
+		for j := range m.endpoints {
+			if i == j || (!included[i] && !included[j]) {
+				continue
+			}
+			// The peers are copied, since the IP addresses depend on the pair.
+			src, dst := *peers[i], *peers[j]
+			p := *pkt
+			p.Source, p.Dest = &src, &dst
+			p.Source.IP, p.Dest.IP = pickIPs(p.Source, p.Dest)
+			result, err := m.simulateWithPolicies(&p, endpointPolicies[i], endpointPolicies[j])
+			if err != nil {
+				return nil, err
+			}
+			if result.Verdict != verdictAllow {
+				continue
+			}
+			from := endpointGraphNode(&m.endpoints[i])
+			to := endpointGraphNode(&m.endpoints[j])
+			addNode(from)
+			addNode(to)
+			g.Edges = append(g.Edges, graphEdge{From: from.ID, To: to.ID, Type: edgeAllows})
+		}
+	}
+	return g, nil
+}
+
+// endpointGraphNode returns the graph node for the endpoint.  The ID includes the kind and
+// node, since endpoint names are only unique on a node.
+func endpointGraphNode(ep *modelEndpoint) graphNode {
+	name := endpointName(ep.Identifiers)
+	node := ep.Identifiers["node"]
+	return graphNode{
+		ID:   fmt.Sprintf("%s/%s/%s", ep.Kind, node, name),
+		Type: ep.Kind,
+		Name: name,
+		Node: node,
+	}
+}
+
+// printDot writes the graph in Graphviz DOT format.  Policies and profiles are drawn as
+// boxes, with dashed edges to the endpoints they apply to.
+func printDot(w io.Writer, g *graph) {
+	fmt.Fprintln(w, "digraph calico {")
+	fmt.Fprintln(w, "  rankdir=LR;")
+	for _, n := range g.Nodes {
+		label := n.Type + "\n" + n.Name
+		shape := "ellipse"
+		switch n.Type {
+		case "policy":
+			shape = "box"
+			if n.Order != "" {
+				label += "\norder " + n.Order
+			}
+		case "profile":
+			shape = "box"
+		default:
+			label += "\non " + n.Node
+		}
+		fmt.Fprintf(w, "  %s [label=%s, shape=%s];\n", strconv.Quote(n.ID), strconv.Quote(label), shape)
+	}
+	for _, e := range g.Edges {
+		style := "solid"
+		if e.Type == edgeApplies {
+			style = "dashed"
+		}
+		fmt.Fprintf(w, "  %s -> %s [label=%s, style=%s];\n",
+			strconv.Quote(e.From), strconv.Quote(e.To), strconv.Quote(e.Type), style)
+	}
+	fmt.Fprintln(w, "}")
+}
@@ -0,0 +1,578 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/docopt/docopt-go"
+	"github.com/projectcalico/calico-containers/calicoctl/commands/constants"
+	"github.com/projectcalico/libcalico-go/lib/api"
+	cnet "github.com/projectcalico/libcalico-go/lib/net"
+	"github.com/projectcalico/libcalico-go/lib/numorstring"
+)
+
+// The severities of lint issues.
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+)
+
+// The checks performed by the lint command.
+const (
+	checkShadowedRule   = "shadowed-rule"
+	checkDuplicateRule  = "duplicate-rule"
+	checkAllowAll       = "allow-all-before-deny"
+	checkUnusedPolicy   = "unused-policy"
+	checkAmbiguousOrder = "ambiguous-order"
+	checkUndefinedTag   = "undefined-tag"
+)
+
+// lintIssue is a problem found by the lint command.  Rule is the 1-based index of the
+// rule in the direction, or 0 if the issue is not specific to a rule.
+type lintIssue struct {
+	Severity  string `json:"severity"`
+	Check     string `json:"check"`
+	Kind      string `json:"kind"`
+	Name      string `json:"name"`
+	Direction string `json:"direction,omitempty"`
+	Rule      int    `json:"rule,omitempty"`
+	Message   string `json:"message"`
+}
+
+// ruleSet is the ingress or egress rules of a policy or profile.
+type ruleSet struct {
+	kind      string
+	name      string
+	direction string
+	rules     []api.Rule
+}
+
+// Lint analyzes the policies and profiles and reports any problems found.
+func Lint(args []string) {
+	doc := constants.DatastoreIntro + `Usage:
+  calicoctl policy lint [--filename=<FILENAME>...] [--output=<OUTPUT>]
+                        [--config=<CONFIG>]
+
+Examples:
+  # Analyze the policies and profiles in the datastore.
+  calicoctl policy lint
+
+  # Analyze the policies and profiles in a set of files, with JSON output.
+  calicoctl policy lint -f policies.yaml -f profiles.yaml -o json
+
+Options:
+  -h --help                    Show this screen.
+  -f --filename=<FILENAME>     Filename of a set of policies, profiles and
+                               endpoints to analyze instead of the datastore.
+                               May be specified multiple times.
+  -o --output=<OUTPUT FORMAT>  Output format.  One of: ps, yaml, json.
+                               [default: ps]
+  -c --config=<CONFIG>         Path to the file containing connection
+                               configuration in YAML or JSON format.
+                               [default: /etc/calico/calicoctl.cfg]
+
+Description:
+  The policy lint command analyzes the policies and profiles and reports the
+  following problems, each with a severity of error or warning:
+
+    shadowed-rule          A rule never matches because an earlier rule in
+                           the same policy or profile, or in an earlier policy
+                           with the same selector, matches all of the traffic
+                           it matches.  This is an error if the earlier rule
+                           has a different action, otherwise a warning.
+    duplicate-rule         A rule is identical to an earlier rule in the same
+                           policy or profile (warning).
+    allow-all-before-deny  A rule that allows all traffic is followed by deny
+                           rules in the same policy or profile, or in a later
+                           policy with the same selector, which therefore
+                           never match (error).
+    unused-policy          The selector of a policy does not match any of the
+                           current endpoints (warning).
+    ambiguous-order        Policies with the same order apply to the same
+                           endpoint, so their relative order is only
+                           determined by their names (warning).
+    undefined-tag          A rule references a tag that is not defined by
+                           any profile (warning).
+
+  The analysis of whether one rule matches all of the traffic matched by
+  another is conservative: selectors are only compared as text, so some
+  shadowed rules may not be reported.
+
+  By default the policies, profiles and endpoints are read from the datastore.
+  If one or more files are specified using --filename, the resources in the
+  files are used instead, and the datastore is not accessed.  In that case the
+  unused-policy and ambiguous-order checks use the endpoints in the files.
+
+  The command exits with status 1 if any errors are reported.
+`
+	parsedArgs, err := docopt.Parse(doc, args, true, "", false, false)
+	if err != nil {
+		fmt.Printf("Invalid option: 'calicoctl %s'. Use flag '--help' to read about a specific subcommand.\n", strings.Join(args, " "))
+		os.Exit(1)
+	}
+	if len(parsedArgs) == 0 {
+		return
+	}
+
+	output := parsedArgs["--output"].(string)
+	if output != "ps" && output != "yaml" && output != "json" {
+		fmt.Printf("unrecognized output format '%s'\n", output)
+		os.Exit(1)
+	}
+
+	model, err := loadModel(parsedArgs)
+	if err != nil {
+		fmt.Printf("Error executing command: %v\n", err)
+		os.Exit(1)
+	}
+
+	issues, err := model.lint()
+	if err != nil {
+		fmt.Printf("Error executing command: %v\n", err)
+		os.Exit(1)
+	}
+
+	if output == "ps" {
+		printLintIssues(os.Stdout, issues)
+	} else if err = printStructured(os.Stdout, output, issues); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	for _, i := range issues {
+		if i.Severity == severityError {
+			os.Exit(1)
+		}
+	}
+}
+
+// lint runs each of the checks on the model and returns the issues found.
+func (m *policyModel) lint() ([]lintIssue, error) {
+	issues := []lintIssue{}
+
+	// Determine which endpoints each policy applies to.
+	selected := make([][]bool, len(m.policies))
+	for i, p := range m.policies {
+		selected[i] = make([]bool, len(m.endpoints))
+		for j, ep := range m.endpoints {
+			ok, err := selectsLabels(p.Spec.Selector, ep.Labels)
+			if err != nil {
+				return nil, fmt.Errorf("policy '%s' has an %v", p.Metadata.Name, err)
+			}
+			selected[i][j] = ok
+		}
+	}
+
+	for _, rs := range m.ruleSets() {
+		issues = append(issues, lintRuleSet(rs)...)
+	}
+	issues = append(issues, m.lintPolicySequences()...)
+	issues = append(issues, m.lintUnusedPolicies(selected)...)
+	issues = append(issues, m.lintAmbiguousOrder(selected)...)
+	issues = append(issues, m.lintUndefinedTags()...)
+	return issues, nil
+}
+
+// ruleSets returns the ingress and egress rules of each policy, in order, followed by the
+// ingress and egress rules of each profile, in order of name.
+func (m *policyModel) ruleSets() []ruleSet {
+	sets := []ruleSet{}
+	for _, p := range m.policies {
+		sets = append(sets,
+			ruleSet{"policy", p.Metadata.Name, "ingress", p.Spec.IngressRules},
+			ruleSet{"policy", p.Metadata.Name, "egress", p.Spec.EgressRules})
+	}
+	for _, name := range m.profileNames() {
+		p := m.profiles[name]
+		sets = append(sets,
+			ruleSet{"profile", name, "ingress", p.Spec.IngressRules},
+			ruleSet{"profile", name, "egress", p.Spec.EgressRules})
+	}
+	return sets
+}
+
+// profileNames returns the names of the profiles, sorted.
+func (m *policyModel) profileNames() []string {
+	names := make([]string, 0, len(m.profiles))
+	for name := range m.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lintRuleSet reports the duplicate and shadowed rules within a set of rules, and any
+// allow all rules that are followed by deny rules.
+func lintRuleSet(rs ruleSet) []lintIssue {
+	issues := []lintIssue{}
+	newIssue := func(severity, check string, rule int, msg string) lintIssue {
+		return lintIssue{
+			Severity:  severity,
+			Check:     check,
+			Kind:      rs.kind,
+			Name:      rs.name,
+			Direction: rs.direction,
+			Rule:      rule,
+			Message:   msg,
+		}
+	}
+
+	for j := range rs.rules {
+		later := &rs.rules[j]
+		for i := 0; i < j; i++ {
+			earlier := &rs.rules[i]
+			if reflect.DeepEqual(earlier, later) {
+				issues = append(issues, newIssue(severityWarning, checkDuplicateRule, j+1,
+					fmt.Sprintf("rule is a duplicate of rule %d", i+1)))
+				break
+			}
+			if earlier.Action == "log" || (isAllowAll(earlier) && later.Action == "deny") ||
+				!ruleCovers(earlier, later) {
+				continue
+			}
+			issues = append(issues, shadowIssue(newIssue, i+1, earlier, j+1, later, ""))
+			break
+		}
+	}
+
+	for i := range rs.rules {
+		if !isAllowAll(&rs.rules[i]) {
+			continue
+		}
+		denies := []string{}
+		for j := i + 1; j < len(rs.rules); j++ {
+			if rs.rules[j].Action == "deny" {
+				denies = append(denies, fmt.Sprint(j+1))
+			}
+		}
+		if len(denies) > 0 {
+			issues = append(issues, newIssue(severityError, checkAllowAll, i+1,
+				fmt.Sprintf("rule allows all traffic, so deny rules %s never match", strings.Join(denies, ", "))))
+		}
+		break
+	}
+	return issues
+}
+
+// shadowIssue returns the issue for a rule that is shadowed by an earlier rule.  The
+// location is appended to the message to identify an earlier rule in another policy.
+func shadowIssue(newIssue func(string, string, int, string) lintIssue,
+	earlierIndex int, earlier *api.Rule, laterIndex int, later *api.Rule, location string) lintIssue {
+	if earlier.Action == later.Action {
+		return newIssue(severityWarning, checkShadowedRule, laterIndex,
+			fmt.Sprintf("rule is redundant, rule %d%s matches all of its traffic with the same action", earlierIndex, location))
+	}
+	return newIssue(severityError, checkShadowedRule, laterIndex,
+		fmt.Sprintf("rule never matches, rule %d%s matches all of its traffic and has action %s", earlierIndex, location, earlier.Action))
+}
+
+// lintPolicySequences reports rules that are shadowed by rules in an earlier policy with
+// the same selector.  Since both policies apply to exactly the same endpoints, the later
+// policy is only reached by traffic that does not match an allow or deny rule in the
+// earlier policy.
+func (m *policyModel) lintPolicySequences() []lintIssue {
+	issues := []lintIssue{}
+	for j, later := range m.policies {
+		for _, direction := range []string{"ingress", "egress"} {
+			laterRules := policyRules(later, direction)
+			reported := make([]bool, len(laterRules))
+			for i := 0; i < j; i++ {
+				earlier := m.policies[i]
+				if strings.TrimSpace(earlier.Spec.Selector) != strings.TrimSpace(later.Spec.Selector) {
+					continue
+				}
+				newIssue := func(severity, check string, rule int, msg string) lintIssue {
+					return lintIssue{
+						Severity:  severity,
+						Check:     check,
+						Kind:      "policy",
+						Name:      later.Metadata.Name,
+						Direction: direction,
+						Rule:      rule,
+						Message:   msg,
+					}
+				}
+				location := fmt.Sprintf(" of policy '%s'", earlier.Metadata.Name)
+				earlierRules := policyRules(earlier, direction)
+				for ei := range earlierRules {
+					er := &earlierRules[ei]
+					if er.Action == "log" {
+						continue
+					}
+					for li := range laterRules {
+						if reported[li] {
+							continue
+						}
+						lr := &laterRules[li]
+						if isAllowAll(er) && lr.Action == "deny" {
+							reported[li] = true
+							issues = append(issues, newIssue(severityError, checkAllowAll, li+1,
+								fmt.Sprintf("deny rule never matches, rule %d%s allows all traffic", ei+1, location)))
+						} else if ruleCovers(er, lr) {
+							reported[li] = true
+							issues = append(issues, shadowIssue(newIssue, ei+1, er, li+1, lr, location))
+						}
+					}
+				}
+			}
+		}
+	}
+	return issues
+}
+
+// policyRules returns the rules of the policy in the direction.
+func policyRules(p api.Policy, direction string) []api.Rule {
+	if direction == "ingress" {
+		return p.Spec.IngressRules
+	}
+	return p.Spec.EgressRules
+}
+
+// lintUnusedPolicies reports the policies that do not apply to any endpoint.
+func (m *policyModel) lintUnusedPolicies(selected [][]bool) []lintIssue {
+	issues := []lintIssue{}
+	for i, p := range m.policies {
+		used := false
+		for _, s := range selected[i] {
+			used = used || s
+		}
+		if !used {
+			issues = append(issues, lintIssue{
+				Severity: severityWarning,
+				Check:    checkUnusedPolicy,
+				Kind:     "policy",
+				Name:     p.Metadata.Name,
+				Message:  fmt.Sprintf("selector '%s' does not match any endpoints", p.Spec.Selector),
+			})
+		}
+	}
+	return issues
+}
+
+// lintAmbiguousOrder reports pairs of policies with the same order that apply to at least
+// one common endpoint.
+func (m *policyModel) lintAmbiguousOrder(selected [][]bool) []lintIssue {
+	issues := []lintIssue{}
+	for i := range m.policies {
+		for j := i + 1; j < len(m.policies); j++ {
+			if orderString(m.policies[i]) != orderString(m.policies[j]) {
+				continue
+			}
+			common := 0
+			for k := range m.endpoints {
+				if selected[i][k] && selected[j][k] {
+					common++
+				}
+			}
+			if common == 0 {
+				continue
+			}
+			issues = append(issues, lintIssue{
+				Severity: severityWarning,
+				Check:    checkAmbiguousOrder,
+				Kind:     "policy",
+				Name:     m.policies[j].Metadata.Name,
+				Message: fmt.Sprintf("policy has the same order (%s) as policy '%s' and both apply to %d endpoint(s), "+
+					"so '%s' is applied first only because of its name",
+					orderString(m.policies[j]), m.policies[i].Metadata.Name, common, m.policies[i].Metadata.Name),
+			})
+		}
+	}
+	return issues
+}
+
+// lintUndefinedTags reports rules that reference tags that are not defined by any profile.
+func (m *policyModel) lintUndefinedTags() []lintIssue {
+	defined := map[string]bool{}
+	for _, p := range m.profiles {
+		for _, tag := range p.Spec.Tags {
+			defined[tag] = true
+		}
+	}
+
+	issues := []lintIssue{}
+	for _, rs := range m.ruleSets() {
+		for i, r := range rs.rules {
+			for _, t := range []struct{ field, tag string }{
+				{"source tag", r.Source.Tag},
+				{"source notTag", r.Source.NotTag},
+				{"destination tag", r.Destination.Tag},
+				{"destination notTag", r.Destination.NotTag},
+			} {
+				if t.tag == "" || defined[t.tag] {
+					continue
+				}
+				issues = append(issues, lintIssue{
+					Severity:  severityWarning,
+					Check:     checkUndefinedTag,
+					Kind:      rs.kind,
+					Name:      rs.name,
+					Direction: rs.direction,
+					Rule:      i + 1,
+					Message:   fmt.Sprintf("%s '%s' is not defined by any profile", t.field, t.tag),
+				})
+			}
+		}
+	}
+	return issues
+}
+
+// isAllowAll returns true if the rule allows all traffic.
+func isAllowAll(r *api.Rule) bool {
+	return r.Action == "allow" && reflect.DeepEqual(*r, api.Rule{Action: r.Action})
+}
+
+// ruleCovers returns true if rule a matches all of the traffic matched by rule b.  This is
+// conservative, so may return false when a does cover b.
+func ruleCovers(a, b *api.Rule) bool {
+	if a.IPVersion != nil && (b.IPVersion == nil || *a.IPVersion != *b.IPVersion) {
+		return false
+	}
+	if a.Protocol != nil && (b.Protocol == nil || !sameProtocol(a.Protocol, b.Protocol)) {
+		return false
+	}
+	if a.NotProtocol != nil {
+		excluded := b.NotProtocol != nil && sameProtocol(a.NotProtocol, b.NotProtocol)
+		different := b.Protocol != nil && !sameProtocol(a.NotProtocol, b.Protocol)
+		if !excluded && !different {
+			return false
+		}
+	}
+	if a.ICMP != nil && (b.ICMP == nil || !icmpCovers(a.ICMP, b.ICMP)) {
+		return false
+	}
+	if a.NotICMP != nil && !reflect.DeepEqual(a.NotICMP, b.NotICMP) {
+		return false
+	}
+	return entityCovers(&a.Source, &b.Source) && entityCovers(&a.Destination, &b.Destination)
+}
+
+// sameProtocol returns true if the protocols are the same, allowing for the protocol to
+// be specified by name or number.
+func sameProtocol(a, b *numorstring.Protocol) bool {
+	na, oka := protocolNumber(a.String())
+	nb, okb := protocolNumber(b.String())
+	if oka && okb {
+		return na == nb
+	}
+	return strings.EqualFold(a.String(), b.String())
+}
+
+// icmpCovers returns true if the ICMP fields a match all of the ICMP traffic matched by b.
+func icmpCovers(a, b *api.ICMPFields) bool {
+	if a.Type != nil && (b.Type == nil || *a.Type != *b.Type) {
+		return false
+	}
+	return a.Code == nil || (b.Code != nil && *a.Code == *b.Code)
+}
+
+// entityCovers returns true if the source or destination criteria a match all of the
+// traffic matched by b.
+func entityCovers(a, b *api.EntityRule) bool {
+	if a.Tag != "" && a.Tag != b.Tag {
+		return false
+	}
+	if a.NotTag != "" && a.NotTag != b.NotTag {
+		return false
+	}
+	if a.Selector != "" && strings.TrimSpace(a.Selector) != strings.TrimSpace(b.Selector) {
+		return false
+	}
+	if a.NotSelector != "" && strings.TrimSpace(a.NotSelector) != strings.TrimSpace(b.NotSelector) {
+		return false
+	}
+	if a.Net != nil && (b.Net == nil || !netContains(a.Net, b.Net)) {
+		return false
+	}
+	if a.NotNet != nil {
+		excluded := b.NotNet != nil && netContains(b.NotNet, a.NotNet)
+		disjoint := b.Net != nil && !netContains(a.NotNet, b.Net) && !netContains(b.Net, a.NotNet)
+		if !excluded && !disjoint {
+			return false
+		}
+	}
+	if len(a.Ports) > 0 && (len(b.Ports) == 0 || !portsContain(a.Ports, b.Ports)) {
+		return false
+	}
+	if len(a.NotPorts) > 0 {
+		excluded := len(b.NotPorts) > 0 && portsContain(b.NotPorts, a.NotPorts)
+		disjoint := len(b.Ports) > 0 && portsDisjoint(a.NotPorts, b.Ports)
+		if !excluded && !disjoint {
+			return false
+		}
+	}
+	return true
+}
+
+// netContains returns true if the network a contains all of the network b.
+func netContains(a, b *cnet.IPNet) bool {
+	aOnes, aBits := a.Mask.Size()
+	bOnes, bBits := b.Mask.Size()
+	return aBits == bBits && aOnes <= bOnes && a.Contains(b.IP)
+}
+
+// portsContain returns true if each of the port ranges b is within one of the port ranges a.
+func portsContain(a, b []numorstring.Port) bool {
+	for _, pb := range b {
+		contained := false
+		for _, pa := range a {
+			if pb.MinPort >= pa.MinPort && pb.MaxPort <= pa.MaxPort {
+				contained = true
+				break
+			}
+		}
+		if !contained {
+			return false
+		}
+	}
+	return true
+}
+
+// portsDisjoint returns true if none of the port ranges a overlap any of the port ranges b.
+func portsDisjoint(a, b []numorstring.Port) bool {
+	for _, pa := range a {
+		for _, pb := range b {
+			if pa.MinPort <= pb.MaxPort && pb.MinPort <= pa.MaxPort {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// printLintIssues writes the issues in the ps-style output format.
+func printLintIssues(w io.Writer, issues []lintIssue) {
+	if len(issues) == 0 {
+		fmt.Fprintln(w, "No problems found")
+		return
+	}
+	tw := tabwriter.NewWriter(w, 5, 1, 3, ' ', 0)
+	fmt.Fprintf(tw, "SEVERITY\tCHECK\tRESOURCE\tRULE\tMESSAGE\t\n")
+	for _, i := range issues {
+		rule := "-"
+		if i.Rule > 0 {
+			rule = fmt.Sprintf("%s %d", i.Direction, i.Rule)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s/%s\t%s\t%s\t\n", i.Severity, i.Check, i.Kind, i.Name, rule, i.Message)
+	}
+	tw.Flush()
+}
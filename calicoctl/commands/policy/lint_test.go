@@ -0,0 +1,271 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/projectcalico/libcalico-go/lib/api"
+	cnet "github.com/projectcalico/libcalico-go/lib/net"
+	"github.com/projectcalico/libcalico-go/lib/numorstring"
+)
+
+func mustParseCIDR(s string) *cnet.IPNet {
+	_, n, err := cnet.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+func portRange(min, max uint16) numorstring.Port {
+	p, err := numorstring.PortFromRange(min, max)
+	if err != nil {
+		panic(err)
+	}
+	return p
+}
+
+var (
+	tcp   = numorstring.ProtocolFromString("tcp")
+	tcp6  = numorstring.ProtocolFromInt(6)
+	udp   = numorstring.ProtocolFromString("udp")
+	ipv4  = 4
+	ipv6  = 6
+	http  = []numorstring.Port{numorstring.SinglePort(80)}
+	https = []numorstring.Port{numorstring.SinglePort(443)}
+	web   = []numorstring.Port{numorstring.SinglePort(80), numorstring.SinglePort(443)}
+)
+
+var _ = DescribeTable("Test rule covers",
+	func(a, b api.Rule, expected bool) {
+		Expect(ruleCovers(&a, &b)).To(Equal(expected))
+	},
+	Entry("allow all covers a TCP rule",
+		api.Rule{Action: "allow"},
+		api.Rule{Action: "allow", Protocol: &tcp}, true),
+	Entry("a TCP rule does not cover allow all",
+		api.Rule{Action: "allow", Protocol: &tcp},
+		api.Rule{Action: "allow"}, false),
+	Entry("a protocol name covers the same protocol number",
+		api.Rule{Action: "deny", Protocol: &tcp},
+		api.Rule{Action: "allow", Protocol: &tcp6}, true),
+	Entry("a TCP rule does not cover a UDP rule",
+		api.Rule{Action: "deny", Protocol: &tcp},
+		api.Rule{Action: "deny", Protocol: &udp}, false),
+	Entry("a notProtocol covers a different protocol",
+		api.Rule{Action: "deny", NotProtocol: &udp},
+		api.Rule{Action: "deny", Protocol: &tcp}, true),
+	Entry("an IP version does not cover a rule for any IP version",
+		api.Rule{Action: "deny", IPVersion: &ipv4},
+		api.Rule{Action: "deny"}, false),
+	Entry("an IP version does not cover another IP version",
+		api.Rule{Action: "deny", IPVersion: &ipv4},
+		api.Rule{Action: "deny", IPVersion: &ipv6}, false),
+	Entry("a port range covers a port within it",
+		api.Rule{Action: "allow", Protocol: &tcp, Destination: api.EntityRule{Ports: []numorstring.Port{portRange(1, 1024)}}},
+		api.Rule{Action: "allow", Protocol: &tcp, Destination: api.EntityRule{Ports: http}}, true),
+	Entry("a port does not cover a port range containing it",
+		api.Rule{Action: "allow", Protocol: &tcp, Destination: api.EntityRule{Ports: http}},
+		api.Rule{Action: "allow", Protocol: &tcp, Destination: api.EntityRule{Ports: []numorstring.Port{portRange(1, 1024)}}}, false),
+	Entry("destination ports do not cover source ports",
+		api.Rule{Action: "allow", Protocol: &tcp, Destination: api.EntityRule{Ports: http}},
+		api.Rule{Action: "allow", Protocol: &tcp, Source: api.EntityRule{Ports: http}}, false),
+	Entry("a network covers a smaller network within it",
+		api.Rule{Action: "deny", Source: api.EntityRule{Net: mustParseCIDR("10.0.0.0/8")}},
+		api.Rule{Action: "deny", Source: api.EntityRule{Net: mustParseCIDR("10.1.0.0/16")}}, true),
+	Entry("a network does not cover a larger network containing it",
+		api.Rule{Action: "deny", Source: api.EntityRule{Net: mustParseCIDR("10.1.0.0/16")}},
+		api.Rule{Action: "deny", Source: api.EntityRule{Net: mustParseCIDR("10.0.0.0/8")}}, false),
+	Entry("a notNet covers a disjoint network",
+		api.Rule{Action: "deny", Source: api.EntityRule{NotNet: mustParseCIDR("10.0.0.0/8")}},
+		api.Rule{Action: "deny", Source: api.EntityRule{Net: mustParseCIDR("192.168.0.0/16")}}, true),
+	Entry("a notNet does not cover an overlapping network",
+		api.Rule{Action: "deny", Source: api.EntityRule{NotNet: mustParseCIDR("10.1.0.0/16")}},
+		api.Rule{Action: "deny", Source: api.EntityRule{Net: mustParseCIDR("10.0.0.0/8")}}, false),
+	Entry("a selector covers the same selector",
+		api.Rule{Action: "allow", Source: api.EntityRule{Selector: "role == 'db'"}},
+		api.Rule{Action: "allow", Source: api.EntityRule{Selector: " role == 'db' "}}, true),
+	Entry("a selector does not cover a different selector",
+		api.Rule{Action: "allow", Source: api.EntityRule{Selector: "role == 'db'"}},
+		api.Rule{Action: "allow", Source: api.EntityRule{Selector: "role == 'web'"}}, false),
+	Entry("a tag does not cover a rule without the tag",
+		api.Rule{Action: "allow", Source: api.EntityRule{Tag: "db"}},
+		api.Rule{Action: "allow"}, false),
+)
+
+var _ = DescribeTable("Test entity covers",
+	func(a, b api.EntityRule, expected bool) {
+		Expect(entityCovers(&a, &b)).To(Equal(expected))
+	},
+	Entry("an empty entity covers any entity",
+		api.EntityRule{},
+		api.EntityRule{Tag: "db", Ports: http}, true),
+	Entry("notPorts cover disjoint ports",
+		api.EntityRule{NotPorts: https},
+		api.EntityRule{Ports: http}, true),
+	Entry("notPorts do not cover overlapping ports",
+		api.EntityRule{NotPorts: https},
+		api.EntityRule{Ports: web}, false),
+	Entry("notPorts cover a superset of notPorts",
+		api.EntityRule{NotPorts: https},
+		api.EntityRule{NotPorts: web}, true),
+	Entry("notPorts do not cover any ports",
+		api.EntityRule{NotPorts: https},
+		api.EntityRule{}, false),
+)
+
+var _ = DescribeTable("Test ports contain",
+	func(a, b []numorstring.Port, expected bool) {
+		Expect(portsContain(a, b)).To(Equal(expected))
+	},
+	Entry("a port contains itself", http, http, true),
+	Entry("a range contains a port within it", []numorstring.Port{portRange(80, 90)}, http, true),
+	Entry("a range does not contain a port outside it", []numorstring.Port{portRange(81, 90)}, http, false),
+	Entry("a range does not contain a range that extends beyond it",
+		[]numorstring.Port{portRange(80, 90)}, []numorstring.Port{portRange(85, 95)}, false),
+	Entry("each port must be contained", http, web, false),
+	Entry("ports may be contained by different ranges", web, web, true),
+)
+
+var _ = DescribeTable("Test net contains",
+	func(a, b string, expected bool) {
+		Expect(netContains(mustParseCIDR(a), mustParseCIDR(b))).To(Equal(expected))
+	},
+	Entry("a network contains itself", "10.0.0.0/8", "10.0.0.0/8", true),
+	Entry("a network contains a smaller network within it", "10.0.0.0/8", "10.1.2.0/24", true),
+	Entry("a network does not contain a larger network", "10.1.2.0/24", "10.0.0.0/8", false),
+	Entry("a network does not contain a disjoint network", "10.0.0.0/8", "192.168.0.0/16", false),
+	Entry("an IPv4 network does not contain an IPv6 network", "0.0.0.0/0", "fd00::/8", false),
+	Entry("an IPv6 network contains a smaller IPv6 network", "fd00::/8", "fd00:1::/32", true),
+)
+
+var _ = Describe("Test lint rule set", func() {
+	lint := func(rules ...api.Rule) []lintIssue {
+		return lintRuleSet(ruleSet{kind: "policy", name: "p1", direction: "ingress", rules: rules})
+	}
+
+	It("should report a duplicate rule", func() {
+		issues := lint(
+			api.Rule{Action: "allow", Protocol: &tcp, Destination: api.EntityRule{Ports: http}},
+			api.Rule{Action: "allow", Protocol: &tcp, Destination: api.EntityRule{Ports: http}},
+		)
+		Expect(issues).To(HaveLen(1))
+		Expect(issues[0].Check).To(Equal(checkDuplicateRule))
+		Expect(issues[0].Severity).To(Equal(severityWarning))
+		Expect(issues[0].Rule).To(Equal(2))
+		Expect(issues[0].Message).To(Equal("rule is a duplicate of rule 1"))
+	})
+
+	It("should report a rule shadowed by a rule with a different action as an error", func() {
+		issues := lint(
+			api.Rule{Action: "deny", Protocol: &tcp},
+			api.Rule{Action: "allow", Protocol: &tcp, Destination: api.EntityRule{Ports: http}},
+		)
+		Expect(issues).To(HaveLen(1))
+		Expect(issues[0].Check).To(Equal(checkShadowedRule))
+		Expect(issues[0].Severity).To(Equal(severityError))
+		Expect(issues[0].Rule).To(Equal(2))
+		Expect(issues[0].Message).To(ContainSubstring("rule never matches, rule 1"))
+	})
+
+	It("should report a rule shadowed by a rule with the same action as redundant", func() {
+		issues := lint(
+			api.Rule{Action: "allow", Protocol: &tcp, Destination: api.EntityRule{Ports: web}},
+			api.Rule{Action: "allow", Protocol: &tcp, Destination: api.EntityRule{Ports: https}},
+		)
+		Expect(issues).To(HaveLen(1))
+		Expect(issues[0].Check).To(Equal(checkShadowedRule))
+		Expect(issues[0].Severity).To(Equal(severityWarning))
+		Expect(issues[0].Message).To(ContainSubstring("rule is redundant, rule 1"))
+	})
+
+	It("should not report a rule after a log rule", func() {
+		issues := lint(
+			api.Rule{Action: "log"},
+			api.Rule{Action: "deny", Protocol: &tcp},
+		)
+		Expect(issues).To(BeEmpty())
+	})
+
+	It("should not report rules that do not overlap", func() {
+		issues := lint(
+			api.Rule{Action: "allow", Protocol: &tcp, Destination: api.EntityRule{Ports: http}},
+			api.Rule{Action: "deny", Protocol: &tcp, Destination: api.EntityRule{Ports: https}},
+		)
+		Expect(issues).To(BeEmpty())
+	})
+
+	It("should report deny rules after an allow all rule", func() {
+		issues := lint(
+			api.Rule{Action: "allow"},
+			api.Rule{Action: "allow", Protocol: &udp},
+			api.Rule{Action: "deny", Protocol: &tcp},
+		)
+		Expect(issues).To(HaveLen(2))
+		Expect(issues[0].Check).To(Equal(checkShadowedRule))
+		Expect(issues[0].Rule).To(Equal(2))
+		Expect(issues[1].Check).To(Equal(checkAllowAll))
+		Expect(issues[1].Severity).To(Equal(severityError))
+		Expect(issues[1].Rule).To(Equal(1))
+		Expect(issues[1].Message).To(Equal("rule allows all traffic, so deny rules 3 never match"))
+	})
+})
+
+var _ = Describe("Test lint policy sequences", func() {
+	newPolicy := func(name string, order float64, selector string, ingress ...api.Rule) api.Policy {
+		p := api.NewPolicy()
+		p.Metadata.Name = name
+		p.Spec.Order = &order
+		p.Spec.Selector = selector
+		p.Spec.IngressRules = ingress
+		return *p
+	}
+
+	It("should report a rule shadowed by an earlier policy with the same selector", func() {
+		m := &policyModel{policies: []api.Policy{
+			newPolicy("first", 1, "role == 'db'", api.Rule{Action: "deny", Protocol: &tcp}),
+			newPolicy("second", 2, "role == 'db'", api.Rule{Action: "allow", Protocol: &tcp, Destination: api.EntityRule{Ports: http}}),
+		}}
+		issues := m.lintPolicySequences()
+		Expect(issues).To(HaveLen(1))
+		Expect(issues[0].Name).To(Equal("second"))
+		Expect(issues[0].Direction).To(Equal("ingress"))
+		Expect(issues[0].Check).To(Equal(checkShadowedRule))
+		Expect(issues[0].Severity).To(Equal(severityError))
+		Expect(issues[0].Message).To(ContainSubstring("rule 1 of policy 'first'"))
+	})
+
+	It("should report a deny rule after an allow all rule in an earlier policy", func() {
+		m := &policyModel{policies: []api.Policy{
+			newPolicy("first", 1, "role == 'db'", api.Rule{Action: "allow"}),
+			newPolicy("second", 2, "role == 'db'", api.Rule{Action: "deny", Protocol: &tcp}),
+		}}
+		issues := m.lintPolicySequences()
+		Expect(issues).To(HaveLen(1))
+		Expect(issues[0].Check).To(Equal(checkAllowAll))
+		Expect(issues[0].Message).To(Equal("deny rule never matches, rule 1 of policy 'first' allows all traffic"))
+	})
+
+	It("should not compare policies with different selectors", func() {
+		m := &policyModel{policies: []api.Policy{
+			newPolicy("first", 1, "role == 'db'", api.Rule{Action: "deny", Protocol: &tcp}),
+			newPolicy("second", 2, "role == 'web'", api.Rule{Action: "allow", Protocol: &tcp}),
+		}}
+		Expect(m.lintPolicySequences()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,246 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/projectcalico/calico-containers/calicoctl/commands/clientmgr"
+	"github.com/projectcalico/calico-containers/calicoctl/resourcemgr"
+	"github.com/projectcalico/libcalico-go/lib/api"
+)
+
+// modelEndpoint is an endpoint in the policy model, along with its interface and IP
+// addresses.  The labels of the endpoint include the labels inherited from its profiles.
+type modelEndpoint struct {
+	endpoint
+	InterfaceName string
+	IPs           []net.IP
+
+	// The endpoint's own labels, without the labels inherited from its profiles.
+	ownLabels map[string]string
+}
+
+// policyModel is the set of policies, profiles and endpoints analyzed by the policy
+// commands.  The policies are in the order they are applied.
+type policyModel struct {
+	policies  []api.Policy
+	profiles  map[string]api.Profile
+	endpoints []modelEndpoint
+}
+
+// loadModel loads the policies, profiles and endpoints from the files specified by
+// --filename, or from the datastore if no files are specified.
+func loadModel(args map[string]interface{}) (*policyModel, error) {
+	if files := args["--filename"].([]string); len(files) > 0 {
+		return loadModelFromFiles(files)
+	}
+	return loadModelFromDatastore(args["--config"].(string))
+}
+
+// loadModelFromDatastore loads the policies, profiles and endpoints from the datastore.
+func loadModelFromDatastore(cf string) (*policyModel, error) {
+	c, err := clientmgr.NewClient(cf)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &policyModel{profiles: map[string]api.Profile{}}
+	if m.policies, err = listPolicies(c); err != nil {
+		return nil, err
+	}
+
+	profiles, err := clientmgr.Read("list profiles", func() (interface{}, error) {
+		return c.Profiles().List(api.ProfileMetadata{})
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range profiles.(*api.ProfileList).Items {
+		m.profiles[p.Metadata.Name] = p
+	}
+
+	weps, err := clientmgr.Read("list workload endpoints", func() (interface{}, error) {
+		return c.WorkloadEndpoints().List(api.WorkloadEndpointMetadata{})
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, wep := range weps.(*api.WorkloadEndpointList).Items {
+		m.addWorkloadEndpoint(wep)
+	}
+
+	heps, err := clientmgr.Read("list host endpoints", func() (interface{}, error) {
+		return c.HostEndpoints().List(api.HostEndpointMetadata{})
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, hep := range heps.(*api.HostEndpointList).Items {
+		m.addHostEndpoint(hep)
+	}
+	m.inheritProfileLabels()
+	return m, nil
+}
+
+// loadModelFromFiles loads the policies, profiles and endpoints from the files.  Resources
+// of other kinds are ignored.
+func loadModelFromFiles(files []string) (*policyModel, error) {
+	m := &policyModel{profiles: map[string]api.Profile{}}
+	for _, f := range files {
+		resources, err := resourcemgr.CreateResourcesFromFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s: %v", f, err)
+		}
+		for _, r := range resources {
+			switch r := r.(type) {
+			case *api.Policy:
+				m.policies = append(m.policies, *r)
+			case *api.PolicyList:
+				m.policies = append(m.policies, r.Items...)
+			case *api.Profile:
+				m.profiles[r.Metadata.Name] = *r
+			case *api.ProfileList:
+				for _, p := range r.Items {
+					m.profiles[p.Metadata.Name] = p
+				}
+			case *api.WorkloadEndpoint:
+				m.addWorkloadEndpoint(*r)
+			case *api.WorkloadEndpointList:
+				for _, wep := range r.Items {
+					m.addWorkloadEndpoint(wep)
+				}
+			case *api.HostEndpoint:
+				m.addHostEndpoint(*r)
+			case *api.HostEndpointList:
+				for _, hep := range r.Items {
+					m.addHostEndpoint(hep)
+				}
+			}
+		}
+	}
+	sortPolicies(m.policies)
+	m.inheritProfileLabels()
+	return m, nil
+}
+
+func (m *policyModel) addWorkloadEndpoint(wep api.WorkloadEndpoint) {
+	ep := modelEndpoint{
+		endpoint: endpoint{
+			Kind: wep.Kind,
+			Identifiers: map[string]string{
+				"node":         wep.Metadata.Node,
+				"orchestrator": wep.Metadata.Orchestrator,
+				"workload":     wep.Metadata.Workload,
+				"name":         wep.Metadata.Name,
+			},
+			Labels:   wep.Metadata.Labels,
+			Profiles: wep.Spec.Profiles,
+		},
+		InterfaceName: wep.Spec.InterfaceName,
+		ownLabels:     wep.Metadata.Labels,
+	}
+	for _, n := range wep.Spec.IPNetworks {
+		ep.IPs = append(ep.IPs, n.IP)
+	}
+	m.endpoints = append(m.endpoints, ep)
+}
+
+func (m *policyModel) addHostEndpoint(hep api.HostEndpoint) {
+	ep := modelEndpoint{
+		endpoint: endpoint{
+			Kind: hep.Kind,
+			Identifiers: map[string]string{
+				"node": hep.Metadata.Node,
+				"name": hep.Metadata.Name,
+			},
+			Labels:   hep.Metadata.Labels,
+			Profiles: hep.Spec.Profiles,
+		},
+		InterfaceName: hep.Spec.InterfaceName,
+		ownLabels:     hep.Metadata.Labels,
+	}
+	for _, ip := range hep.Spec.ExpectedIPs {
+		ep.IPs = append(ep.IPs, ip.IP)
+	}
+	m.endpoints = append(m.endpoints, ep)
+}
+
+// inheritProfileLabels merges the labels of each endpoint's profiles into the endpoint's
+// own labels, so that selectors are evaluated against the same labels as in Felix.
+// Profiles that do not exist are ignored.  This may be called again after the profiles
+// or endpoints of the model are replaced.
+func (m *policyModel) inheritProfileLabels() {
+	for i := range m.endpoints {
+		ep := &m.endpoints[i]
+		profiles := []api.Profile{}
+		for _, name := range ep.Profiles {
+			if p, ok := m.profiles[name]; ok {
+				profiles = append(profiles, p)
+			}
+		}
+		ep.Labels = inheritLabels(ep.ownLabels, profiles)
+	}
+}
+
+// findEndpoint returns the endpoint identified by a reference in the form
+// <KIND>/<NAME>[,<identifier>=<value>...].  The reference must match exactly one endpoint.
+func (m *policyModel) findEndpoint(ref string) (*modelEndpoint, error) {
+	parts := strings.SplitN(ref, "/", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return nil, fmt.Errorf("invalid endpoint '%s', expecting <KIND>/<NAME>", ref)
+	}
+	ki, err := resourcemgr.LookupKind(parts[0])
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Split(parts[1], ",")
+	ids := map[string]string{"name": fields[0]}
+	for _, f := range fields[1:] {
+		kv := strings.SplitN(f, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid identifier '%s', expecting <identifier>=<value>", f)
+		}
+		ids[kv[0]] = kv[1]
+	}
+
+	var matched []*modelEndpoint
+	for i := range m.endpoints {
+		ep := &m.endpoints[i]
+		if !strings.EqualFold(ep.Kind, ki.Kind) {
+			continue
+		}
+		match := true
+		for k, v := range ids {
+			if epv, ok := ep.Identifiers[k]; !ok || epv != v {
+				match = false
+				break
+			}
+		}
+		if match {
+			matched = append(matched, ep)
+		}
+	}
+	switch len(matched) {
+	case 0:
+		return nil, fmt.Errorf("no matching %s found", ki.Kind)
+	case 1:
+		return matched[0], nil
+	}
+	return nil, fmt.Errorf("%d endpoints match '%s', specify additional identifiers "+
+		"to identify a single endpoint", len(matched), ref)
+}
@@ -0,0 +1,361 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/docopt/docopt-go"
+	"github.com/projectcalico/calico-containers/calicoctl/commands/audit"
+	"github.com/projectcalico/calico-containers/calicoctl/commands/clientmgr"
+	"github.com/projectcalico/calico-containers/calicoctl/commands/constants"
+	"github.com/projectcalico/libcalico-go/lib/api"
+	"github.com/projectcalico/libcalico-go/lib/client"
+)
+
+// orderChange is a change to the order of a policy.  A nil order indicates that the
+// policy does not specify an order.
+type orderChange struct {
+	policy   api.Policy
+	oldOrder *float64
+	newOrder *float64
+}
+
+// Move changes the order of a policy so that it is applied immediately before or after
+// another policy.
+func Move(args []string) {
+	doc := constants.DatastoreIntro + `Usage:
+  calicoctl policy move <NAME> (--before=<OTHER> | --after=<OTHER>)
+                        [--config=<CONFIG>]
+
+Examples:
+  # Apply the policy "allow-dns" immediately before the policy "deny-all".
+  calicoctl policy move allow-dns --before=deny-all
+
+Options:
+  -h --help               Show this screen.
+     --before=<OTHER>     Apply the policy immediately before this policy.
+     --after=<OTHER>      Apply the policy immediately after this policy.
+  -c --config=<CONFIG>    Path to the file containing connection configuration in
+                          YAML or JSON format.
+                          [default: /etc/calico/calicoctl.cfg]
+
+Description:
+  The policy move command sets the order of a policy so that it is applied
+  immediately before or after another policy, without changing the relative
+  order of the other policies.  Only the moved policy is updated.
+
+  The new order is chosen between the orders of the neighbouring policies so
+  that it is not the same as the order of any other policy.  If there is no
+  free order (for example when moving a policy between two policies that do
+  not specify an order), the command fails and the policies should first be
+  renumbered using 'calicoctl policy renumber'.
+`
+	parsedArgs, err := docopt.Parse(doc, args, true, "", false, false)
+	if err != nil {
+		fmt.Printf("Invalid option: 'calicoctl %s'. Use flag '--help' to read about a specific subcommand.\n", strings.Join(args, " "))
+		os.Exit(1)
+	}
+	if len(parsedArgs) == 0 {
+		return
+	}
+
+	c, ctlCfg := orderClient(parsedArgs["--config"].(string))
+	policies, err := listPolicies(c)
+	if err != nil {
+		fmt.Printf("Error executing command: %v\n", err)
+		os.Exit(1)
+	}
+
+	name := parsedArgs["<NAME>"].(string)
+	other, before := "", true
+	if v, ok := parsedArgs["--before"].(string); ok {
+		other = v
+	} else {
+		other, before = parsedArgs["--after"].(string), false
+	}
+
+	change, err := movePolicy(policies, name, other, before)
+	if err != nil {
+		fmt.Printf("Error executing command: %v\n", err)
+		os.Exit(1)
+	}
+
+	err = updatePolicyOrders(c, ctlCfg, "policy move", []orderChange{*change})
+	if err != nil {
+		fmt.Printf("Error executing command: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Moved policy %s to order %s\n", name, formatOrder(change.newOrder))
+}
+
+// Renumber rewrites the order of every policy using a fixed step, keeping the current
+// order in which the policies are applied.
+func Renumber(args []string) {
+	doc := constants.DatastoreIntro + `Usage:
+  calicoctl policy renumber [--step=<STEP>] [--config=<CONFIG>]
+
+Examples:
+  # Renumber the policies with orders 100, 200, 300 and so on.
+  calicoctl policy renumber
+
+Options:
+  -h --help               Show this screen.
+     --step=<STEP>        The difference between the orders of consecutive
+                          policies.  [default: 100]
+  -c --config=<CONFIG>    Path to the file containing connection configuration in
+                          YAML or JSON format.
+                          [default: /etc/calico/calicoctl.cfg]
+
+Description:
+  The policy renumber command sets the order of each policy to a multiple of
+  the step, in the order in which the policies are currently applied.
+  Policies that do not specify an order (which are applied last, in order of
+  name) are given an order after the other policies.
+
+  The policies are updated in a sequence that keeps the order in which the
+  policies are applied the same after each individual update.  If any update
+  fails, the policies that were already updated are restored to their previous
+  order.  The policies that are changed are listed.
+`
+	parsedArgs, err := docopt.Parse(doc, args, true, "", false, false)
+	if err != nil {
+		fmt.Printf("Invalid option: 'calicoctl %s'. Use flag '--help' to read about a specific subcommand.\n", strings.Join(args, " "))
+		os.Exit(1)
+	}
+	if len(parsedArgs) == 0 {
+		return
+	}
+
+	step, err := strconv.ParseFloat(parsedArgs["--step"].(string), 64)
+	if err != nil || step <= 0 {
+		fmt.Printf("Error executing command: invalid step '%s'\n", parsedArgs["--step"])
+		os.Exit(1)
+	}
+
+	c, ctlCfg := orderClient(parsedArgs["--config"].(string))
+	policies, err := listPolicies(c)
+	if err != nil {
+		fmt.Printf("Error executing command: %v\n", err)
+		os.Exit(1)
+	}
+
+	changes := renumberPolicies(policies, step)
+	if err = updatePolicyOrders(c, ctlCfg, "policy renumber", changes); err != nil {
+		fmt.Printf("Error executing command: %v\n", err)
+		os.Exit(1)
+	}
+	printOrderChanges(os.Stdout, changes)
+}
+
+// orderClient returns the client and the calicoctl config, exiting if updating policies
+// is not permitted by the local policy.
+func orderClient(cf string) (*client.Client, *clientmgr.CalicoctlConfig) {
+	c, err := clientmgr.NewClient(cf)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	ctlCfg, err := clientmgr.LoadCalicoctlConfig(cf)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if err = ctlCfg.Permitted("policy", "replace"); err != nil {
+		fmt.Printf("Error executing command: %v\n", err)
+		os.Exit(1)
+	}
+	return c, ctlCfg
+}
+
+// movePolicy returns the change to the order of the named policy that moves it
+// immediately before or after the other policy.  The policies are in the order they are
+// applied.
+func movePolicy(policies []api.Policy, name, other string, before bool) (*orderChange, error) {
+	if name == other {
+		return nil, errors.New("a policy cannot be moved relative to itself")
+	}
+
+	// Find the policy, and the position of the other policy once the policy is removed.
+	var moved *api.Policy
+	remaining := []api.Policy{}
+	for i := range policies {
+		if policies[i].Metadata.Name == name {
+			moved = &policies[i]
+		} else {
+			remaining = append(remaining, policies[i])
+		}
+	}
+	if moved == nil {
+		return nil, fmt.Errorf("policy '%s' does not exist", name)
+	}
+	pos := -1
+	for i := range remaining {
+		if remaining[i].Metadata.Name == other {
+			pos = i
+		}
+	}
+	if pos < 0 {
+		return nil, fmt.Errorf("policy '%s' does not exist", other)
+	}
+
+	// Determine the policies that will be immediately before and after the moved policy.
+	var prev, next *api.Policy
+	if before {
+		next = &remaining[pos]
+		if pos > 0 {
+			prev = &remaining[pos-1]
+		}
+	} else {
+		prev = &remaining[pos]
+		if pos < len(remaining)-1 {
+			next = &remaining[pos+1]
+		}
+	}
+
+	// Policies without an order are applied last, so the policy before the moved policy
+	// must have an order.  The policy after the moved policy may be without an order, in
+	// which case there is no upper bound.
+	if prev != nil && prev.Spec.Order == nil {
+		return nil, fmt.Errorf("there is no free order after policy '%s' because it does not specify "+
+			"an order, renumber the policies first", prev.Metadata.Name)
+	}
+
+	var order float64
+	switch {
+	case prev == nil && (next == nil || next.Spec.Order == nil):
+		order = 0
+	case prev == nil:
+		order = *next.Spec.Order - 1
+	case next == nil || next.Spec.Order == nil:
+		order = *prev.Spec.Order + 1
+	default:
+		lower, upper := *prev.Spec.Order, *next.Spec.Order
+		order = lower + (upper-lower)/2
+		if !(order > lower && order < upper) {
+			return nil, fmt.Errorf("there is no free order between policies '%s' and '%s', "+
+				"renumber the policies first", prev.Metadata.Name, next.Metadata.Name)
+		}
+	}
+	return &orderChange{policy: *moved, oldOrder: moved.Spec.Order, newOrder: &order}, nil
+}
+
+// renumberPolicies returns the changes that set the order of each policy to a multiple of
+// the step.  The policies are in the order they are applied.  The changes are returned in
+// the sequence in which they must be made so that the order in which the policies are
+// applied is the same after each change: first the policies whose order increases, from
+// last to first, then the policies whose order decreases, from first to last.
+func renumberPolicies(policies []api.Policy, step float64) []orderChange {
+	increases, decreases := []orderChange{}, []orderChange{}
+	for i, p := range policies {
+		order := step * float64(i+1)
+		change := orderChange{policy: p, oldOrder: p.Spec.Order, newOrder: &order}
+		switch {
+		case p.Spec.Order != nil && *p.Spec.Order == order:
+			continue
+		case p.Spec.Order != nil && *p.Spec.Order < order:
+			increases = append([]orderChange{change}, increases...)
+		default:
+			decreases = append(decreases, change)
+		}
+	}
+	return append(increases, decreases...)
+}
+
+// updatePolicyOrders makes each of the changes in sequence, and records the changes in
+// the audit log.  If a change fails, the changes already made are reverted in the reverse
+// sequence.
+func updatePolicyOrders(c *client.Client, ctlCfg *clientmgr.CalicoctlConfig, action string, changes []orderChange) error {
+	setOrder := func(p api.Policy, order *float64) (*api.Policy, error) {
+		p.Spec.Order = order
+		updated, err := clientmgr.Write("update policy "+p.Metadata.Name, func() (interface{}, error) {
+			return c.Policies().Update(&p)
+		})
+		if err != nil {
+			return nil, err
+		}
+		return updated.(*api.Policy), nil
+	}
+
+	resources := []audit.Resource{}
+	var err error
+	done := 0
+	for ; done < len(changes); done++ {
+		ch := changes[done]
+		ar := audit.Resource{
+			Kind:        ch.policy.Kind,
+			Identifiers: map[string]string{"name": ch.policy.Metadata.Name},
+			Before:      ch.policy,
+		}
+		var updated *api.Policy
+		if updated, err = setOrder(ch.policy, ch.newOrder); err != nil {
+			err = fmt.Errorf("failed to update policy '%s': %v", ch.policy.Metadata.Name, err)
+			break
+		}
+		ar.After = updated
+		resources = append(resources, ar)
+	}
+
+	if err != nil {
+		for i := done - 1; i >= 0; i-- {
+			ch := changes[i]
+			if _, rerr := setOrder(ch.policy, ch.oldOrder); rerr != nil {
+				err = fmt.Errorf("%v; failed to restore the order of policy '%s': %v", err, ch.policy.Metadata.Name, rerr)
+				continue
+			}
+			resources[i].After = ch.policy
+		}
+	}
+
+	auditLog := audit.NewLogger(ctlCfg.AuditLog)
+	numHandled := 0
+	if err == nil {
+		numHandled = len(changes)
+	}
+	if aerr := auditLog.Log(action, resources, numHandled, err); aerr != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write audit log: %v\n", aerr)
+	}
+	return err
+}
+
+// printOrderChanges writes the changes in the ps-style output format, in the order the
+// policies are applied.
+func printOrderChanges(w io.Writer, changes []orderChange) {
+	if len(changes) == 0 {
+		fmt.Fprintln(w, "The policies are already numbered")
+		return
+	}
+	sorted := make([]api.Policy, len(changes))
+	old := map[string]*float64{}
+	for i, ch := range changes {
+		sorted[i] = ch.policy
+		sorted[i].Spec.Order = ch.newOrder
+		old[ch.policy.Metadata.Name] = ch.oldOrder
+	}
+	sortPolicies(sorted)
+
+	tw := tabwriter.NewWriter(w, 5, 1, 3, ' ', 0)
+	fmt.Fprintf(tw, "POLICY\tOLD ORDER\tNEW ORDER\t\n")
+	for _, p := range sorted {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t\n", p.Metadata.Name, formatOrder(old[p.Metadata.Name]), formatOrder(p.Spec.Order))
+	}
+	tw.Flush()
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"math"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/projectcalico/libcalico-go/lib/api"
+)
+
+// orderedPolicies returns a policy for each name, with the order following the name (or
+// no order if the order is NaN).
+func orderedPolicies(namesAndOrders ...interface{}) []api.Policy {
+	policies := []api.Policy{}
+	for i := 0; i < len(namesAndOrders); i += 2 {
+		p := api.NewPolicy()
+		p.Metadata.Name = namesAndOrders[i].(string)
+		if order := namesAndOrders[i+1].(float64); !math.IsNaN(order) {
+			p.Spec.Order = &order
+		}
+		policies = append(policies, *p)
+	}
+	return policies
+}
+
+var noOrder = math.NaN()
+
+var _ = DescribeTable("Test move policy",
+	func(policies []api.Policy, name, other string, before bool, expected float64) {
+		change, err := movePolicy(policies, name, other, before)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(change.policy.Metadata.Name).To(Equal(name))
+		Expect(*change.newOrder).To(Equal(expected))
+	},
+	Entry("before a policy, halfway to the previous policy",
+		orderedPolicies("a", 1.0, "b", 2.0, "c", 3.0), "c", "b", true, 1.5),
+	Entry("after a policy, halfway to the next policy",
+		orderedPolicies("a", 1.0, "b", 2.0, "c", 3.0), "a", "b", false, 2.5),
+	Entry("before the first policy",
+		orderedPolicies("a", 1.0, "b", 2.0, "c", 3.0), "b", "a", true, 0.0),
+	Entry("after the last policy",
+		orderedPolicies("a", 1.0, "b", 2.0, "c", 3.0), "a", "c", false, 4.0),
+	Entry("before a policy without an order",
+		orderedPolicies("a", 1.0, "b", noOrder, "c", noOrder), "c", "b", true, 2.0),
+	Entry("a policy without an order",
+		orderedPolicies("a", 1.0, "b", 2.0, "c", noOrder), "c", "a", true, 0.0),
+	Entry("before the only other policy, which has no order",
+		orderedPolicies("a", noOrder, "b", noOrder), "b", "a", true, 0.0),
+)
+
+var _ = DescribeTable("Test move policy errors",
+	func(policies []api.Policy, name, other string, before bool, expected string) {
+		_, err := movePolicy(policies, name, other, before)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(ContainSubstring(expected))
+	},
+	Entry("relative to itself",
+		orderedPolicies("a", 1.0, "b", 2.0), "a", "a", true, "cannot be moved relative to itself"),
+	Entry("a policy that does not exist",
+		orderedPolicies("a", 1.0, "b", 2.0), "x", "a", true, "policy 'x' does not exist"),
+	Entry("relative to a policy that does not exist",
+		orderedPolicies("a", 1.0, "b", 2.0), "a", "x", true, "policy 'x' does not exist"),
+	Entry("after a policy without an order",
+		orderedPolicies("a", 1.0, "b", noOrder, "c", noOrder), "a", "b", false, "no free order after policy 'b'"),
+	Entry("between policies with adjacent orders",
+		orderedPolicies("a", 1.0, "b", math.Nextafter(1, 2), "c", 3.0), "c", "b", true,
+		"no free order between policies 'a' and 'b'"),
+)
+
+var _ = Describe("Test renumber policies", func() {
+	changedNames := func(changes []orderChange) []string {
+		names := []string{}
+		for _, ch := range changes {
+			names = append(names, ch.policy.Metadata.Name)
+		}
+		return names
+	}
+
+	It("should set the order of each policy to a multiple of the step", func() {
+		changes := renumberPolicies(orderedPolicies("a", 1.0, "b", 2.0, "c", noOrder), 10)
+		Expect(changes).To(HaveLen(3))
+		orders := map[string]float64{}
+		for _, ch := range changes {
+			orders[ch.policy.Metadata.Name] = *ch.newOrder
+		}
+		Expect(orders).To(Equal(map[string]float64{"a": 10, "b": 20, "c": 30}))
+	})
+
+	It("should make increases from last to first, then decreases from first to last", func() {
+		changes := renumberPolicies(orderedPolicies("a", 5.0, "b", 15.0, "c", 100.0, "d", 200.0, "e", noOrder), 10)
+		Expect(changedNames(changes)).To(Equal([]string{"b", "a", "c", "d", "e"}))
+	})
+
+	It("should record the old order of each policy", func() {
+		changes := renumberPolicies(orderedPolicies("a", 5.0, "b", noOrder), 10)
+		Expect(changes).To(HaveLen(2))
+		Expect(*changes[0].oldOrder).To(Equal(5.0))
+		Expect(changes[1].oldOrder).To(BeNil())
+	})
+
+	It("should skip policies that already have the order", func() {
+		changes := renumberPolicies(orderedPolicies("a", 10.0, "b", 15.0, "c", 30.0), 10)
+		Expect(changedNames(changes)).To(Equal([]string{"b"}))
+	})
+})
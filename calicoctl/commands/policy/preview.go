@@ -0,0 +1,284 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/docopt/docopt-go"
+	"github.com/projectcalico/calico-containers/calicoctl/commands/constants"
+	"github.com/projectcalico/calico-containers/calicoctl/resourcemgr"
+	"github.com/projectcalico/libcalico-go/lib/api"
+)
+
+// The changes to the endpoints selected by a policy.
+const (
+	changeAdded     = "added"
+	changeRemoved   = "removed"
+	changeUnchanged = "unchanged"
+)
+
+// policyPreview is the set of endpoints selected by a policy in the file, compared with
+// the endpoints selected by the stored version of the policy.
+type policyPreview struct {
+	Name           string        `json:"name"`
+	Stored         bool          `json:"stored"`
+	Selector       string        `json:"selector"`
+	StoredSelector string        `json:"storedSelector,omitempty"`
+	Added          int           `json:"added"`
+	Removed        int           `json:"removed"`
+	Unchanged      int           `json:"unchanged"`
+	Nodes          []nodePreview `json:"nodes"`
+}
+
+// nodePreview is the set of endpoints on a node whose selection by a policy is previewed.
+type nodePreview struct {
+	Node      string            `json:"node"`
+	Endpoints []previewEndpoint `json:"endpoints"`
+}
+
+// previewEndpoint is an endpoint selected by either version of a policy.
+type previewEndpoint struct {
+	Kind        string            `json:"kind"`
+	Identifiers map[string]string `json:"identifiers"`
+	Change      string            `json:"change"`
+}
+
+// Preview displays the endpoints that would be selected by each policy in a file,
+// compared with the endpoints selected by the stored policies.
+func Preview(args []string) {
+	doc := constants.DatastoreIntro + `Usage:
+  calicoctl policy preview --filename=<FILENAME> [--output=<OUTPUT>]
+                           [--config=<CONFIG>]
+
+Examples:
+  # Preview the endpoints selected by the policies in policy.yaml.
+  calicoctl policy preview -f ./policy.yaml
+
+  # Preview the endpoints selected by the policy supplied on stdin.
+  cat policy.json | calicoctl policy preview -f -
+
+Options:
+  -h --help                    Show this screen.
+  -f --filename=<FILENAME>     Filename to use to preview the policies.  If set
+                               to "-" loads from stdin.
+  -o --output=<OUTPUT FORMAT>  Output format.  One of: ps, yaml, json.
+                               [default: ps]
+  -c --config=<CONFIG>         Path to the file containing connection
+                               configuration in YAML or JSON format.
+                               [default: /etc/calico/calicoctl.cfg]
+
+Description:
+  The policy preview command lists the existing workload endpoints and host
+  endpoints that each policy in the file would select, grouped by node,
+  without modifying the datastore.
+
+  Each endpoint is compared with the endpoints selected by the currently
+  stored version of the policy (if any):
+
+    +  The endpoint is selected by the policy in the file but not by the
+       stored policy, so the policy would start applying to it.
+    -  The endpoint is selected by the stored policy but not by the policy in
+       the file, so the policy would stop applying to it.
+       The endpoint is selected by both versions of the policy.
+
+  Resources in the file that are not policies are ignored.
+`
+	parsedArgs, err := docopt.Parse(doc, args, true, "", false, false)
+	if err != nil {
+		fmt.Printf("Invalid option: 'calicoctl %s'. Use flag '--help' to read about a specific subcommand.\n", strings.Join(args, " "))
+		os.Exit(1)
+	}
+	if len(parsedArgs) == 0 {
+		return
+	}
+
+	output := parsedArgs["--output"].(string)
+	if output != "ps" && output != "yaml" && output != "json" {
+		fmt.Printf("unrecognized output format '%s'\n", output)
+		os.Exit(1)
+	}
+
+	policies, err := loadPoliciesFromFile(parsedArgs["--filename"].(string))
+	if err != nil {
+		fmt.Printf("Error executing command: %v\n", err)
+		os.Exit(1)
+	}
+
+	model, err := loadModelFromDatastore(parsedArgs["--config"].(string))
+	if err != nil {
+		fmt.Printf("Error executing command: %v\n", err)
+		os.Exit(1)
+	}
+
+	previews := []policyPreview{}
+	for _, p := range policies {
+		pp, err := model.preview(p)
+		if err != nil {
+			fmt.Printf("Error executing command: %v\n", err)
+			os.Exit(1)
+		}
+		previews = append(previews, *pp)
+	}
+
+	if output == "ps" {
+		printPreviews(os.Stdout, previews)
+	} else if err = printStructured(os.Stdout, output, previews); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// loadPoliciesFromFile returns the policies in the file, in the order they appear in the
+// file.  Resources that are not policies are ignored.
+func loadPoliciesFromFile(f string) ([]api.Policy, error) {
+	resources, err := resourcemgr.CreateResourcesFromFile(f)
+	if err != nil {
+		return nil, err
+	}
+	policies := []api.Policy{}
+	for _, r := range resources {
+		switch r := r.(type) {
+		case *api.Policy:
+			policies = append(policies, *r)
+		case *api.PolicyList:
+			policies = append(policies, r.Items...)
+		}
+	}
+	if len(policies) == 0 {
+		return nil, errors.New("the file does not contain any policies")
+	}
+	return policies, nil
+}
+
+// preview compares the endpoints selected by the policy with the endpoints selected by
+// the stored version of the policy.
+func (m *policyModel) preview(p api.Policy) (*policyPreview, error) {
+	pp := &policyPreview{
+		Name:     p.Metadata.Name,
+		Selector: p.Spec.Selector,
+		Nodes:    []nodePreview{},
+	}
+	var stored *api.Policy
+	for i := range m.policies {
+		if m.policies[i].Metadata.Name == p.Metadata.Name {
+			stored = &m.policies[i]
+			pp.Stored = true
+			pp.StoredSelector = stored.Spec.Selector
+			break
+		}
+	}
+
+	byNode := map[string][]previewEndpoint{}
+	for _, ep := range m.endpoints {
+		selected, err := selectsLabels(p.Spec.Selector, ep.Labels)
+		if err != nil {
+			return nil, fmt.Errorf("policy '%s' has an %v", p.Metadata.Name, err)
+		}
+		wasSelected := false
+		if stored != nil {
+			if wasSelected, err = selectsLabels(stored.Spec.Selector, ep.Labels); err != nil {
+				return nil, fmt.Errorf("stored policy '%s' has an %v", p.Metadata.Name, err)
+			}
+		}
+
+		pe := previewEndpoint{Kind: ep.Kind, Identifiers: ep.Identifiers}
+		switch {
+		case selected && wasSelected:
+			pe.Change = changeUnchanged
+			pp.Unchanged++
+		case selected:
+			pe.Change = changeAdded
+			pp.Added++
+		case wasSelected:
+			pe.Change = changeRemoved
+			pp.Removed++
+		default:
+			continue
+		}
+		node := ep.Identifiers["node"]
+		byNode[node] = append(byNode[node], pe)
+	}
+
+	nodes := make([]string, 0, len(byNode))
+	for node := range byNode {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	for _, node := range nodes {
+		eps := byNode[node]
+		sort.Sort(previewEndpointsByName(eps))
+		pp.Nodes = append(pp.Nodes, nodePreview{Node: node, Endpoints: eps})
+	}
+	return pp, nil
+}
+
+type previewEndpointsByName []previewEndpoint
+
+func (p previewEndpointsByName) Len() int      { return len(p) }
+func (p previewEndpointsByName) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p previewEndpointsByName) Less(i, j int) bool {
+	if p[i].Kind != p[j].Kind {
+		return p[i].Kind < p[j].Kind
+	}
+	return endpointName(p[i].Identifiers) < endpointName(p[j].Identifiers)
+}
+
+// endpointName returns the display name of an endpoint on a node: the orchestrator,
+// workload and name of a workload endpoint, or the name of a host endpoint.
+func endpointName(ids map[string]string) string {
+	parts := []string{}
+	for _, k := range []string{"orchestrator", "workload", "name"} {
+		if v, ok := ids[k]; ok {
+			parts = append(parts, v)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// printPreviews writes the previews in the ps-style output format.
+func printPreviews(w io.Writer, previews []policyPreview) {
+	for i, pp := range previews {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "Policy %s: selector %q\n", pp.Name, pp.Selector)
+		if !pp.Stored {
+			fmt.Fprintf(w, "  (new policy)\n")
+		} else if pp.StoredSelector != pp.Selector {
+			fmt.Fprintf(w, "  (stored selector %q)\n", pp.StoredSelector)
+		}
+		fmt.Fprintf(w, "  %d endpoint(s) added, %d removed, %d unchanged\n",
+			pp.Added, pp.Removed, pp.Unchanged)
+		for _, np := range pp.Nodes {
+			fmt.Fprintf(w, "\n  Node %s\n", np.Node)
+			for _, pe := range np.Endpoints {
+				marker := " "
+				switch pe.Change {
+				case changeAdded:
+					marker = "+"
+				case changeRemoved:
+					marker = "-"
+				}
+				fmt.Fprintf(w, "  %s %s %s\n", marker, pe.Kind, endpointName(pe.Identifiers))
+			}
+		}
+	}
+}
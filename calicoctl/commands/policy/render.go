@@ -0,0 +1,750 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/docopt/docopt-go"
+	"github.com/projectcalico/calico-containers/calicoctl/commands/constants"
+	"github.com/projectcalico/libcalico-go/lib/api"
+	cnet "github.com/projectcalico/libcalico-go/lib/net"
+	"github.com/projectcalico/libcalico-go/lib/numorstring"
+)
+
+// The packet marks used by the rendered rules.  A policy or profile that allows a packet
+// sets the accept mark, and a policy rule with the next-tier action sets the pass mark.
+const (
+	markAccept = "0x1000000"
+	markPass   = "0x2000000"
+)
+
+// The chain name prefixes, which match those used by Felix.
+const (
+	chainPolicyInbound   = "cali-pi-"
+	chainPolicyOutbound  = "cali-po-"
+	chainProfileInbound  = "cali-pri-"
+	chainProfileOutbound = "cali-pro-"
+	chainToWorkload      = "cali-tw-"
+	chainFromWorkload    = "cali-fw-"
+	chainToHost          = "cali-th-"
+	chainFromHost        = "cali-fh-"
+)
+
+// The maximum lengths of iptables chain names and IP set names.
+const (
+	maxChainNameLength = 28
+	maxIPSetNameLength = 31
+)
+
+// renderer renders the policies and profiles that apply to the endpoints on a node as
+// iptables rules and IP sets.
+type renderer struct {
+	model     *policyModel
+	ipVersion int
+
+	// The rendered chains and IP sets keyed off name, and the endpoints keyed off the
+	// names of their chains.
+	chains    map[string][]string
+	ipSets    map[string][]string
+	endpoints map[string]*modelEndpoint
+}
+
+// renderedSection is a part of the rendered output that is compared as a unit when
+// displaying a diff: the header of a node, an IP set, the declaration of a chain or the
+// rules of a chain.  The output is in order of key.
+type renderedSection struct {
+	key   string
+	lines []string
+}
+
+// The parts of the output for a node, in order.
+const (
+	sectionNode = iota
+	sectionIPSet
+	sectionTable
+	sectionChainDeclaration
+	sectionChain
+	sectionCommit
+)
+
+// Render displays the iptables rules and IP sets that implement the policies and profiles
+// that apply to a set of endpoints.
+func Render(args []string) {
+	doc := constants.DatastoreIntro + `Usage:
+  calicoctl policy render [--filename=<FILENAME>...] [--diff=<FILENAME>...]
+                          [--endpoint=<ENDPOINT>...] [--ip-version=<VERSION>]
+                          [--config=<CONFIG>]
+
+Examples:
+  # Render the rules for the policies, profiles and endpoints in a file.
+  calicoctl policy render -f ./policy.yaml -f ./endpoints.yaml
+
+  # Render the rules for a single workload endpoint in the datastore.
+  calicoctl policy render --endpoint=wep/eth0,workload=web1
+
+  # Show the change to the rules for the endpoints in the datastore if the
+  # policies and profiles were replaced by those in new-policy.yaml.
+  calicoctl policy render --diff=./new-policy.yaml
+
+Options:
+  -h --help                  Show this screen.
+  -f --filename=<FILENAME>   Filename of a set of policies, profiles and
+                             endpoints to render instead of the datastore.  May
+                             be specified multiple times.
+     --diff=<FILENAME>       Filename of a second set of policies and profiles
+                             (and optionally endpoints).  The difference
+                             between the rules for the two sets is displayed.
+                             May be specified multiple times.
+     --endpoint=<ENDPOINT>   Render only the rules for the endpoint, in the form
+                             <KIND>/<NAME>[,<identifier>=<value>...].  May be
+                             specified multiple times.
+     --ip-version=<VERSION>  The IP version of the rules.  One of: 4, 6.
+                             [default: 4]
+  -c --config=<CONFIG>       Path to the file containing connection
+                             configuration in YAML or JSON format.
+                             [default: /etc/calico/calicoctl.cfg]
+
+Description:
+  The policy render command displays the iptables rules and IP sets that
+  implement the policies and profiles that apply to a set of endpoints,
+  without a running Felix.  The IP sets are displayed in ipset save format,
+  followed by the iptables rules in iptables-save format.
+
+  By default the policies, profiles and endpoints are read from the datastore.
+  If one or more files are specified using --filename, the resources in the
+  files are used instead, and the datastore is not accessed.
+
+  The rules for every endpoint are rendered, unless specific endpoints are
+  selected using --endpoint (in the form used by 'calicoctl policy simulate').
+  The rules are rendered separately for each node, as they would be by the
+  Felix on that node, with the rules for each node preceded by a comment
+  naming the node.  Endpoints on the same node must have different interfaces.
+  Each endpoint has a chain for traffic to and from the endpoint which jumps
+  to a chain for each policy that applies to the endpoint, in order, followed
+  by a chain for each profile of the endpoint, and then drops the traffic.
+  A policy or profile chain marks the traffic it allows and returns.  The
+  chain and IP set names follow the naming scheme used by Felix, with long
+  names shortened using a hash.
+
+  With --diff, the rules are rendered for a second set of resources, in which
+  the policies are replaced by those in the --diff files.  The profiles and
+  endpoints are also replaced if the --diff files contain any profiles or any
+  endpoints respectively.  The labels that the endpoints inherit from their
+  profiles are those of the replaced profiles.  The difference between the
+  two renderings is displayed in unified diff format.
+  Each IP set and chain is compared separately, so a change within one chain
+  is never matched against the rules of another.
+`
+	parsedArgs, err := docopt.Parse(doc, args, true, "", false, false)
+	if err != nil {
+		fmt.Printf("Invalid option: 'calicoctl %s'. Use flag '--help' to read about a specific subcommand.\n", strings.Join(args, " "))
+		os.Exit(1)
+	}
+	if len(parsedArgs) == 0 {
+		return
+	}
+
+	var ipVersion int
+	switch v := parsedArgs["--ip-version"].(string); v {
+	case "4":
+		ipVersion = 4
+	case "6":
+		ipVersion = 6
+	default:
+		fmt.Printf("Error executing command: invalid IP version '%s'\n", v)
+		os.Exit(1)
+	}
+
+	model, err := loadModel(parsedArgs)
+	if err != nil {
+		fmt.Printf("Error executing command: %v\n", err)
+		os.Exit(1)
+	}
+	endpointRefs := parsedArgs["--endpoint"].([]string)
+	sections, err := renderModel(model, endpointRefs, ipVersion)
+	if err != nil {
+		fmt.Printf("Error executing command: %v\n", err)
+		os.Exit(1)
+	}
+
+	diffFiles := parsedArgs["--diff"].([]string)
+	if len(diffFiles) == 0 {
+		for _, s := range sections {
+			for _, l := range s.lines {
+				fmt.Println(l)
+			}
+		}
+		return
+	}
+
+	other, err := loadModelFromFiles(diffFiles)
+	if err != nil {
+		fmt.Printf("Error executing command: %v\n", err)
+		os.Exit(1)
+	}
+	other.fillFrom(model)
+	otherSections, err := renderModel(other, endpointRefs, ipVersion)
+	if err != nil {
+		fmt.Printf("Error executing command: %v\n", err)
+		os.Exit(1)
+	}
+	printUnifiedDiff(os.Stdout, "current", "proposed", diffSections(sections, otherSections))
+}
+
+// fillFrom uses the profiles and endpoints of the current model for a --diff model that
+// has no profiles or no endpoints, and re-evaluates the labels that the endpoints inherit
+// from the profiles of the --diff model.
+func (m *policyModel) fillFrom(current *policyModel) {
+	if len(m.profiles) == 0 {
+		m.profiles = current.profiles
+	}
+	if len(m.endpoints) == 0 {
+		m.endpoints = append([]modelEndpoint(nil), current.endpoints...)
+	}
+	m.inheritProfileLabels()
+}
+
+// renderModel returns the IP sets and iptables rules for the referenced endpoints (or all
+// endpoints if there are no references), rendered separately for each node.
+func renderModel(m *policyModel, refs []string, ipVersion int) ([]renderedSection, error) {
+	endpoints := []*modelEndpoint{}
+	if len(refs) == 0 {
+		for i := range m.endpoints {
+			endpoints = append(endpoints, &m.endpoints[i])
+		}
+	}
+	for _, ref := range refs {
+		ep, err := m.findEndpoint(ref)
+		if err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, ep)
+	}
+
+	renderers := map[string]*renderer{}
+	nodes := []string{}
+	for _, ep := range endpoints {
+		node := ep.Identifiers["node"]
+		r, ok := renderers[node]
+		if !ok {
+			r = &renderer{
+				model:     m,
+				ipVersion: ipVersion,
+				chains:    map[string][]string{},
+				ipSets:    map[string][]string{},
+				endpoints: map[string]*modelEndpoint{},
+			}
+			renderers[node] = r
+			nodes = append(nodes, node)
+		}
+		if err := r.renderEndpoint(ep); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(nodes)
+	sections := []renderedSection{}
+	for _, node := range nodes {
+		sections = append(sections, renderers[node].sections(node)...)
+	}
+	return sections, nil
+}
+
+// sections returns the IP sets in ipset save format followed by the chains in
+// iptables-save format, preceded by a comment naming the node (if known).
+func (r *renderer) sections(node string) []renderedSection {
+	key := func(part int, name string) string {
+		return fmt.Sprintf("%s\x00%d\x00%s", node, part, name)
+	}
+	sections := []renderedSection{}
+	if node != "" {
+		sections = append(sections, renderedSection{key(sectionNode, ""), []string{"# Node: " + node}})
+	}
+
+	family := "inet"
+	if r.ipVersion == 6 {
+		family = "inet6"
+	}
+	for _, name := range sortedKeys(r.ipSets) {
+		lines := []string{fmt.Sprintf("create %s hash:ip family %s", name, family)}
+		for _, member := range r.ipSets[name] {
+			lines = append(lines, fmt.Sprintf("add %s %s", name, member))
+		}
+		sections = append(sections, renderedSection{key(sectionIPSet, name), lines})
+	}
+
+	sections = append(sections, renderedSection{key(sectionTable, ""), []string{"*filter"}})
+	chains := sortedKeys(r.chains)
+	for _, name := range chains {
+		sections = append(sections, renderedSection{key(sectionChainDeclaration, name), []string{fmt.Sprintf(":%s - [0:0]", name)}})
+	}
+	for _, name := range chains {
+		sections = append(sections, renderedSection{key(sectionChain, name), r.chains[name]})
+	}
+	return append(sections, renderedSection{key(sectionCommit, ""), []string{"COMMIT"}})
+}
+
+// sortedKeys returns the keys of the map, sorted.
+func sortedKeys(m map[string][]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// renderEndpoint renders the chains for traffic to and from the endpoint, along with the
+// chains of the policies and profiles that apply to the endpoint.  Returns an error if
+// another endpoint on the node has the same chains.
+func (r *renderer) renderEndpoint(ep *modelEndpoint) error {
+	iface := ep.InterfaceName
+	if iface == "" {
+		iface = ep.Identifiers["name"]
+	}
+	toPrefix, fromPrefix := chainToWorkload, chainFromWorkload
+	if ep.Kind == "hostEndpoint" {
+		toPrefix, fromPrefix = chainToHost, chainFromHost
+	}
+
+	// An endpoint referenced more than once is only rendered once.
+	toChain := chainName(toPrefix, iface)
+	if other, ok := r.endpoints[toChain]; ok {
+		if other == ep {
+			return nil
+		}
+		return fmt.Errorf("%s %s and %s %s on node '%s' have the same interface '%s'",
+			other.Kind, endpointName(other.Identifiers), ep.Kind, endpointName(ep.Identifiers),
+			ep.Identifiers["node"], iface)
+	}
+	r.endpoints[toChain] = ep
+
+	policies, err := matchingPolicies(r.model.policies, ep.Labels)
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range []struct {
+		chain, policyPrefix, profilePrefix string
+		inbound                            bool
+	}{
+		{toChain, chainPolicyInbound, chainProfileInbound, true},
+		{chainName(fromPrefix, iface), chainPolicyOutbound, chainProfileOutbound, false},
+	} {
+		rules := []string{
+			fmt.Sprintf("-A %s -j MARK --set-xmark 0x0/%s", dir.chain, markAccept),
+			fmt.Sprintf("-A %s -j MARK --set-xmark 0x0/%s", dir.chain, markPass),
+		}
+		for _, p := range policies {
+			target := chainName(dir.policyPrefix, p.Metadata.Name)
+			policyRules := p.Spec.EgressRules
+			if dir.inbound {
+				policyRules = p.Spec.IngressRules
+			}
+			if err := r.renderRuleChain(target, policyRules); err != nil {
+				return fmt.Errorf("policy '%s': %v", p.Metadata.Name, err)
+			}
+			rules = append(rules,
+				fmt.Sprintf("-A %s -m mark --mark 0x0/%s -j %s", dir.chain, markPass, target),
+				fmt.Sprintf("-A %s -m mark --mark %s/%s -j RETURN", dir.chain, markAccept, markAccept))
+		}
+		for _, name := range ep.Profiles {
+			prof, ok := r.model.profiles[name]
+			if !ok {
+				continue
+			}
+			target := chainName(dir.profilePrefix, name)
+			profileRules := prof.Spec.EgressRules
+			if dir.inbound {
+				profileRules = prof.Spec.IngressRules
+			}
+			if err := r.renderRuleChain(target, profileRules); err != nil {
+				return fmt.Errorf("profile '%s': %v", name, err)
+			}
+			rules = append(rules,
+				fmt.Sprintf("-A %s -j %s", dir.chain, target),
+				fmt.Sprintf("-A %s -m mark --mark %s/%s -j RETURN", dir.chain, markAccept, markAccept))
+		}
+		rules = append(rules, fmt.Sprintf("-A %s -j DROP", dir.chain))
+		r.chains[dir.chain] = rules
+	}
+	return nil
+}
+
+// renderRuleChain renders the chain for the rules of a policy or profile.  Rules for the
+// other IP version are omitted.
+func (r *renderer) renderRuleChain(chain string, rules []api.Rule) error {
+	if _, ok := r.chains[chain]; ok {
+		return nil
+	}
+	lines := []string{}
+	for i := range rules {
+		matches, ok, err := r.ruleMatches(&rules[i])
+		if err != nil {
+			return fmt.Errorf("rule %d: %v", i+1, err)
+		}
+		if !ok {
+			continue
+		}
+		prefix := fmt.Sprintf("-A %s%s", chain, matches)
+		switch rules[i].Action {
+		case "allow":
+			lines = append(lines,
+				fmt.Sprintf("%s -j MARK --set-xmark %s/%s", prefix, markAccept, markAccept),
+				fmt.Sprintf("-A %s -m mark --mark %s/%s -j RETURN", chain, markAccept, markAccept))
+		case "deny":
+			lines = append(lines, prefix+" -j DROP")
+		case "log":
+			lines = append(lines, prefix+" -j LOG --log-prefix calico-packet --log-level 5")
+		case "next-tier":
+			lines = append(lines,
+				fmt.Sprintf("%s -j MARK --set-xmark %s/%s", prefix, markPass, markPass),
+				fmt.Sprintf("-A %s -m mark --mark %s/%s -j RETURN", chain, markPass, markPass))
+		default:
+			return fmt.Errorf("rule %d: unsupported action '%s'", i+1, rules[i].Action)
+		}
+	}
+	r.chains[chain] = lines
+	return nil
+}
+
+// ruleMatches returns the iptables match criteria for the rule.  Returns false if the
+// rule does not apply to the IP version being rendered.
+func (r *renderer) ruleMatches(rule *api.Rule) (string, bool, error) {
+	if rule.IPVersion != nil && *rule.IPVersion != r.ipVersion {
+		return "", false, nil
+	}
+	for _, n := range []*cnet.IPNet{rule.Source.Net, rule.Source.NotNet, rule.Destination.Net, rule.Destination.NotNet} {
+		if n != nil && ipVersion(n.IP) != r.ipVersion {
+			return "", false, nil
+		}
+	}
+
+	m := []string{}
+	if rule.Protocol != nil {
+		m = append(m, "-p "+rule.Protocol.String())
+	}
+	if rule.NotProtocol != nil {
+		m = append(m, "! -p "+rule.NotProtocol.String())
+	}
+	if rule.ICMP != nil && rule.ICMP.Type != nil {
+		m = append(m, r.icmpMatch("", rule.ICMP))
+	}
+	if rule.NotICMP != nil && rule.NotICMP.Type != nil {
+		m = append(m, r.icmpMatch("! ", rule.NotICMP))
+	}
+
+	for _, e := range []struct {
+		entity    *api.EntityRule
+		dir, flag string
+	}{
+		{&rule.Source, "src", "source"},
+		{&rule.Destination, "dst", "destination"},
+	} {
+		if e.entity.Net != nil {
+			m = append(m, fmt.Sprintf("--%s %s", e.flag, e.entity.Net.String()))
+		}
+		if e.entity.NotNet != nil {
+			m = append(m, fmt.Sprintf("! --%s %s", e.flag, e.entity.NotNet.String()))
+		}
+		if e.entity.Tag != "" {
+			m = append(m, fmt.Sprintf("-m set --match-set %s %s", r.tagIPSet(e.entity.Tag), e.dir))
+		}
+		if e.entity.NotTag != "" {
+			m = append(m, fmt.Sprintf("-m set ! --match-set %s %s", r.tagIPSet(e.entity.NotTag), e.dir))
+		}
+		if e.entity.Selector != "" {
+			name, err := r.selectorIPSet(e.entity.Selector)
+			if err != nil {
+				return "", false, err
+			}
+			m = append(m, fmt.Sprintf("-m set --match-set %s %s", name, e.dir))
+		}
+		if e.entity.NotSelector != "" {
+			name, err := r.selectorIPSet(e.entity.NotSelector)
+			if err != nil {
+				return "", false, err
+			}
+			m = append(m, fmt.Sprintf("-m set ! --match-set %s %s", name, e.dir))
+		}
+		if len(e.entity.Ports) > 0 {
+			m = append(m, fmt.Sprintf("-m multiport --%s-ports %s", e.flag, portList(e.entity.Ports)))
+		}
+		if len(e.entity.NotPorts) > 0 {
+			m = append(m, fmt.Sprintf("-m multiport ! --%s-ports %s", e.flag, portList(e.entity.NotPorts)))
+		}
+	}
+	if len(m) == 0 {
+		return "", true, nil
+	}
+	return " " + strings.Join(m, " "), true, nil
+}
+
+// icmpMatch returns the iptables match for the ICMP type and code.
+func (r *renderer) icmpMatch(negate string, icmp *api.ICMPFields) string {
+	t := fmt.Sprint(*icmp.Type)
+	if icmp.Code != nil {
+		t = fmt.Sprintf("%d/%d", *icmp.Type, *icmp.Code)
+	}
+	if r.ipVersion == 6 {
+		return fmt.Sprintf("-m icmp6 %s--icmpv6-type %s", negate, t)
+	}
+	return fmt.Sprintf("-m icmp %s--icmp-type %s", negate, t)
+}
+
+// portList returns the ports in the format used by the multiport match.
+func portList(ports []numorstring.Port) string {
+	s := make([]string, len(ports))
+	for i, p := range ports {
+		if p.MinPort == p.MaxPort {
+			s[i] = fmt.Sprint(p.MinPort)
+		} else {
+			s[i] = fmt.Sprintf("%d:%d", p.MinPort, p.MaxPort)
+		}
+	}
+	return strings.Join(s, ",")
+}
+
+// selectorIPSet returns the name of the IP set containing the IP addresses of the
+// endpoints that match the selector, rendering the IP set if required.
+func (r *renderer) selectorIPSet(sel string) (string, error) {
+	name := r.ipSetName("s:", sel)
+	if _, ok := r.ipSets[name]; ok {
+		return name, nil
+	}
+	members := []net.IP{}
+	for _, ep := range r.model.endpoints {
+		ok, err := selectsLabels(sel, ep.Labels)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			members = append(members, ep.IPs...)
+		}
+	}
+	r.ipSets[name] = r.ipSetMembers(members)
+	return name, nil
+}
+
+// tagIPSet returns the name of the IP set containing the IP addresses of the endpoints
+// with a profile that has the tag, rendering the IP set if required.
+func (r *renderer) tagIPSet(tag string) string {
+	name := r.ipSetName("t:", tag)
+	if _, ok := r.ipSets[name]; ok {
+		return name
+	}
+	members := []net.IP{}
+	for _, ep := range r.model.endpoints {
+		for _, p := range ep.Profiles {
+			if hasTag(r.model.profiles[p].Spec.Tags, tag) {
+				members = append(members, ep.IPs...)
+				break
+			}
+		}
+	}
+	r.ipSets[name] = r.ipSetMembers(members)
+	return name
+}
+
+// hasTag returns true if the tag is in the list of tags.
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// ipSetMembers returns the sorted, unique addresses of the IP version being rendered.
+func (r *renderer) ipSetMembers(ips []net.IP) []string {
+	seen := map[string]bool{}
+	members := []string{}
+	for _, ip := range ips {
+		if ipVersion(ip) != r.ipVersion || seen[ip.String()] {
+			continue
+		}
+		seen[ip.String()] = true
+		members = append(members, ip.String())
+	}
+	sort.Strings(members)
+	return members
+}
+
+// ipSetName returns the name of the IP set for the selector or tag.  The name includes
+// a hash of the selector or tag, since IP set names are limited in length.
+func (r *renderer) ipSetName(prefix, value string) string {
+	return limitLength(fmt.Sprintf("cali%d-%s", r.ipVersion, prefix), value, maxIPSetNameLength, true)
+}
+
+// chainName returns the name of the chain with the prefix for the policy, profile or
+// interface name.  Names that would be too long are shortened using a hash.
+func chainName(prefix, name string) string {
+	return limitLength(prefix, name, maxChainNameLength, false)
+}
+
+// limitLength returns the prefix followed by the value, or a hash of the value if the
+// result would be longer than the maximum length or if always hashing.
+func limitLength(prefix, value string, max int, alwaysHash bool) string {
+	if !alwaysHash && len(prefix)+len(value) <= max {
+		return prefix + value
+	}
+	sum := sha256.Sum256([]byte(value))
+	hash := base64.RawURLEncoding.EncodeToString(sum[:])
+	return prefix + hash[:max-len(prefix)]
+}
+
+// diffEdit is a line of a diff, prefixed with ' ', '-' or '+', along with the indices of
+// the line in the old and new output.
+type diffEdit struct {
+	op   byte
+	line string
+	ai   int
+	bi   int
+}
+
+// diffSections returns the edit script that transforms the sections a into the sections
+// b.  Only sections with the same key are compared line by line, so the memory used is
+// bounded by the size of the largest section rather than the size of the output.
+func diffSections(a, b []renderedSection) []diffEdit {
+	edits := []diffEdit{}
+	ai, bi := 0, 0
+	for i, j := 0, 0; i < len(a) || j < len(b); {
+		switch {
+		case j == len(b) || (i < len(a) && a[i].key < b[j].key):
+			for _, l := range a[i].lines {
+				edits = append(edits, diffEdit{'-', l, ai, bi})
+				ai++
+			}
+			i++
+		case i == len(a) || b[j].key < a[i].key:
+			for _, l := range b[j].lines {
+				edits = append(edits, diffEdit{'+', l, ai, bi})
+				bi++
+			}
+			j++
+		default:
+			edits = append(edits, diffLines(a[i].lines, b[j].lines, ai, bi)...)
+			ai += len(a[i].lines)
+			bi += len(b[j].lines)
+			i++
+			j++
+		}
+	}
+	return edits
+}
+
+// diffLines returns the edit script that transforms the lines a into the lines b, using
+// the longest common subsequence of the lines.  The lines start at the indices ai and bi
+// of the output.
+func diffLines(a, b []string, ai, bi int) []diffEdit {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	edits := []diffEdit{}
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			edits = append(edits, diffEdit{' ', a[i], ai + i, bi + j})
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			edits = append(edits, diffEdit{'-', a[i], ai + i, bi + j})
+			i++
+		default:
+			edits = append(edits, diffEdit{'+', b[j], ai + i, bi + j})
+			j++
+		}
+	}
+	return edits
+}
+
+// printUnifiedDiff writes the edit script in unified diff format, with three lines of
+// context.
+func printUnifiedDiff(w io.Writer, fromName, toName string, edits []diffEdit) {
+	const context = 3
+	fmt.Fprintf(w, "--- %s\n+++ %s\n", fromName, toName)
+	for start := 0; start < len(edits); {
+		// Find the next change.
+		for start < len(edits) && edits[start].op == ' ' {
+			start++
+		}
+		if start == len(edits) {
+			break
+		}
+
+		// Extend the hunk until there are more than 2*context unchanged lines.
+		first := start - context
+		if first < 0 {
+			first = 0
+		}
+		end := start
+		for end < len(edits) {
+			if edits[end].op != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(edits) && edits[run].op == ' ' {
+				run++
+			}
+			if run == len(edits) || run-end > 2*context {
+				break
+			}
+			end = run
+		}
+		last := end + context
+		if last > len(edits) {
+			last = len(edits)
+		}
+
+		aCount, bCount := 0, 0
+		for _, e := range edits[first:last] {
+			if e.op != '+' {
+				aCount++
+			}
+			if e.op != '-' {
+				bCount++
+			}
+		}
+		fmt.Fprintf(w, "@@ -%d,%d +%d,%d @@\n", edits[first].ai+1, aCount, edits[first].bi+1, bCount)
+		for _, e := range edits[first:last] {
+			fmt.Fprintf(w, "%c%s\n", e.op, e.line)
+		}
+		start = last
+	}
+}
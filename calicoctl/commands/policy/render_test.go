@@ -0,0 +1,189 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"bytes"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/projectcalico/libcalico-go/lib/api"
+)
+
+// workloadOnNode returns a workload endpoint on the node with the interface.
+func workloadOnNode(node, workload, iface string) modelEndpoint {
+	return modelEndpoint{
+		endpoint: endpoint{
+			Kind: "workloadEndpoint",
+			Identifiers: map[string]string{
+				"node":         node,
+				"orchestrator": "k8s",
+				"workload":     workload,
+				"name":         "eth0",
+			},
+		},
+		InterfaceName: iface,
+	}
+}
+
+// sectionLines returns the lines of the sections.
+func sectionLines(sections []renderedSection) []string {
+	lines := []string{}
+	for _, s := range sections {
+		lines = append(lines, s.lines...)
+	}
+	return lines
+}
+
+var _ = Describe("Test render policy", func() {
+	It("should render endpoints with the same interface on different nodes separately", func() {
+		m := &policyModel{endpoints: []modelEndpoint{
+			workloadOnNode("node2", "web", "cali1234"),
+			workloadOnNode("node1", "db", "cali1234"),
+		}}
+		sections, err := renderModel(m, nil, 4)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(sectionLines(sections)).To(Equal([]string{
+			"# Node: node1",
+			"*filter",
+			":cali-fw-cali1234 - [0:0]",
+			":cali-tw-cali1234 - [0:0]",
+			"-A cali-fw-cali1234 -j MARK --set-xmark 0x0/0x1000000",
+			"-A cali-fw-cali1234 -j MARK --set-xmark 0x0/0x2000000",
+			"-A cali-fw-cali1234 -j DROP",
+			"-A cali-tw-cali1234 -j MARK --set-xmark 0x0/0x1000000",
+			"-A cali-tw-cali1234 -j MARK --set-xmark 0x0/0x2000000",
+			"-A cali-tw-cali1234 -j DROP",
+			"COMMIT",
+			"# Node: node2",
+			"*filter",
+			":cali-fw-cali1234 - [0:0]",
+			":cali-tw-cali1234 - [0:0]",
+			"-A cali-fw-cali1234 -j MARK --set-xmark 0x0/0x1000000",
+			"-A cali-fw-cali1234 -j MARK --set-xmark 0x0/0x2000000",
+			"-A cali-fw-cali1234 -j DROP",
+			"-A cali-tw-cali1234 -j MARK --set-xmark 0x0/0x1000000",
+			"-A cali-tw-cali1234 -j MARK --set-xmark 0x0/0x2000000",
+			"-A cali-tw-cali1234 -j DROP",
+			"COMMIT",
+		}))
+	})
+
+	It("should fail if endpoints on the same node have the same interface", func() {
+		m := &policyModel{endpoints: []modelEndpoint{
+			workloadOnNode("node1", "web", "cali1234"),
+			workloadOnNode("node1", "db", "cali1234"),
+		}}
+		_, err := renderModel(m, nil, 4)
+		Expect(err).To(HaveOccurred())
+		Expect(err.Error()).To(Equal("workloadEndpoint k8s/web/eth0 and workloadEndpoint k8s/db/eth0 " +
+			"on node 'node1' have the same interface 'cali1234'"))
+	})
+})
+
+var _ = Describe("Test render policy diff", func() {
+	// labelledProfile returns a profile with the labels.
+	labelledProfile := func(name string, labels map[string]string) api.Profile {
+		p := api.NewProfile()
+		p.Metadata.Name = name
+		p.Metadata.Labels = labels
+		return *p
+	}
+
+	It("should apply the labels of the proposed profiles to the current endpoints", func() {
+		policy := api.NewPolicy()
+		policy.Metadata.Name = "db"
+		policy.Spec.Selector = "role == 'db'"
+		policy.Spec.IngressRules = []api.Rule{{Action: "allow"}}
+
+		ep := workloadOnNode("node1", "db", "cali1234")
+		ep.Profiles = []string{"db"}
+		ep.ownLabels = map[string]string{"app": "db"}
+		current := &policyModel{
+			policies:  []api.Policy{*policy},
+			profiles:  map[string]api.Profile{"db": labelledProfile("db", map[string]string{"role": "web"})},
+			endpoints: []modelEndpoint{ep},
+		}
+		current.inheritProfileLabels()
+
+		// The proposed resources contain only a change to the profile labels.
+		proposed := &policyModel{
+			policies: []api.Policy{*policy},
+			profiles: map[string]api.Profile{"db": labelledProfile("db", map[string]string{"role": "db"})},
+		}
+		proposed.fillFrom(current)
+		Expect(proposed.endpoints[0].Labels).To(Equal(map[string]string{"app": "db", "role": "db"}))
+		Expect(current.endpoints[0].Labels).To(Equal(map[string]string{"app": "db", "role": "web"}))
+
+		a, err := renderModel(current, nil, 4)
+		Expect(err).NotTo(HaveOccurred())
+		b, err := renderModel(proposed, nil, 4)
+		Expect(err).NotTo(HaveOccurred())
+		var buf bytes.Buffer
+		printUnifiedDiff(&buf, "current", "proposed", diffSections(a, b))
+		diff := strings.Split(buf.String(), "\n")
+		Expect(diff).To(ContainElement("+-A cali-tw-cali1234 -m mark --mark 0x0/0x2000000 -j cali-pi-db"))
+		Expect(diff).To(ContainElement("+:cali-pi-db - [0:0]"))
+		removed := []string{}
+		for _, l := range diff {
+			if strings.HasPrefix(l, "-") && !strings.HasPrefix(l, "---") {
+				removed = append(removed, l)
+			}
+		}
+		Expect(removed).To(BeEmpty())
+	})
+
+	It("should use the current profiles if the proposed resources have none", func() {
+		ep := workloadOnNode("node1", "db", "cali1234")
+		ep.Profiles = []string{"db"}
+		current := &policyModel{
+			profiles:  map[string]api.Profile{"db": labelledProfile("db", map[string]string{"role": "db"})},
+			endpoints: []modelEndpoint{ep},
+		}
+		current.inheritProfileLabels()
+
+		proposed := &policyModel{profiles: map[string]api.Profile{}}
+		proposed.fillFrom(current)
+		Expect(proposed.profiles).To(HaveKey("db"))
+		Expect(proposed.endpoints[0].Labels).To(Equal(map[string]string{"role": "db"}))
+	})
+})
+
+var _ = DescribeTable("Test render diff",
+	func(a, b []renderedSection, expected string) {
+		var buf bytes.Buffer
+		printUnifiedDiff(&buf, "current", "proposed", diffSections(a, b))
+		Expect(buf.String()).To(Equal(expected))
+	},
+	Entry("no changes",
+		[]renderedSection{{"a", []string{"1", "2"}}},
+		[]renderedSection{{"a", []string{"1", "2"}}},
+		"--- current\n+++ proposed\n"),
+	Entry("a changed section",
+		[]renderedSection{{"a", []string{"1", "2", "3"}}},
+		[]renderedSection{{"a", []string{"1", "x", "3"}}},
+		"--- current\n+++ proposed\n@@ -1,3 +1,3 @@\n 1\n-2\n+x\n 3\n"),
+	Entry("added and removed sections",
+		[]renderedSection{{"a", []string{"1"}}, {"c", []string{"3"}}},
+		[]renderedSection{{"b", []string{"2"}}, {"c", []string{"3"}}},
+		"--- current\n+++ proposed\n@@ -1,2 +1,2 @@\n-1\n+2\n 3\n"),
+	Entry("lines are not matched across sections",
+		[]renderedSection{{"a", []string{"1", "2"}}, {"b", []string{"3"}}},
+		[]renderedSection{{"a", []string{"1"}}, {"b", []string{"2", "3"}}},
+		"--- current\n+++ proposed\n@@ -1,3 +1,3 @@\n 1\n-2\n+2\n 3\n"),
+)
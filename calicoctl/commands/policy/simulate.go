@@ -0,0 +1,594 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/docopt/docopt-go"
+	"github.com/projectcalico/calico-containers/calicoctl/commands/constants"
+	"github.com/projectcalico/libcalico-go/lib/api"
+	"github.com/projectcalico/libcalico-go/lib/numorstring"
+)
+
+// The verdicts and rule actions used by the simulation.
+const (
+	verdictAllow = "allow"
+	verdictDeny  = "deny"
+	noMatch      = "no match"
+)
+
+// protocolNumbers maps the protocol names accepted in rules to the protocol numbers.
+var protocolNumbers = map[string]int{
+	"icmp":    1,
+	"tcp":     6,
+	"udp":     17,
+	"icmpv6":  58,
+	"sctp":    132,
+	"udplite": 136,
+}
+
+// packet is the simulated traffic.  A nil port, ICMP type or ICMP code indicates that the
+// value was not specified.
+type packet struct {
+	Protocol   int   `json:"protocol"`
+	SourcePort *int  `json:"sourcePort,omitempty"`
+	Port       *int  `json:"port,omitempty"`
+	ICMPType   *int  `json:"icmpType,omitempty"`
+	ICMPCode   *int  `json:"icmpCode,omitempty"`
+	Source     *peer `json:"source"`
+	Dest       *peer `json:"destination"`
+}
+
+// peer is the source or destination of the simulated traffic.  This is either an endpoint
+// known to the simulation, or an external IP address.  The IP is nil if the peer is an
+// endpoint without an IP address.
+type peer struct {
+	Endpoint *endpoint `json:"endpoint,omitempty"`
+	IP       net.IP    `json:"ip,omitempty"`
+
+	// The IP addresses and tags (from the profiles) of the endpoint.
+	ips  []net.IP
+	tags map[string]bool
+}
+
+// simulationStep is the result of applying a single policy or profile (or the default
+// action) to the traffic.  Rule is the 1-based index of the first matching rule, or 0 if no
+// rule matched.
+type simulationStep struct {
+	Type        string    `json:"type"`
+	Name        string    `json:"name,omitempty"`
+	Order       string    `json:"order,omitempty"`
+	Rule        int       `json:"rule,omitempty"`
+	Result      string    `json:"result"`
+	MatchedRule *api.Rule `json:"matchedRule,omitempty"`
+}
+
+// simulationSide is the result of simulating the egress policy of the source, or the
+// ingress policy of the destination.
+type simulationSide struct {
+	Direction string           `json:"direction"`
+	Peer      *peer            `json:"peer"`
+	Steps     []simulationStep `json:"steps"`
+	Verdict   string           `json:"verdict"`
+}
+
+// simulation is the result of the simulate command.
+type simulation struct {
+	Packet  packet         `json:"packet"`
+	Egress  simulationSide `json:"egress"`
+	Ingress simulationSide `json:"ingress"`
+	Verdict string         `json:"verdict"`
+}
+
+// Simulate evaluates the policies and profiles that apply to traffic between two
+// endpoints and displays the resulting verdict.
+func Simulate(args []string) {
+	doc := constants.DatastoreIntro + `Usage:
+  calicoctl policy simulate --from=<PEER> --to=<PEER> [--protocol=<PROTOCOL>]
+                            [--port=<PORT>] [--source-port=<PORT>]
+                            [--icmp-type=<TYPE>] [--icmp-code=<CODE>]
+                            [--filename=<FILENAME>...] [--output=<OUTPUT>]
+                            [--config=<CONFIG>]
+
+Examples:
+  # Simulate a connection from the workload endpoint "eth0" of workload "web1"
+  # to port 5432 of the database at 10.0.1.5.
+  calicoctl policy simulate --from=wep/eth0,workload=web1 --to=10.0.1.5 \
+                            --protocol=tcp --port=5432
+
+  # Simulate the same connection using the resources in a set of files rather
+  # than the datastore.
+  calicoctl policy simulate --from=wep/eth0,workload=web1 --to=10.0.1.5 \
+                            --protocol=tcp --port=5432 \
+                            -f policies.yaml -f endpoints.yaml
+
+Options:
+  -h --help                    Show this screen.
+     --from=<PEER>             The source of the traffic.
+     --to=<PEER>               The destination of the traffic.
+  -p --protocol=<PROTOCOL>     The protocol name or number.  [default: tcp]
+     --port=<PORT>             The destination port.
+     --source-port=<PORT>      The source port.
+     --icmp-type=<TYPE>        The ICMP type.
+     --icmp-code=<CODE>        The ICMP code.
+  -f --filename=<FILENAME>     Filename of a set of policies, profiles and
+                               endpoints to use instead of the datastore.  May
+                               be specified multiple times.
+  -o --output=<OUTPUT FORMAT>  Output format.  One of: ps, yaml, json.
+                               [default: ps]
+  -c --config=<CONFIG>         Path to the file containing connection
+                               configuration in YAML or JSON format.
+                               [default: /etc/calico/calicoctl.cfg]
+
+Description:
+  The policy simulate command evaluates the policies and profiles that apply
+  to traffic from one peer to another, without sending any traffic, and
+  displays the final verdict along with the result of each policy and profile
+  that was applied.
+
+  Each peer is either an IP address or an endpoint in the form
+  <KIND>/<NAME>[,node=<NODE>][,orchestrator=<ORCH>][,workload=<WORKLOAD>],
+  where <KIND> is workloadEndpoint or hostEndpoint (or any of the other names
+  listed by 'calicoctl api-resources') and the identifiers match exactly one
+  endpoint.  An IP address that is assigned to an endpoint is treated as that
+  endpoint, otherwise it is treated as a peer outside of the Calico network to
+  which no policy applies.
+
+  The traffic is simulated on both the egress side of the source and the
+  ingress side of the destination, and is allowed only if it is allowed on
+  both sides.  On each side the policies that apply to the endpoint are
+  applied in order, followed by the profiles of the endpoint.  The first rule
+  that matches in each policy or profile determines the result: allow or deny
+  stops processing on that side, log continues with the next rule, and
+  next-tier skips the remaining policies and continues with the profiles.
+  Traffic that is not allowed or denied by any rule is denied.
+
+  Rules are matched using the protocol, ports, ICMP type and code, tags,
+  selectors and nets of the rule.  A rule that matches on a value of the
+  traffic that is not specified (for example a port, or the IP address of an
+  endpoint without an IP address) does not match.
+
+  By default the policies, profiles and endpoints are read from the datastore.
+  If one or more files are specified using --filename, the resources in the
+  files are used instead, and the datastore is not accessed.
+`
+	parsedArgs, err := docopt.Parse(doc, args, true, "", false, false)
+	if err != nil {
+		fmt.Printf("Invalid option: 'calicoctl %s'. Use flag '--help' to read about a specific subcommand.\n", strings.Join(args, " "))
+		os.Exit(1)
+	}
+	if len(parsedArgs) == 0 {
+		return
+	}
+
+	output := parsedArgs["--output"].(string)
+	if output != "ps" && output != "yaml" && output != "json" {
+		fmt.Printf("unrecognized output format '%s'\n", output)
+		os.Exit(1)
+	}
+
+	pkt, err := packetFromArgs(parsedArgs)
+	if err != nil {
+		fmt.Printf("Error executing command: %v\n", err)
+		os.Exit(1)
+	}
+
+	model, err := loadModel(parsedArgs)
+	if err != nil {
+		fmt.Printf("Error executing command: %v\n", err)
+		os.Exit(1)
+	}
+
+	if pkt.Source, err = model.resolvePeer(parsedArgs["--from"].(string)); err != nil {
+		fmt.Printf("Error executing command: --from: %v\n", err)
+		os.Exit(1)
+	}
+	if pkt.Dest, err = model.resolvePeer(parsedArgs["--to"].(string)); err != nil {
+		fmt.Printf("Error executing command: --to: %v\n", err)
+		os.Exit(1)
+	}
+	pkt.Source.IP, pkt.Dest.IP = pickIPs(pkt.Source, pkt.Dest)
+
+	result, err := model.simulate(pkt)
+	if err != nil {
+		fmt.Printf("Error executing command: %v\n", err)
+		os.Exit(1)
+	}
+
+	if output == "ps" {
+		printSimulation(os.Stdout, result)
+	} else if err = printStructured(os.Stdout, output, result); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// packetFromArgs returns the packet described by the command line arguments, without the
+// source and destination.
+func packetFromArgs(args map[string]interface{}) (*packet, error) {
+	pkt := &packet{}
+	proto := strings.ToLower(args["--protocol"].(string))
+	if n, ok := protocolNumbers[proto]; ok {
+		pkt.Protocol = n
+	} else if n, err := strconv.Atoi(proto); err == nil && n >= 0 && n <= 255 {
+		pkt.Protocol = n
+	} else {
+		return nil, fmt.Errorf("invalid protocol '%s'", proto)
+	}
+
+	for _, opt := range []struct {
+		arg string
+		max int
+		val **int
+	}{
+		{"--port", 65535, &pkt.Port},
+		{"--source-port", 65535, &pkt.SourcePort},
+		{"--icmp-type", 255, &pkt.ICMPType},
+		{"--icmp-code", 255, &pkt.ICMPCode},
+	} {
+		s, ok := args[opt.arg].(string)
+		if !ok {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 || n > opt.max {
+			return nil, fmt.Errorf("invalid value for %s '%s'", opt.arg, s)
+		}
+		*opt.val = &n
+	}
+	return pkt, nil
+}
+
+// resolvePeer returns the peer specified on the command line, which is either an IP
+// address or an endpoint in the form <KIND>/<NAME>[,<identifier>=<value>...].
+func (m *policyModel) resolvePeer(s string) (*peer, error) {
+	if ip := net.ParseIP(s); ip != nil {
+		var matched []*modelEndpoint
+		for i := range m.endpoints {
+			for _, epIP := range m.endpoints[i].IPs {
+				if epIP.Equal(ip) {
+					matched = append(matched, &m.endpoints[i])
+					break
+				}
+			}
+		}
+		switch len(matched) {
+		case 0:
+			return &peer{IP: ip}, nil
+		case 1:
+			return m.newPeer(matched[0], ip), nil
+		}
+		return nil, fmt.Errorf("%d endpoints have the IP address %s", len(matched), s)
+	}
+
+	ep, err := m.findEndpoint(s)
+	if err != nil {
+		return nil, err
+	}
+	return m.newPeer(ep, nil), nil
+}
+
+// newPeer returns a peer for the endpoint, using the supplied IP address.  The tags of
+// the peer are the tags of the profiles of the endpoint.
+func (m *policyModel) newPeer(ep *modelEndpoint, ip net.IP) *peer {
+	p := &peer{Endpoint: &ep.endpoint, IP: ip, ips: ep.IPs, tags: map[string]bool{}}
+	for _, name := range ep.Profiles {
+		if prof, ok := m.profiles[name]; ok {
+			for _, tag := range prof.Spec.Tags {
+				p.tags[tag] = true
+			}
+		}
+	}
+	return p
+}
+
+// pickIPs returns the source and destination IP addresses of the traffic.  Where a peer
+// was specified as an endpoint, an IP address of the endpoint is chosen with the same
+// IP version as the other peer, if possible.
+func pickIPs(src, dst *peer) (net.IP, net.IP) {
+	pick := func(p *peer, other net.IP) net.IP {
+		if p.IP != nil {
+			return p.IP
+		}
+		for _, ip := range p.ips {
+			if other == nil || ipVersion(ip) == ipVersion(other) {
+				return ip
+			}
+		}
+		return nil
+	}
+	srcIP := pick(src, dst.IP)
+	return srcIP, pick(dst, srcIP)
+}
+
+// ipVersion returns the IP version of the address.
+func ipVersion(ip net.IP) int {
+	if ip.To4() != nil {
+		return 4
+	}
+	return 6
+}
+
+// simulate evaluates the egress policy of the source and the ingress policy of the
+// destination.
+func (m *policyModel) simulate(pkt *packet) (*simulation, error) {
+	srcPolicies, err := m.peerPolicies(pkt.Source)
+	if err != nil {
+		return nil, err
+	}
+	dstPolicies, err := m.peerPolicies(pkt.Dest)
+	if err != nil {
+		return nil, err
+	}
+	return m.simulateWithPolicies(pkt, srcPolicies, dstPolicies)
+}
+
+// peerPolicies returns the policies that apply to the peer, in order.  No policies apply
+// to a peer that is not an endpoint.
+func (m *policyModel) peerPolicies(p *peer) ([]api.Policy, error) {
+	if p.Endpoint == nil {
+		return nil, nil
+	}
+	return matchingPolicies(m.policies, p.Endpoint.Labels)
+}
+
+// simulateWithPolicies is simulate, using the policies already known to apply to the
+// source and destination.
+func (m *policyModel) simulateWithPolicies(pkt *packet, srcPolicies, dstPolicies []api.Policy) (*simulation, error) {
+	result := &simulation{Packet: *pkt}
+	var err error
+	if result.Egress, err = m.simulateSide(pkt, "egress", pkt.Source, srcPolicies); err != nil {
+		return nil, err
+	}
+	if result.Ingress, err = m.simulateSide(pkt, "ingress", pkt.Dest, dstPolicies); err != nil {
+		return nil, err
+	}
+	result.Verdict = verdictDeny
+	if result.Egress.Verdict == verdictAllow && result.Ingress.Verdict == verdictAllow {
+		result.Verdict = verdictAllow
+	}
+	return result, nil
+}
+
+// simulateSide applies the policies of the peer and then its profiles in the direction,
+// stopping at the first rule that allows or denies the traffic.  A peer that is not an
+// endpoint has no policy, so the traffic is allowed on that side.
+func (m *policyModel) simulateSide(pkt *packet, direction string, p *peer, policies []api.Policy) (simulationSide, error) {
+	side := simulationSide{Direction: direction, Peer: p, Steps: []simulationStep{}}
+	if p.Endpoint == nil {
+		side.Verdict = verdictAllow
+		return side, nil
+	}
+
+	rulesFor := func(ingress, egress []api.Rule) []api.Rule {
+		if direction == "ingress" {
+			return ingress
+		}
+		return egress
+	}
+
+	for _, pol := range policies {
+		step := simulationStep{Type: "policy", Name: pol.Metadata.Name, Order: orderString(pol)}
+		if err := applyRules(pkt, rulesFor(pol.Spec.IngressRules, pol.Spec.EgressRules), &step); err != nil {
+			return side, fmt.Errorf("policy '%s': %v", pol.Metadata.Name, err)
+		}
+		side.Steps = append(side.Steps, step)
+		if step.Result == verdictAllow || step.Result == verdictDeny {
+			side.Verdict = step.Result
+			return side, nil
+		}
+		if step.Result == "next-tier" {
+			break
+		}
+	}
+
+	for _, name := range p.Endpoint.Profiles {
+		step := simulationStep{Type: "profile", Name: name}
+		prof, ok := m.profiles[name]
+		if !ok {
+			step.Result = "profile does not exist"
+			side.Steps = append(side.Steps, step)
+			continue
+		}
+		if err := applyRules(pkt, rulesFor(prof.Spec.IngressRules, prof.Spec.EgressRules), &step); err != nil {
+			return side, fmt.Errorf("profile '%s': %v", name, err)
+		}
+		side.Steps = append(side.Steps, step)
+		if step.Result == verdictAllow || step.Result == verdictDeny {
+			side.Verdict = step.Result
+			return side, nil
+		}
+	}
+
+	side.Steps = append(side.Steps, simulationStep{Type: "default", Result: verdictDeny})
+	side.Verdict = verdictDeny
+	return side, nil
+}
+
+// applyRules sets the result of the step from the first rule that matches the packet and
+// does not have the log action.  The result is "no match" if no such rule matches.
+func applyRules(pkt *packet, rules []api.Rule, step *simulationStep) error {
+	step.Result = noMatch
+	for i := range rules {
+		match, err := ruleMatches(pkt, &rules[i])
+		if err != nil {
+			return fmt.Errorf("rule %d: %v", i+1, err)
+		}
+		if !match || rules[i].Action == "log" {
+			continue
+		}
+		step.Rule = i + 1
+		step.Result = rules[i].Action
+		step.MatchedRule = &rules[i]
+		return nil
+	}
+	return nil
+}
+
+// ruleMatches returns true if all of the match criteria of the rule match the packet.
+func ruleMatches(pkt *packet, r *api.Rule) (bool, error) {
+	if r.IPVersion != nil {
+		ip := pkt.Source.IP
+		if ip == nil {
+			ip = pkt.Dest.IP
+		}
+		if ip == nil || ipVersion(ip) != *r.IPVersion {
+			return false, nil
+		}
+	}
+	if r.Protocol != nil && !protocolMatches(r.Protocol.String(), pkt.Protocol) {
+		return false, nil
+	}
+	if r.NotProtocol != nil && protocolMatches(r.NotProtocol.String(), pkt.Protocol) {
+		return false, nil
+	}
+	if r.ICMP != nil && !icmpMatches(r.ICMP, pkt) {
+		return false, nil
+	}
+	if r.NotICMP != nil && (pkt.ICMPType == nil || icmpMatches(r.NotICMP, pkt)) {
+		return false, nil
+	}
+
+	if match, err := entityMatches(&r.Source, pkt.Source, pkt.SourcePort); err != nil || !match {
+		return false, err
+	}
+	return entityMatches(&r.Destination, pkt.Dest, pkt.Port)
+}
+
+// protocolMatches returns true if the protocol name or number from a rule is the protocol
+// number of the packet.
+func protocolMatches(proto string, num int) bool {
+	n, ok := protocolNumber(proto)
+	return ok && n == num
+}
+
+// protocolNumber returns the protocol number of a protocol name or number.
+func protocolNumber(proto string) (int, bool) {
+	if n, ok := protocolNumbers[strings.ToLower(proto)]; ok {
+		return n, true
+	}
+	n, err := strconv.Atoi(proto)
+	return n, err == nil
+}
+
+// icmpMatches returns true if the ICMP type and code match the packet.
+func icmpMatches(icmp *api.ICMPFields, pkt *packet) bool {
+	if icmp.Type != nil && (pkt.ICMPType == nil || *pkt.ICMPType != *icmp.Type) {
+		return false
+	}
+	if icmp.Code != nil && (pkt.ICMPCode == nil || *pkt.ICMPCode != *icmp.Code) {
+		return false
+	}
+	return true
+}
+
+// entityMatches returns true if the source or destination criteria of a rule match the
+// peer and port.  Selectors and tags only match endpoints.
+func entityMatches(e *api.EntityRule, p *peer, port *int) (bool, error) {
+	if e.Tag != "" && !p.tags[e.Tag] {
+		return false, nil
+	}
+	if e.NotTag != "" && p.tags[e.NotTag] {
+		return false, nil
+	}
+	if e.Net != nil && (p.IP == nil || !e.Net.Contains(p.IP)) {
+		return false, nil
+	}
+	if e.NotNet != nil && (p.IP == nil || e.NotNet.Contains(p.IP)) {
+		return false, nil
+	}
+	if e.Selector != "" {
+		if p.Endpoint == nil {
+			return false, nil
+		}
+		if match, err := selectsLabels(e.Selector, p.Endpoint.Labels); err != nil || !match {
+			return false, err
+		}
+	}
+	if e.NotSelector != "" && p.Endpoint != nil {
+		if match, err := selectsLabels(e.NotSelector, p.Endpoint.Labels); err != nil || match {
+			return false, err
+		}
+	}
+	if len(e.Ports) > 0 && (port == nil || !portsMatch(e.Ports, *port)) {
+		return false, nil
+	}
+	if len(e.NotPorts) > 0 && (port == nil || portsMatch(e.NotPorts, *port)) {
+		return false, nil
+	}
+	return true, nil
+}
+
+// portsMatch returns true if the port is in any of the port ranges.
+func portsMatch(ports []numorstring.Port, port int) bool {
+	for _, p := range ports {
+		if port >= int(p.MinPort) && port <= int(p.MaxPort) {
+			return true
+		}
+	}
+	return false
+}
+
+// printSimulation writes the result of the simulation in the ps-style output format.
+func printSimulation(w io.Writer, result *simulation) {
+	for _, side := range []simulationSide{result.Egress, result.Ingress} {
+		fmt.Fprintf(w, "%s %s: %s\n", strings.ToUpper(side.Direction), peerString(side.Peer), side.Verdict)
+		if side.Peer.Endpoint == nil {
+			fmt.Fprintf(w, "  (no policy applies outside of the Calico network)\n\n")
+			continue
+		}
+		tw := tabwriter.NewWriter(w, 5, 1, 3, ' ', 0)
+		fmt.Fprintf(tw, "STEP\tTYPE\tNAME\tORDER\tRULE\tRESULT\tMATCHED RULE\t\n")
+		for i, s := range side.Steps {
+			rule, matched := "-", ""
+			if s.Rule > 0 {
+				rule = strconv.Itoa(s.Rule)
+				if b, err := json.Marshal(s.MatchedRule); err == nil {
+					matched = string(b)
+				}
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t\n", i+1, s.Type, s.Name, s.Order, rule, s.Result, matched)
+		}
+		tw.Flush()
+		fmt.Fprintln(w)
+	}
+	fmt.Fprintf(w, "VERDICT: %s\n", result.Verdict)
+}
+
+// peerString returns the display value of the peer.
+func peerString(p *peer) string {
+	ip := "<no IP>"
+	if p.IP != nil {
+		ip = p.IP.String()
+	}
+	if p.Endpoint == nil {
+		return ip
+	}
+	ids := []string{}
+	for _, k := range []string{"node", "orchestrator", "workload", "name"} {
+		if v, ok := p.Endpoint.Identifiers[k]; ok {
+			ids = append(ids, k+"="+v)
+		}
+	}
+	return fmt.Sprintf("%s(%s) %s", p.Endpoint.Kind, strings.Join(ids, ","), ip)
+}
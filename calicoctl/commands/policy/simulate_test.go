@@ -0,0 +1,179 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"fmt"
+	"net"
+
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/projectcalico/libcalico-go/lib/api"
+)
+
+// externalPeer returns a peer outside of the Calico network with the IP address and tags.
+func externalPeer(ip string, tags ...string) *peer {
+	p := &peer{IP: net.ParseIP(ip), tags: map[string]bool{}}
+	for _, t := range tags {
+		p.tags[t] = true
+	}
+	return p
+}
+
+// tcpPacket returns a TCP packet between the peers, to the port if it is not zero.
+func tcpPacket(src, dst *peer, port int) *packet {
+	pkt := &packet{Protocol: 6, Source: src, Dest: dst}
+	if port != 0 {
+		pkt.Port = &port
+	}
+	return pkt
+}
+
+// simPolicy returns a policy with the order, selector and ingress rules.
+func simPolicy(name string, order float64, selector string, rules ...api.Rule) api.Policy {
+	p := api.NewPolicy()
+	p.Metadata.Name = name
+	p.Spec.Order = &order
+	p.Spec.Selector = selector
+	p.Spec.IngressRules = rules
+	return *p
+}
+
+// simProfile returns a profile with the ingress rules.
+func simProfile(name string, rules ...api.Rule) api.Profile {
+	p := api.NewProfile()
+	p.Metadata.Name = name
+	p.Spec.IngressRules = rules
+	return *p
+}
+
+// stepSummary returns the type, name, matched rule and result of a simulation step.
+func stepSummary(s simulationStep) string {
+	name := s.Type
+	if s.Name != "" {
+		name += " " + s.Name
+	}
+	if s.Rule > 0 {
+		name += fmt.Sprintf(" rule %d", s.Rule)
+	}
+	return name + ": " + s.Result
+}
+
+var (
+	allowRule = api.Rule{Action: "allow"}
+	denyRule  = api.Rule{Action: "deny"}
+)
+
+var _ = DescribeTable("Test simulate rule matches",
+	func(pkt *packet, r api.Rule, expected bool) {
+		match, err := ruleMatches(pkt, &r)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(match).To(Equal(expected))
+	},
+	Entry("a rule without criteria matches",
+		tcpPacket(externalPeer("10.0.0.1"), externalPeer("10.0.0.2"), 80),
+		api.Rule{Action: "allow"}, true),
+	Entry("a notNet does not match a source within it",
+		tcpPacket(externalPeer("10.0.0.1"), externalPeer("10.0.0.2"), 80),
+		api.Rule{Action: "allow", Source: api.EntityRule{NotNet: mustParseCIDR("10.0.0.0/24")}}, false),
+	Entry("a notNet matches a source outside it",
+		tcpPacket(externalPeer("10.0.1.1"), externalPeer("10.0.0.2"), 80),
+		api.Rule{Action: "allow", Source: api.EntityRule{NotNet: mustParseCIDR("10.0.0.0/24")}}, true),
+	Entry("notPorts does not match a port within them",
+		tcpPacket(externalPeer("10.0.0.1"), externalPeer("10.0.0.2"), 80),
+		api.Rule{Action: "allow", Protocol: &tcp, Destination: api.EntityRule{NotPorts: web}}, false),
+	Entry("notPorts matches another port",
+		tcpPacket(externalPeer("10.0.0.1"), externalPeer("10.0.0.2"), 8080),
+		api.Rule{Action: "allow", Protocol: &tcp, Destination: api.EntityRule{NotPorts: web}}, true),
+	Entry("a notTag does not match a peer with the tag",
+		tcpPacket(externalPeer("10.0.0.1", "db"), externalPeer("10.0.0.2"), 80),
+		api.Rule{Action: "allow", Source: api.EntityRule{NotTag: "db"}}, false),
+	Entry("a notTag matches a peer without the tag",
+		tcpPacket(externalPeer("10.0.0.1", "web"), externalPeer("10.0.0.2"), 80),
+		api.Rule{Action: "allow", Source: api.EntityRule{NotTag: "db"}}, true),
+	Entry("an IP version does not match traffic of the other IP version",
+		tcpPacket(externalPeer("10.0.0.1"), externalPeer("10.0.0.2"), 80),
+		api.Rule{Action: "allow", IPVersion: &ipv6}, false),
+	Entry("an IP version matches traffic of the IP version",
+		tcpPacket(externalPeer("fd00::1"), externalPeer("fd00::2"), 80),
+		api.Rule{Action: "allow", IPVersion: &ipv6}, true),
+	Entry("a port rule does not match traffic without a port",
+		tcpPacket(externalPeer("10.0.0.1"), externalPeer("10.0.0.2"), 0),
+		api.Rule{Action: "allow", Protocol: &tcp, Destination: api.EntityRule{Ports: http}}, false),
+	Entry("a port rule matches traffic to the port",
+		tcpPacket(externalPeer("10.0.0.1"), externalPeer("10.0.0.2"), 80),
+		api.Rule{Action: "allow", Protocol: &tcp, Destination: api.EntityRule{Ports: http}}, true),
+	Entry("a UDP rule does not match TCP traffic",
+		tcpPacket(externalPeer("10.0.0.1"), externalPeer("10.0.0.2"), 80),
+		api.Rule{Action: "allow", Protocol: &udp}, false),
+)
+
+var _ = DescribeTable("Test simulate policies and profiles",
+	func(policies []api.Policy, profiles []api.Profile, expectedSteps []string, expectedVerdict string) {
+		m := &policyModel{policies: policies, profiles: map[string]api.Profile{}}
+		sortPolicies(m.policies)
+		ep := modelEndpoint{endpoint: endpoint{
+			Kind:     "workloadEndpoint",
+			Labels:   map[string]string{"app": "web"},
+			Profiles: []string{"web", "missing"},
+		}}
+		for _, p := range profiles {
+			m.profiles[p.Metadata.Name] = p
+		}
+
+		dst := m.newPeer(&ep, net.ParseIP("10.0.0.2"))
+		result, err := m.simulate(tcpPacket(externalPeer("10.0.0.1"), dst, 80))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Egress.Verdict).To(Equal(verdictAllow))
+		steps := []string{}
+		for _, s := range result.Ingress.Steps {
+			steps = append(steps, stepSummary(s))
+		}
+		Expect(steps).To(Equal(expectedSteps))
+		Expect(result.Ingress.Verdict).To(Equal(expectedVerdict))
+		Expect(result.Verdict).To(Equal(expectedVerdict))
+	},
+	Entry("policies are applied in order",
+		[]api.Policy{simPolicy("b", 2, "", allowRule), simPolicy("a", 1, "", denyRule)},
+		nil,
+		[]string{"policy a rule 1: deny"}, verdictDeny),
+	Entry("policies that do not select the endpoint are skipped",
+		[]api.Policy{simPolicy("a", 1, "app == 'db'", denyRule), simPolicy("b", 2, "app == 'web'", allowRule)},
+		nil,
+		[]string{"policy b rule 1: allow"}, verdictAllow),
+	Entry("profiles are applied after the policies",
+		[]api.Policy{simPolicy("a", 1, "", api.Rule{Action: "deny", Protocol: &udp})},
+		[]api.Profile{simProfile("web", allowRule)},
+		[]string{"policy a: no match", "profile web rule 1: allow"}, verdictAllow),
+	Entry("traffic that is not allowed is denied by default",
+		[]api.Policy{simPolicy("a", 1, "", api.Rule{Action: "allow", Protocol: &udp})},
+		[]api.Profile{simProfile("web")},
+		[]string{"policy a: no match", "profile web: no match", "profile missing: profile does not exist", "default: deny"},
+		verdictDeny),
+	Entry("next-tier skips the remaining policies",
+		[]api.Policy{simPolicy("a", 1, "", api.Rule{Action: "next-tier"}), simPolicy("b", 2, "", allowRule)},
+		[]api.Profile{simProfile("web", denyRule)},
+		[]string{"policy a rule 1: next-tier", "profile web rule 1: deny"}, verdictDeny),
+	Entry("log is not terminal",
+		[]api.Policy{simPolicy("a", 1, "", api.Rule{Action: "log"}, allowRule)},
+		nil,
+		[]string{"policy a rule 2: allow"}, verdictAllow),
+	Entry("a port rule does not match traffic to another port",
+		[]api.Policy{simPolicy("a", 1, "", api.Rule{Action: "allow", Protocol: &tcp, Destination: api.EntityRule{Ports: https}})},
+		nil,
+		[]string{"policy a: no match", "profile web: profile does not exist", "profile missing: profile does not exist", "default: deny"},
+		verdictDeny),
+)
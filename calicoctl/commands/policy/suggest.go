@@ -0,0 +1,565 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docopt/docopt-go"
+	"github.com/projectcalico/calico-containers/calicoctl/commands/constants"
+	"github.com/projectcalico/calico-containers/calicoctl/resourcemgr"
+	"github.com/projectcalico/libcalico-go/lib/api"
+	cnet "github.com/projectcalico/libcalico-go/lib/net"
+	"github.com/projectcalico/libcalico-go/lib/numorstring"
+)
+
+// connection is a connection read from a conntrack dump, in the direction of the packet
+// that created it.  The port is nil for protocols without ports, and the ICMP type is nil
+// for protocols other than ICMP.
+type connection struct {
+	protocol numorstring.Protocol
+	src      net.IP
+	dst      net.IP
+	port     *int
+	icmpType *int
+}
+
+// suggestPeer is the other end of the connections matched by a suggested rule: either the
+// endpoints that match a selector, or a single IP address.
+type suggestPeer struct {
+	selector string
+	ip       net.IP
+}
+
+// suggestRuleKey identifies the connections that are allowed by a single suggested rule.
+// Connections with the same key are combined into a rule with a list of ports.
+type suggestRuleKey struct {
+	peer     string
+	protocol string
+	icmpType int
+}
+
+// suggestRule is a rule of a suggested policy.
+type suggestRule struct {
+	peer     suggestPeer
+	protocol numorstring.Protocol
+	icmpType *int
+	ports    map[int]bool
+}
+
+// suggestPolicy is the set of rules suggested for the endpoints that match a selector.
+type suggestPolicy struct {
+	selector string
+	ingress  map[suggestRuleKey]*suggestRule
+	egress   map[suggestRuleKey]*suggestRule
+}
+
+// Suggest generates policies that allow the connections in a conntrack dump.
+func Suggest(args []string) {
+	doc := constants.DatastoreIntro + `Usage:
+  calicoctl policy suggest [--conntrack=<FILE>] [--label=<LABEL>...]
+                           [--name-prefix=<PREFIX>] [--order=<ORDER>]
+                           [--log-only] [--output=<OUTPUT>] [--config=<CONFIG>]
+
+Examples:
+  # Suggest policies for the connections tracked on this host.
+  calicoctl policy suggest > suggested.yaml
+
+  # Suggest policies from a conntrack dump captured on another host, selecting
+  # endpoints using only their "app" label.
+  conntrack -L > conntrack.txt
+  calicoctl policy suggest --conntrack=conntrack.txt --label=app
+
+  # Suggest policies that log the connections instead of allowing them.
+  calicoctl policy suggest --log-only --order=0
+
+Options:
+  -h --help                    Show this screen.
+     --conntrack=<FILE>        The file containing the connections, in the
+                               format of /proc/net/nf_conntrack or the output of
+                               'conntrack -L'.  If set to "-" loads from stdin.
+                               [default: /proc/net/nf_conntrack]
+  -l --label=<LABEL>           The name of a label used in the selectors of the
+                               suggested policies.  May be specified multiple
+                               times.  By default all labels are used.
+     --name-prefix=<PREFIX>    The prefix of the names of the suggested
+                               policies.  [default: suggested-]
+     --order=<ORDER>           The order of the suggested policies.
+     --log-only                Suggest rules with the log action instead of the
+                               allow action.
+  -o --output=<OUTPUT FORMAT>  Output format.  One of: yaml, json.
+                               [default: yaml]
+  -c --config=<CONFIG>         Path to the file containing connection
+                               configuration in YAML or JSON format.
+                               [default: /etc/calico/calicoctl.cfg]
+
+Description:
+  The policy suggest command reads the connections in a conntrack dump and
+  generates policies that allow them, for review before they are created
+  using 'calicoctl create'.
+
+  The source and destination IP addresses of each connection are mapped to
+  the workload endpoints and host endpoints in the datastore.  An endpoint is
+  identified by a selector on its labels (or on the labels given by --label).
+  A policy is suggested for each such selector, with an ingress rule for the
+  connections to the endpoints and an egress rule for the connections from
+  the endpoints.  Connections with the same peer and protocol are combined
+  into a single rule that lists the destination ports (for TCP and UDP), so
+  source ports are not included.  A peer that is not an endpoint, or an
+  endpoint without labels, is identified by its IP address.  Connections
+  where neither address is an endpoint are ignored.
+
+  With --log-only, the rules have the log action, so the suggested policies
+  log the traffic without changing whether it is allowed.
+`
+	parsedArgs, err := docopt.Parse(doc, args, true, "", false, false)
+	if err != nil {
+		fmt.Printf("Invalid option: 'calicoctl %s'. Use flag '--help' to read about a specific subcommand.\n", strings.Join(args, " "))
+		os.Exit(1)
+	}
+	if len(parsedArgs) == 0 {
+		return
+	}
+
+	output := parsedArgs["--output"].(string)
+	if output != "yaml" && output != "json" {
+		fmt.Printf("unrecognized output format '%s'\n", output)
+		os.Exit(1)
+	}
+
+	var order *float64
+	if s, ok := parsedArgs["--order"].(string); ok {
+		o, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			fmt.Printf("Error executing command: invalid order '%s'\n", s)
+			os.Exit(1)
+		}
+		order = &o
+	}
+
+	conns, err := readConntrack(parsedArgs["--conntrack"].(string))
+	if err != nil {
+		fmt.Printf("Error executing command: %v\n", err)
+		os.Exit(1)
+	}
+
+	model, err := loadModelFromDatastore(parsedArgs["--config"].(string))
+	if err != nil {
+		fmt.Printf("Error executing command: %v\n", err)
+		os.Exit(1)
+	}
+
+	action := "allow"
+	if parsedArgs["--log-only"].(bool) {
+		action = "log"
+	}
+	s := newSuggester(model, parsedArgs["--label"].([]string))
+	for _, conn := range conns {
+		s.add(conn)
+	}
+	policies := s.suggestedPolicies(parsedArgs["--name-prefix"].(string), order, action)
+	for _, p := range policies {
+		if err := resourcemgr.Validate(p); err != nil {
+			fmt.Printf("Error executing command: suggested policy '%s' is not valid: %v\n", p.Metadata.Name, err)
+			os.Exit(1)
+		}
+	}
+
+	for _, note := range s.notes() {
+		fmt.Fprintf(os.Stderr, "WARNING: %s\n", note)
+	}
+	if err = printStructured(os.Stdout, output, policies); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
+
+// readConntrack reads the connections from the file, or from stdin if the file is "-".
+func readConntrack(f string) ([]connection, error) {
+	if f == "-" {
+		return parseConntrack(os.Stdin)
+	}
+	file, err := os.Open(f)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return parseConntrack(file)
+}
+
+// parseConntrack parses the connections in the format of /proc/net/nf_conntrack, or the
+// output of 'conntrack -L' (which omits the leading address family fields).  Each line
+// contains the protocol name and number, followed by key=value fields for the original
+// direction and then the reply direction.  Lines that are not connections are skipped.
+func parseConntrack(r io.Reader) ([]connection, error) {
+	conns := []connection{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+
+		// The protocol is the first name that is followed by a number, other than the
+		// address family.
+		var proto *numorstring.Protocol
+		i := 0
+		for ; i+1 < len(fields) && proto == nil; i++ {
+			name := strings.ToLower(fields[i])
+			num, err := strconv.Atoi(fields[i+1])
+			if err != nil || strings.Contains(name, "=") || name == "ipv4" || name == "ipv6" {
+				continue
+			}
+			if _, ok := protocolNumbers[name]; ok {
+				p := numorstring.ProtocolFromString(name)
+				proto = &p
+			} else if num >= 0 && num <= 255 {
+				p := numorstring.ProtocolFromInt(uint8(num))
+				proto = &p
+			}
+		}
+		if proto == nil {
+			continue
+		}
+
+		// Only the first occurrence of each field is used, which is the original
+		// direction of the connection.
+		values := map[string]string{}
+		for _, f := range fields[i:] {
+			kv := strings.SplitN(f, "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			if _, ok := values[kv[0]]; !ok {
+				values[kv[0]] = kv[1]
+			}
+		}
+
+		conn := connection{
+			protocol: *proto,
+			src:      net.ParseIP(values["src"]),
+			dst:      net.ParseIP(values["dst"]),
+		}
+		if conn.src == nil || conn.dst == nil {
+			continue
+		}
+		if name := proto.String(); name == "tcp" || name == "udp" {
+			if n, err := strconv.Atoi(values["dport"]); err == nil {
+				conn.port = &n
+			}
+		}
+		if n, err := strconv.Atoi(values["type"]); err == nil {
+			conn.icmpType = &n
+		}
+		conns = append(conns, conn)
+	}
+	return conns, scanner.Err()
+}
+
+// suggester builds the suggested policies from the connections.
+type suggester struct {
+	labels   []string
+	byIP     map[string]*modelEndpoint
+	policies map[string]*suggestPolicy
+	ignored  int
+	noLabels map[string]bool
+}
+
+// newSuggester returns a suggester that maps IP addresses to the endpoints in the model,
+// identifying endpoints using the labels (or all labels, if none are specified).
+func newSuggester(m *policyModel, labels []string) *suggester {
+	s := &suggester{
+		labels:   labels,
+		byIP:     map[string]*modelEndpoint{},
+		policies: map[string]*suggestPolicy{},
+		noLabels: map[string]bool{},
+	}
+	for i := range m.endpoints {
+		for _, ip := range m.endpoints[i].IPs {
+			if _, ok := s.byIP[ip.String()]; !ok {
+				s.byIP[ip.String()] = &m.endpoints[i]
+			}
+		}
+	}
+	return s
+}
+
+// selectorFor returns the selector that identifies the endpoint, or an empty string if
+// the endpoint does not have any of the labels.
+func (s *suggester) selectorFor(ep *modelEndpoint) string {
+	keys := s.labels
+	if len(keys) == 0 {
+		keys = make([]string, 0, len(ep.Labels))
+		for k := range ep.Labels {
+			keys = append(keys, k)
+		}
+	}
+	keys = append([]string(nil), keys...)
+	sort.Strings(keys)
+
+	terms := []string{}
+	for _, k := range keys {
+		if v, ok := ep.Labels[k]; ok {
+			terms = append(terms, fmt.Sprintf("%s == '%s'", k, v))
+		}
+	}
+	if len(terms) == 0 {
+		s.noLabels[fmt.Sprintf("%s %s", ep.Kind, endpointName(ep.Identifiers))] = true
+	}
+	return strings.Join(terms, " && ")
+}
+
+// peerFor returns the peer that identifies the IP address, and the selector of the
+// endpoint with the address (if any).
+func (s *suggester) peerFor(ip net.IP) (suggestPeer, string) {
+	ep, ok := s.byIP[ip.String()]
+	if !ok {
+		return suggestPeer{ip: ip}, ""
+	}
+	sel := s.selectorFor(ep)
+	if sel == "" {
+		return suggestPeer{ip: ip}, ""
+	}
+	return suggestPeer{selector: sel}, sel
+}
+
+// add adds the connection to an ingress rule of the policy for the destination endpoint
+// and an egress rule of the policy for the source endpoint.
+func (s *suggester) add(conn connection) {
+	src, srcSel := s.peerFor(conn.src)
+	dst, dstSel := s.peerFor(conn.dst)
+	if srcSel == "" && dstSel == "" {
+		s.ignored++
+		return
+	}
+	if dstSel != "" {
+		s.policyFor(dstSel).addRule(true, src, conn)
+	}
+	if srcSel != "" {
+		s.policyFor(srcSel).addRule(false, dst, conn)
+	}
+}
+
+// policyFor returns the suggested policy for the endpoints that match the selector.
+func (s *suggester) policyFor(sel string) *suggestPolicy {
+	p, ok := s.policies[sel]
+	if !ok {
+		p = &suggestPolicy{
+			selector: sel,
+			ingress:  map[suggestRuleKey]*suggestRule{},
+			egress:   map[suggestRuleKey]*suggestRule{},
+		}
+		s.policies[sel] = p
+	}
+	return p
+}
+
+// addRule adds the connection to the ingress or egress rule for the peer and protocol.
+func (p *suggestPolicy) addRule(ingress bool, peer suggestPeer, conn connection) {
+	rules := p.egress
+	if ingress {
+		rules = p.ingress
+	}
+	key := suggestRuleKey{peer: peer.selector, protocol: conn.protocol.String(), icmpType: -1}
+	if peer.ip != nil {
+		key.peer = peer.ip.String()
+	}
+	if conn.icmpType != nil {
+		key.icmpType = *conn.icmpType
+	}
+	r, ok := rules[key]
+	if !ok {
+		r = &suggestRule{peer: peer, protocol: conn.protocol, icmpType: conn.icmpType, ports: map[int]bool{}}
+		rules[key] = r
+	}
+	if conn.port != nil {
+		r.ports[*conn.port] = true
+	}
+}
+
+// notes returns the warnings about connections and endpoints that could not be
+// translated to selectors.
+func (s *suggester) notes() []string {
+	notes := []string{}
+	if s.ignored > 0 {
+		notes = append(notes, fmt.Sprintf("%d connection(s) between addresses that are not endpoints are ignored", s.ignored))
+	}
+	eps := make([]string, 0, len(s.noLabels))
+	for ep := range s.noLabels {
+		eps = append(eps, ep)
+	}
+	sort.Strings(eps)
+	for _, ep := range eps {
+		notes = append(notes, fmt.Sprintf("%s has no labels to select it by, so it is identified by its IP address", ep))
+	}
+	return notes
+}
+
+// suggestedPolicies returns the suggested policies, sorted by name.
+func (s *suggester) suggestedPolicies(prefix string, order *float64, action string) []*api.Policy {
+	sels := make([]string, 0, len(s.policies))
+	for sel := range s.policies {
+		sels = append(sels, sel)
+	}
+	sort.Strings(sels)
+
+	// Name each policy from its selector, adding a suffix where names would clash.
+	used := map[string]bool{}
+	policies := []*api.Policy{}
+	for _, sel := range sels {
+		name := prefix + policyNameFromSelector(sel)
+		for i := 2; used[name]; i++ {
+			name = fmt.Sprintf("%s%s-%d", prefix, policyNameFromSelector(sel), i)
+		}
+		used[name] = true
+
+		sp := s.policies[sel]
+		p := api.NewPolicy()
+		p.Metadata.Name = name
+		p.Spec.Order = order
+		p.Spec.Selector = sel
+		p.Spec.IngressRules = suggestedRules(sp.ingress, true, action)
+		p.Spec.EgressRules = suggestedRules(sp.egress, false, action)
+		policies = append(policies, p)
+	}
+	sort.Sort(suggestedPoliciesByName(policies))
+	return policies
+}
+
+type suggestedPoliciesByName []*api.Policy
+
+func (p suggestedPoliciesByName) Len() int      { return len(p) }
+func (p suggestedPoliciesByName) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p suggestedPoliciesByName) Less(i, j int) bool {
+	return p[i].Metadata.Name < p[j].Metadata.Name
+}
+
+// policyNameFromSelector returns a policy name derived from the label values in the
+// selector, containing only lower case letters, digits, '-' and '.'.
+func policyNameFromSelector(sel string) string {
+	parts := []string{}
+	for _, term := range strings.Split(sel, " && ") {
+		kv := strings.SplitN(term, " == ", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		parts = append(parts, sanitizeName(kv[0])+"-"+sanitizeName(strings.Trim(kv[1], "'")))
+	}
+	return strings.Join(parts, ".")
+}
+
+// sanitizeName returns the string in lower case, with each character that is not a letter
+// or digit replaced by '-'.
+func sanitizeName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '-'
+	}, s)
+}
+
+// suggestedRules returns the rules, sorted by peer and protocol.  The peer is the source
+// of ingress rules and the destination of egress rules.
+func suggestedRules(rules map[suggestRuleKey]*suggestRule, ingress bool, action string) []api.Rule {
+	keys := make([]suggestRuleKey, 0, len(rules))
+	for k := range rules {
+		keys = append(keys, k)
+	}
+	sort.Sort(suggestRuleKeys(keys))
+
+	result := []api.Rule{}
+	for _, k := range keys {
+		sr := rules[k]
+		proto := sr.protocol
+		r := api.Rule{Action: action, Protocol: &proto}
+		peer := &r.Destination
+		if ingress {
+			peer = &r.Source
+		}
+		if sr.peer.ip != nil {
+			peer.Net = hostNet(sr.peer.ip)
+		} else {
+			peer.Selector = sr.peer.selector
+		}
+		if sr.icmpType != nil {
+			t := *sr.icmpType
+			r.ICMP = &api.ICMPFields{Type: &t}
+		}
+		r.Destination.Ports = portRanges(sr.ports)
+		result = append(result, r)
+	}
+	return result
+}
+
+type suggestRuleKeys []suggestRuleKey
+
+func (k suggestRuleKeys) Len() int      { return len(k) }
+func (k suggestRuleKeys) Swap(i, j int) { k[i], k[j] = k[j], k[i] }
+func (k suggestRuleKeys) Less(i, j int) bool {
+	if k[i].peer != k[j].peer {
+		return k[i].peer < k[j].peer
+	}
+	if k[i].protocol != k[j].protocol {
+		return k[i].protocol < k[j].protocol
+	}
+	return k[i].icmpType < k[j].icmpType
+}
+
+// hostNet returns the network containing only the IP address.
+func hostNet(ip net.IP) *cnet.IPNet {
+	bits := 128
+	if ip.To4() != nil {
+		ip = ip.To4()
+		bits = 32
+	}
+	return &cnet.IPNet{IPNet: net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}}
+}
+
+// portRanges returns the ports as a sorted list of port ranges, combining consecutive
+// ports into a single range.
+func portRanges(ports map[int]bool) []numorstring.Port {
+	if len(ports) == 0 {
+		return nil
+	}
+	sorted := make([]int, 0, len(ports))
+	for p := range ports {
+		sorted = append(sorted, p)
+	}
+	sort.Ints(sorted)
+
+	ranges := []numorstring.Port{}
+	for i := 0; i < len(sorted); {
+		j := i
+		for j+1 < len(sorted) && sorted[j+1] == sorted[j]+1 {
+			j++
+		}
+		if i == j {
+			ranges = append(ranges, numorstring.SinglePort(uint16(sorted[i])))
+		} else {
+			pr, _ := numorstring.PortFromRange(uint16(sorted[i]), uint16(sorted[j]))
+			ranges = append(ranges, pr)
+		}
+		i = j + 1
+	}
+	return ranges
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package policy
+
+import (
+	"net"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+
+	"github.com/projectcalico/libcalico-go/lib/numorstring"
+)
+
+var _ = Describe("Test parse conntrack", func() {
+	It("should parse the /proc/net/nf_conntrack format", func() {
+		conns, err := parseConntrack(strings.NewReader(
+			"ipv4     2 tcp      6 431999 ESTABLISHED src=10.0.0.1 dst=10.0.0.2 sport=40000 dport=80 " +
+				"src=10.0.0.2 dst=10.0.0.1 sport=80 dport=40000 [ASSURED] mark=0 zone=0 use=2\n"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(conns).To(HaveLen(1))
+		Expect(conns[0].protocol.String()).To(Equal("tcp"))
+		Expect(conns[0].src.Equal(net.ParseIP("10.0.0.1"))).To(BeTrue())
+		Expect(conns[0].dst.Equal(net.ParseIP("10.0.0.2"))).To(BeTrue())
+		Expect(*conns[0].port).To(Equal(80))
+		Expect(conns[0].icmpType).To(BeNil())
+	})
+
+	It("should parse the conntrack -L format", func() {
+		conns, err := parseConntrack(strings.NewReader(
+			"udp      17 29 src=fd00::1 dst=fd00::2 sport=5353 dport=53 [UNREPLIED] " +
+				"src=fd00::2 dst=fd00::1 sport=53 dport=5353 mark=0 use=1\n"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(conns).To(HaveLen(1))
+		Expect(conns[0].protocol.String()).To(Equal("udp"))
+		Expect(conns[0].src.Equal(net.ParseIP("fd00::1"))).To(BeTrue())
+		Expect(conns[0].dst.Equal(net.ParseIP("fd00::2"))).To(BeTrue())
+		Expect(*conns[0].port).To(Equal(53))
+	})
+
+	It("should parse the ICMP type and omit the port", func() {
+		conns, err := parseConntrack(strings.NewReader(
+			"icmp     1 29 src=10.0.0.1 dst=10.0.0.2 type=8 code=0 id=1 " +
+				"src=10.0.0.2 dst=10.0.0.1 type=0 code=0 id=1 mark=0 use=1\n"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(conns).To(HaveLen(1))
+		Expect(conns[0].protocol.String()).To(Equal("icmp"))
+		Expect(conns[0].port).To(BeNil())
+		Expect(*conns[0].icmpType).To(Equal(8))
+	})
+
+	It("should skip lines that are not connections", func() {
+		conns, err := parseConntrack(strings.NewReader(
+			"\n" +
+				"conntrack v1.4.4 (conntrack-tools): 2 flow entries have been shown.\n" +
+				"tcp      6 431999 ESTABLISHED src=10.0.0.1 dst=10.0.0.2 sport=40000 dport=443\n" +
+				"tcp      6 431999 ESTABLISHED src=10.0.0.1 sport=40000 dport=443\n"))
+		Expect(err).NotTo(HaveOccurred())
+		Expect(conns).To(HaveLen(1))
+		Expect(*conns[0].port).To(Equal(443))
+	})
+})
+
+var _ = DescribeTable("Test port ranges",
+	func(ports []int, expected []numorstring.Port) {
+		set := map[int]bool{}
+		for _, p := range ports {
+			set[p] = true
+		}
+		Expect(portRanges(set)).To(Equal(expected))
+	},
+	Entry("no ports", []int{}, nil),
+	Entry("a single port", []int{80}, []numorstring.Port{numorstring.SinglePort(80)}),
+	Entry("separate ports in order", []int{443, 80},
+		[]numorstring.Port{numorstring.SinglePort(80), numorstring.SinglePort(443)}),
+	Entry("consecutive ports combined into a range", []int{8002, 8000, 8001},
+		[]numorstring.Port{portRange(8000, 8002)}),
+	Entry("ranges and single ports", []int{22, 8000, 8001, 9000, 9001, 9002},
+		[]numorstring.Port{numorstring.SinglePort(22), portRange(8000, 8001), portRange(9000, 9002)}),
+)
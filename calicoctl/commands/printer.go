@@ -16,13 +16,11 @@ package commands
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
-	"reflect"
 	"strings"
 
-	"bytes"
 	"encoding/json"
-	"os"
 	"text/tabwriter"
 	"text/template"
 
@@ -32,15 +30,22 @@ import (
 	"github.com/projectcalico/libcalico-go/lib/api/unversioned"
 )
 
+// resourcePrinter is implemented by each of the get output formats.  The resources are
+// written to the supplied writer, and any error encountered formatting or writing the
+// output is returned to the caller.
+//
+// When watching resources, the printEvent method is used to write each change to a
+// resource after the initial set of resources have been written using print.
 type resourcePrinter interface {
-	print(resources []unversioned.Resource) error
+	print(w io.Writer, resources []unversioned.Resource) error
+	printEvent(w io.Writer, event watchEvent) error
 }
 
 // resourcePrinterJSON implements the resourcePrinter interface and is used to display
 // a slice of resources in JSON format.
 type resourcePrinterJSON struct{}
 
-func (r resourcePrinterJSON) print(resources []unversioned.Resource) error {
+func (r resourcePrinterJSON) print(w io.Writer, resources []unversioned.Resource) error {
 	// The supplied slice of resources may contain actual resource types as well as
 	// resource lists (which themselves contain a slice of actual resources).
 	// For simplicity, expand any resource lists so that we have a flat slice of
@@ -48,8 +53,18 @@ func (r resourcePrinterJSON) print(resources []unversioned.Resource) error {
 	resources = convertToSliceOfResources(resources)
 	if output, err := json.MarshalIndent(resources, "", "  "); err != nil {
 		return err
-	} else {
-		fmt.Printf("%s\n", string(output))
+	} else if _, err = fmt.Fprintf(w, "%s\n", string(output)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// printEvent writes a single JSON document for the event.
+func (r resourcePrinterJSON) printEvent(w io.Writer, event watchEvent) error {
+	if output, err := json.MarshalIndent(event, "", "  "); err != nil {
+		return err
+	} else if _, err = fmt.Fprintf(w, "%s\n", string(output)); err != nil {
+		return err
 	}
 	return nil
 }
@@ -58,7 +73,7 @@ func (r resourcePrinterJSON) print(resources []unversioned.Resource) error {
 // a slice of resources in YAML format.
 type resourcePrinterYAML struct{}
 
-func (r resourcePrinterYAML) print(resources []unversioned.Resource) error {
+func (r resourcePrinterYAML) print(w io.Writer, resources []unversioned.Resource) error {
 	// The supplied slice of resources may contain actual resource types as well as
 	// resource lists (which themselves contain a slice of actual resources).
 	// For simplicity, expand any resource lists so that we have a flat slice of
@@ -66,8 +81,18 @@ func (r resourcePrinterYAML) print(resources []unversioned.Resource) error {
 	resources = convertToSliceOfResources(resources)
 	if output, err := yaml.Marshal(resources); err != nil {
 		return err
-	} else {
-		fmt.Printf("%s", string(output))
+	} else if _, err = fmt.Fprintf(w, "%s", string(output)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// printEvent writes a single YAML document for the event.
+func (r resourcePrinterYAML) printEvent(w io.Writer, event watchEvent) error {
+	if output, err := yaml.Marshal(event); err != nil {
+		return err
+	} else if _, err = fmt.Fprintf(w, "---\n%s", string(output)); err != nil {
+		return err
 	}
 	return nil
 }
@@ -85,12 +110,27 @@ type resourcePrinterTable struct {
 	wide bool
 }
 
-func (r resourcePrinterTable) print(resources []unversioned.Resource) error {
+func (r resourcePrinterTable) print(w io.Writer, resources []unversioned.Resource) error {
 	log.Infof("Output in table format (wide=%v)", r.wide)
+
+	// If the resources are of more than one kind, title each table with the kind so
+	// that the tables can be distinguished.
+	kinds := make(map[string]bool)
+	for _, resource := range resources {
+		kinds[tableKind(resource)] = true
+	}
+	titled := len(kinds) > 1
+
 	for _, resource := range resources {
 		// Get the resource manager for the resource type.
 		rm := resourcemgr.GetResourceManager(resource)
 
+		if titled {
+			if _, err := fmt.Fprintf(w, "%s:\n", tableKind(resource)); err != nil {
+				return err
+			}
+		}
+
 		// If no headings have been specified then we must be using the default
 		// headings for that resource type.
 		headings := r.headings
@@ -104,100 +144,154 @@ func (r resourcePrinterTable) print(resources []unversioned.Resource) error {
 			return err
 		}
 
-		// Convert the template string into a template - we need to include the join
-		// function.
-		fns := template.FuncMap{
-			"join": join,
-		}
-		tmpl, err := template.New("get").Funcs(fns).Parse(tpls)
+		// Convert the template string into a template - we need to include the template
+		// functions.
+		tmpl, err := template.New("get").Funcs(templateFuncMap()).Parse(tpls)
 		if err != nil {
-			panic(err)
+			return err
 		}
 
 		// Use a tabwriter to write out the teplate - this provides better formatting.
-		writer := tabwriter.NewWriter(os.Stdout, 5, 1, 3, ' ', 0)
-		err = tmpl.Execute(writer, resource)
-		if err != nil {
-			panic(err)
+		writer := tabwriter.NewWriter(w, 5, 1, 3, ' ', 0)
+		if err = tmpl.Execute(writer, resource); err != nil {
+			return err
 		}
-		writer.Flush()
-
-		// Templates for ps format are internally defined and therefore we should not
-		// hit errors writing the table formats.
-		if err != nil {
-			panic(err)
+		if err = writer.Flush(); err != nil {
+			return err
 		}
 
 		// Leave a gap after each table.
-		fmt.Printf("\n")
+		if _, err = fmt.Fprintf(w, "\n"); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
+// printEvent writes a table row for the changed resource, prefixed with the event type.
+// The table headings are not repeated for each event.
+func (r resourcePrinterTable) printEvent(w io.Writer, event watchEvent) error {
+	rm := resourcemgr.GetResourceManager(event.Object)
+	headings := r.headings
+	if r.headings == nil {
+		headings = rm.GetTableDefaultHeadings(r.wide)
+	}
+	tpls, err := rm.GetTableRowTemplate(headings)
+	if err != nil {
+		return err
+	}
+	tmpl, err := template.New("get").Funcs(templateFuncMap()).Parse("{{.Type}}\t{{with .Object}}" + tpls + "{{end}}")
+	if err != nil {
+		return err
+	}
+	writer := tabwriter.NewWriter(w, 5, 1, 3, ' ', 0)
+	if err = tmpl.Execute(writer, event); err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+// tableKind returns the kind of resource displayed in the table for the supplied
+// resource.  For a resource list this is the kind of the resources in the list.
+func tableKind(resource unversioned.Resource) string {
+	return strings.TrimSuffix(resource.GetTypeMetadata().Kind, "List")
+}
+
 // resourcePrinterTemplateFile implements the resourcePrinter interface and is used to display
 // a slice of resources using a user-defined go-lang template specified in a file.
 type resourcePrinterTemplateFile struct {
 	templateFile string
+
+	// Execute the template against the raw results rather than the templateData.
+	legacy bool
 }
 
-func (r resourcePrinterTemplateFile) print(resources []unversioned.Resource) error {
+func (r resourcePrinterTemplateFile) print(w io.Writer, resources []unversioned.Resource) error {
 	template, err := ioutil.ReadFile(r.templateFile)
 	if err != nil {
 		return err
 	}
-	rp := resourcePrinterTemplate{template: string(template)}
-	return rp.print(resources)
+	rp := resourcePrinterTemplate{template: string(template), legacy: r.legacy}
+	return rp.print(w, resources)
+}
+
+func (r resourcePrinterTemplateFile) printEvent(w io.Writer, event watchEvent) error {
+	template, err := ioutil.ReadFile(r.templateFile)
+	if err != nil {
+		return err
+	}
+	rp := resourcePrinterTemplate{template: string(template), legacy: r.legacy}
+	return rp.printEvent(w, event)
 }
 
 // resourcePrinterTemplate implements the resourcePrinter interface and is used to display
 // a slice of resources using a user-defined go-lang template string.
 type resourcePrinterTemplate struct {
 	template string
+
+	// Execute the template against the raw results rather than the templateData.
+	legacy bool
 }
 
-func (r resourcePrinterTemplate) print(resources []unversioned.Resource) error {
-	// We include a join function in the template as it's useful for multi
-	// value columns.
-	fns := template.FuncMap{
-		"join": join,
-	}
-	tmpl, err := template.New("get").Funcs(fns).Parse(r.template)
-	if err != nil {
-		return err
+// templateData is the root object that user-defined templates are executed against.
+type templateData struct {
+	// The kind of the resources in Items, or "List" if the results contain more than
+	// one kind of resource.
+	Kind string
+
+	// The type of change (ADDED, MODIFIED or DELETED) when watching resources, in which
+	// case Items contains the single changed resource.  Blank when not watching.
+	Type string
+
+	// The resources.  Any resource lists in the results are expanded, so this is always
+	// a flat slice of real resources, as per the YAML and JSON output formats.
+	Items []unversioned.Resource
+}
+
+// newTemplateData creates the templateData from a slice of resources and resource lists.
+func newTemplateData(resources []unversioned.Resource) templateData {
+	td := templateData{Items: convertToSliceOfResources(resources)}
+	for _, r := range td.Items {
+		kind := r.GetTypeMetadata().Kind
+		if td.Kind == "" {
+			td.Kind = kind
+		} else if td.Kind != kind {
+			td.Kind = "List"
+			break
+		}
 	}
+	return td
+}
 
-	err = tmpl.Execute(os.Stdout, resources)
-	if err != nil {
-		return err
+func (r resourcePrinterTemplate) print(w io.Writer, resources []unversioned.Resource) error {
+	// In legacy mode the template is executed against the raw results, which may
+	// contain resource lists.
+	if r.legacy {
+		return r.execute(w, resources)
 	}
-	return nil
+	return r.execute(w, newTemplateData(resources))
 }
 
-// join is similar to strings.Join() but takes an arbitrary slice of interfaces and converts
-// each to its string represenation and joins them together with the provided separator
-// string.
-func join(items interface{}, separator string) string {
-	// If this is a slice of strings - just use the strings.Join function.
-	switch s := items.(type) {
-	case []string:
-		return strings.Join(s, separator)
-	}
-
-	// Otherwise, provided this is a slice, just convert each item to a string and
-	// join together.
-	switch reflect.TypeOf(items).Kind() {
-	case reflect.Slice:
-		slice := reflect.ValueOf(items)
-		buf := new(bytes.Buffer)
-		for i := 0; i < slice.Len(); i++ {
-			if i > 0 {
-				buf.WriteString(separator)
-			}
-			fmt.Fprint(buf, slice.Index(i).Interface())
-		}
-		return buf.String()
+// printEvent executes the template against the changed resource.  In legacy mode the
+// template is executed against a slice containing the changed resource, otherwise the
+// templateData includes the type of change.
+func (r resourcePrinterTemplate) printEvent(w io.Writer, event watchEvent) error {
+	resources := []unversioned.Resource{event.Object}
+	if r.legacy {
+		return r.execute(w, resources)
 	}
+	td := newTemplateData(resources)
+	td.Type = string(event.Type)
+	return r.execute(w, td)
+}
 
-	// The supplied items is not a slice - so just convert to a string.
-	return fmt.Sprint(items)
+// execute parses the template and executes it against the supplied data.
+func (r resourcePrinterTemplate) execute(w io.Writer, data interface{}) error {
+	// We include the curated set of template functions (see templatefuncs.go), e.g. join
+	// is useful for multi value columns.
+	tmpl, err := template.New("get").Funcs(templateFuncMap()).Parse(r.template)
+	if err != nil {
+		return err
+	}
+	return tmpl.Execute(w, data)
 }
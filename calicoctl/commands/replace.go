@@ -28,7 +28,8 @@ import (
 
 func Replace(args []string) {
 	doc := constants.DatastoreIntro + `Usage:
-  calicoctl replace --filename=<FILENAME> [--config=<CONFIG>]
+  calicoctl replace --filename=<FILENAME> [--parallelism=<N>]
+                    [--config=<CONFIG>]
 
 Examples:
   # Replace a policy using the data in policy.yaml.
@@ -41,6 +42,8 @@ Options:
   -h --help                  Show this screen.
   -f --filename=<FILENAME>   Filename to use to replace the resource.  If set
                              to "-" loads from stdin.
+     --parallelism=<N>       The number of resources to replace concurrently.
+                             [default: 1]
   -c --config=<CONFIG>       Path to the file containing connection
                              configuration in YAML or JSON format.
                              [default: /etc/calico/calicoctl.cfg]
@@ -49,8 +52,7 @@ Description:
   The replace command is used to replace a set of resources by filename or
   stdin.  JSON and YAML formats are accepted.
 
-  Valid resource types are node, bgpPeer, hostEndpoint, workloadEndpoint,
-  ipPool, policy, and profile.
+  The valid resource types are listed by 'calicoctl api-resources'.
 
   Attempting to replace a resource that does not exist is treated as a
   terminating error.
@@ -64,6 +66,14 @@ Description:
 
   When replacing a resource, the complete resource spec must be provided, it is
   not sufficient to supply only the fields that are being updated.
+
+  The --parallelism option sets the number of resources that are replaced
+  concurrently.  Consecutive resources of the same type are replaced
+  concurrently, and each group of resources is completed before the next group
+  is started, so that resources are replaced after the resources they depend on.
+  Results are reported in the order the resources are specified and progress is
+  written to stderr.  When processing concurrently, resources that follow a
+  failed resource in the same group may also have been replaced.
 `
 	parsedArgs, err := docopt.Parse(doc, args, true, "", false, false)
 	if err != nil {
@@ -98,15 +108,7 @@ Description:
 			fmt.Printf("Successfully replaced %d resource(s)\n", results.numHandled)
 		}
 	} else {
-		fmt.Printf("Partial success: ")
-		if results.singleKind != "" {
-			fmt.Printf("replaced the first %d out of %d '%s' resources:\n",
-				results.numHandled, results.numResources, results.singleKind)
-		} else {
-			fmt.Printf("replaced the first %d out of %d resources:\n",
-				results.numHandled, results.numResources)
-		}
-		fmt.Printf("Hit error: %v\n", results.err)
+		printPartialSuccess(results, "replaced")
 		os.Exit(1)
 	}
 }
@@ -17,20 +17,20 @@ package commands
 import (
 	"errors"
 	"fmt"
+	"os"
 	"reflect"
+	"strconv"
 	"strings"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/ghodss/yaml"
 	"github.com/projectcalico/calico-containers/calicoctl/commands/argutils"
+	"github.com/projectcalico/calico-containers/calicoctl/commands/audit"
 	"github.com/projectcalico/calico-containers/calicoctl/commands/clientmgr"
 	"github.com/projectcalico/calico-containers/calicoctl/resourcemgr"
-	"github.com/projectcalico/libcalico-go/lib/api"
 	"github.com/projectcalico/libcalico-go/lib/api/unversioned"
 	"github.com/projectcalico/libcalico-go/lib/client"
 	calicoErrors "github.com/projectcalico/libcalico-go/lib/errors"
-	"github.com/projectcalico/libcalico-go/lib/net"
-	"github.com/projectcalico/libcalico-go/lib/scope"
 )
 
 type action int
@@ -43,6 +43,15 @@ const (
 	actionList
 )
 
+// The names of the actions that modify the datastore, as used in the audit log and the
+// allow list of the calicoctl config.
+var auditActions = map[action]string{
+	actionApply:  "apply",
+	actionCreate: "create",
+	actionUpdate: "replace",
+	actionDelete: "delete",
+}
+
 // Convert loaded resources to a slice of resources for easier processing.
 // The loaded resources may be a slice containing resources and resource lists, or
 // may be a single resource or a single resource list.  This function handles the
@@ -92,73 +101,46 @@ func convertToSliceOfResources(loaded interface{}) []unversioned.Resource {
 	return r
 }
 
-// getResourceFromArguments returns a resource instance from the command line arguments.
-func getResourceFromArguments(args map[string]interface{}) (unversioned.Resource, error) {
-	kind := args["<KIND>"].(string)
-	name := argutils.ArgStringOrBlank(args, "<NAME>")
-	node := argutils.ArgStringOrBlank(args, "--node")
-	workload := argutils.ArgStringOrBlank(args, "--workload")
-	orchestrator := argutils.ArgStringOrBlank(args, "--orchestrator")
-	resScope := argutils.ArgStringOrBlank(args, "--scope")
-	switch strings.ToLower(kind) {
-	case "node", "nodes":
-		p := api.NewNode()
-		p.Metadata.Name = name
-		return *p, nil
-	case "hostendpoint", "hostendpoints":
-		h := api.NewHostEndpoint()
-		h.Metadata.Name = name
-		h.Metadata.Node = node
-		return *h, nil
-	case "workloadendpoint", "workloadendpoints":
-		h := api.NewWorkloadEndpoint()
-		h.Metadata.Name = name
-		h.Metadata.Orchestrator = orchestrator
-		h.Metadata.Workload = workload
-		h.Metadata.Node = node
-		return *h, nil
-	case "profile", "profiles":
-		p := api.NewProfile()
-		p.Metadata.Name = name
-		return *p, nil
-	case "policy", "policies":
-		p := api.NewPolicy()
-		p.Metadata.Name = name
-		return *p, nil
-	case "ippool", "ippools":
-		p := api.NewIPPool()
-		if name != "" {
-			_, cidr, err := net.ParseCIDR(name)
-			if err != nil {
-				return nil, err
+// getResourcesFromArguments returns the resource instances from the command line
+// arguments.  The <KIND> argument may be a comma-separated list of kinds, or "all" to
+// indicate every kind that may be listed.  A name may only be specified when a single kind is requested,
+// the other identifiers are applied to each kind that uses them.
+func getResourcesFromArguments(args map[string]interface{}) ([]unversioned.Resource, error) {
+	kinds := strings.Split(args["<KIND>"].(string), ",")
+	if len(kinds) == 1 && strings.ToLower(kinds[0]) == "all" {
+		kinds = []string{}
+		for _, ki := range resourcemgr.Kinds() {
+			if ki.Listable() {
+				kinds = append(kinds, ki.Kind)
 			}
-			p.Metadata.CIDR = *cidr
 		}
-		return *p, nil
-	case "bgppeer", "bgppeers":
-		p := api.NewBGPPeer()
-		if name != "" {
-			err := p.Metadata.PeerIP.UnmarshalText([]byte(name))
-			if err != nil {
-				return nil, err
-			}
-		}
-		p.Metadata.Node = node
-		switch resScope {
-		case "node":
-			p.Metadata.Scope = scope.Node
-		case "global":
-			p.Metadata.Scope = scope.Global
-		case "":
-			p.Metadata.Scope = scope.Undefined
-		default:
-			return nil, fmt.Errorf("Unrecognized scope '%s', must be one of: global, node", resScope)
+	}
+	if len(kinds) > 1 && argutils.ArgStringOrBlank(args, "<NAME>") != "" {
+		return nil, errors.New("a name may only be specified with a single resource type")
+	}
+
+	resources := make([]unversioned.Resource, 0, len(kinds))
+	for _, kind := range kinds {
+		r, err := getResourceFromArguments(args, kind)
+		if err != nil {
+			return nil, err
 		}
-		return *p, nil
+		resources = append(resources, r)
+	}
+	return resources, nil
+}
 
-	default:
-		return nil, fmt.Errorf("Resource type '%s' is not supported", kind)
+// getResourceFromArguments returns a resource instance of the specified kind using the
+// identifiers in the command line arguments.  The kind may be any of the names of a kind
+// registered with resourcemgr.
+func getResourceFromArguments(args map[string]interface{}, kind string) (unversioned.Resource, error) {
+	ids := map[string]string{
+		resourcemgr.IdentifierName.Arg: argutils.ArgStringOrBlank(args, resourcemgr.IdentifierName.Arg),
+	}
+	for _, id := range resourcemgr.IdentifierOptions() {
+		ids[id.Arg] = argutils.ArgStringOrBlank(args, id.Arg)
 	}
+	return resourcemgr.NewResourceFromIdentifiers(kind, ids)
 }
 
 // commandResults contains the results from executing a CLI command
@@ -182,6 +164,39 @@ type commandResults struct {
 
 	// The results returned from each invocation
 	resources []unversioned.Resource
+
+	// The outcome of each resource, in the order the resources were supplied.
+	outcomes []resourceOutcome
+}
+
+// printPartialSuccess prints the number of resources that were configured, followed by the
+// outcome of each resource in the order the resources were supplied.  The resources are
+// processed concurrently with --parallelism, so the resources that were configured are
+// not necessarily the first resources.
+func printPartialSuccess(results commandResults, verb string) {
+	fmt.Printf("Partial success: ")
+	if results.singleKind != "" {
+		fmt.Printf("%s %d out of %d '%s' resources:\n",
+			verb, results.numHandled, results.numResources, results.singleKind)
+	} else {
+		fmt.Printf("%s %d out of %d resources:\n",
+			verb, results.numHandled, results.numResources)
+	}
+	for _, o := range results.outcomes {
+		name, err := resourceKey(o.supplied)
+		if err != nil {
+			name = o.supplied.GetTypeMetadata().Kind
+		}
+		switch {
+		case !o.done:
+			fmt.Printf("  %s: not attempted\n", name)
+		case o.err != nil:
+			fmt.Printf("  %s: failed: %v\n", name, o.err)
+		default:
+			fmt.Printf("  %s: %s\n", name, verb)
+		}
+	}
+	fmt.Printf("Hit error: %v\n", results.err)
 }
 
 // executeConfigCommand is main function called by all of the resource management commands
@@ -207,16 +222,16 @@ func executeConfigCommand(args map[string]interface{}, action action) commandRes
 		}
 
 		resources = convertToSliceOfResources(r)
-	} else if r, err := getResourceFromArguments(args); err != nil {
-		// Filename is not specific so extract the resource from the arguments.  This
+	} else if resources, err = getResourcesFromArguments(args); err != nil {
+		// Filename is not specific so extract the resources from the arguments.  This
 		// is only useful for delete and get functions - but we don't need to check that
 		// here since the command syntax requires a filename for the other resource
 		// management commands.
 		return commandResults{err: err}
-	} else {
-		// We extracted a single resource type with identifiers from the CLI, convert to
-		// a list for simpler handling.
-		resources = []unversioned.Resource{r}
+	} else if len(resources) > 1 && action != actionList {
+		// Multiple resource types may only be specified on the command line when
+		// getting resources.
+		return commandResults{err: errors.New("only a single resource type may be specified")}
 	}
 
 	if len(resources) == 0 {
@@ -232,13 +247,12 @@ func executeConfigCommand(args map[string]interface{}, action action) commandRes
 		log.Debugf("Data: %s", string(d))
 	}
 
-	// Load the client config and connect.
-	cf := args["--config"].(string)
-	client, err := clientmgr.NewClient(cf)
-	if err != nil {
-		return commandResults{err: err}
+	parallelism := 1
+	if p := argutils.ArgStringOrBlank(args, "--parallelism"); p != "" {
+		if parallelism, err = strconv.Atoi(p); err != nil || parallelism < 1 {
+			return commandResults{err: fmt.Errorf("invalid parallelism '%s'", p)}
+		}
 	}
-	log.Infof("Client: %v", client)
 
 	// Initialise the command results with the number of resources and the name of the
 	// kind of resource (if only dealing with a single resource).
@@ -254,39 +268,133 @@ func executeConfigCommand(args map[string]interface{}, action action) commandRes
 		results.singleKind = kind
 	}
 
-	// Now execute the command on each resource in order, exiting as soon as we hit an
-	// error.
-	for _, r := range resources {
-		r, err = executeResourceAction(args, client, r, action)
-		if err != nil {
-			results.err = err
-			break
+	// Load the calicoctl settings which determine whether the action is permitted and
+	// whether it is audited.  Only actions that modify the datastore are audited.
+	cf := args["--config"].(string)
+	ctlCfg, err := clientmgr.LoadCalicoctlConfig(cf)
+	if err != nil {
+		return commandResults{err: err}
+	}
+	var auditLog *audit.Logger
+	if name, ok := auditActions[action]; ok {
+		auditLog = audit.NewLogger(ctlCfg.AuditLog)
+
+		// Check the local policy permits the action on every resource before accessing
+		// the datastore, so that a partly permitted set of resources is not partly
+		// applied.  The rejected attempt is still audited.
+		for _, r := range resources {
+			if err := ctlCfg.Permitted(r.GetTypeMetadata().Kind, name); err != nil {
+				ar := audit.Resource{Kind: r.GetTypeMetadata().Kind}
+				ar.Identifiers, _ = resourceIdentifiers(r)
+				if lerr := auditLog.Log(name, []audit.Resource{ar}, 0, err); lerr != nil {
+					fmt.Fprintf(os.Stderr, "Failed to write audit log: %v\n", lerr)
+				}
+				results.err = err
+				return results
+			}
+		}
+	}
+	auditResources := []audit.Resource{}
+
+	// Connect to the datastore.
+	client, err := clientmgr.NewClient(cf)
+	if err != nil {
+		return commandResults{err: err}
+	}
+	log.Infof("Client: %v", client)
+
+	// Now execute the command on each resource, stopping as soon as we hit an error.
+	// The outcomes are collated in the order of the resources.
+	outcomes := processResources(resources, parallelism, func(r unversioned.Resource) resourceOutcome {
+		var o resourceOutcome
+		if auditLog.Enabled() {
+			o.audit = newAuditResource(client, r)
+		}
+		o.resource, o.err = executeResourceAction(args, client, r, action)
+		if auditLog.Enabled() && o.err == nil && action != actionDelete {
+			o.audit.After = o.resource
+		}
+		return o
+	})
+	for _, o := range outcomes {
+		if !o.done {
+			continue
 		}
-		results.resources = append(results.resources, r)
+		if auditLog.Enabled() {
+			auditResources = append(auditResources, o.audit)
+		}
+		if o.err != nil {
+			if results.err == nil {
+				results.err = o.err
+			}
+			continue
+		}
+		results.resources = append(results.resources, o.resource)
 		results.numHandled = results.numHandled + 1
 	}
+	results.outcomes = outcomes
+
+	// A failure to write the audit log does not alter the results of the command, since
+	// the datastore has already been updated.
+	if err := auditLog.Log(auditActions[action], auditResources, results.numHandled, results.err); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write audit log: %v\n", err)
+	}
 
 	return results
 }
 
+// newAuditResource returns the audit record for the resource, containing the identifiers
+// and current state of the resource in the datastore.
+func newAuditResource(client *client.Client, resource unversioned.Resource) audit.Resource {
+	ar := audit.Resource{Kind: resource.GetTypeMetadata().Kind}
+	ar.Identifiers, _ = resourceIdentifiers(resource)
+
+	// Listing a fully identified resource returns a list containing only that resource
+	// (if it exists).  Errors are ignored, the before state is simply omitted.
+	l, err := clientmgr.Read("get the current "+ar.Kind+" resource", func() (interface{}, error) {
+		return resourcemgr.GetResourceManager(resource).List(client, resource)
+	})
+	if err == nil {
+		if existing := convertToSliceOfResources(l); len(existing) == 1 {
+			ar.Before = existing[0]
+		}
+	} else {
+		log.Infof("Unable to get current state of resource for audit log: %v", err)
+	}
+	return ar
+}
+
 // execureResourceAction fans out the specific resource action to the appropriate method
 // on the ResourceManager for the specific resource.
 func executeResourceAction(args map[string]interface{}, client *client.Client, resource unversioned.Resource, action action) (unversioned.Resource, error) {
 	rm := resourcemgr.GetResourceManager(resource)
-	var err error
 	var resourceOut unversioned.Resource
+	var out interface{}
+	var err error
 
-	switch action {
-	case actionApply:
-		resourceOut, err = rm.Apply(client, resource)
-	case actionCreate:
-		resourceOut, err = rm.Create(client, resource)
-	case actionUpdate:
-		resourceOut, err = rm.Update(client, resource)
-	case actionDelete:
-		resourceOut, err = rm.Delete(client, resource)
-	case actionList:
-		resourceOut, err = rm.List(client, resource)
+	// Listing is retried after a timeout, but the actions that modify the datastore are
+	// not, since the action may have been applied.
+	kind := resource.GetTypeMetadata().Kind
+	if action == actionList {
+		out, err = clientmgr.Read("list "+kind+" resources", func() (interface{}, error) {
+			return rm.List(client, resource)
+		})
+	} else {
+		out, err = clientmgr.Write(auditActions[action]+" "+kind+" resources", func() (interface{}, error) {
+			switch action {
+			case actionApply:
+				return rm.Apply(client, resource)
+			case actionCreate:
+				return rm.Create(client, resource)
+			case actionUpdate:
+				return rm.Update(client, resource)
+			default:
+				return rm.Delete(client, resource)
+			}
+		})
+	}
+	if err == nil {
+		resourceOut, _ = out.(unversioned.Resource)
 	}
 
 	// Skip over some errors depending on command line options.
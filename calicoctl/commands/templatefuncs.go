@@ -0,0 +1,251 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/ghodss/yaml"
+)
+
+// templateFunc describes a single function that is made available to the go-template
+// output formats (both user supplied templates and the built-in table templates).
+type templateFunc struct {
+	name        string
+	usage       string
+	description string
+	fn          interface{}
+}
+
+// templateFuncs is the curated set of functions available to templates.  The usage and
+// description are displayed by "calicoctl get --help-templates".
+var templateFuncs = []templateFunc{
+	{"join", "join <LIST> <SEP>", "Join the items of a list into a single string using the separator.", join},
+	{"toYaml", "toYaml <VALUE>", "Convert a value to its YAML representation.", toYAML},
+	{"toJson", "toJson <VALUE>", "Convert a value to its JSON representation.", toJSON},
+	{"default", "default <DEFAULT> <VALUE>", "Return the value, or the default if the value is empty.", defaultValue},
+	{"upper", "upper <STRING>", "Convert a string to upper case.", strings.ToUpper},
+	{"lower", "lower <STRING>", "Convert a string to lower case.", strings.ToLower},
+	{"contains", "contains <SUBSTR> <STRING>", "Return true if the string contains the substring.", contains},
+	{"hasPrefix", "hasPrefix <PREFIX> <STRING>", "Return true if the string starts with the prefix.", hasPrefix},
+	{"sortAlpha", "sortAlpha <LIST>", "Sort a list into alphabetical order of the string representation of each item.", sortAlpha},
+	{"cidrContains", "cidrContains <CIDR> <IP>", "Return true if the IP address (or CIDR) is contained within the CIDR.", cidrContains},
+	{"ipVersion", "ipVersion <IP>", "Return the IP version (4 or 6) of an IP address or CIDR, or 0 if invalid.", ipVersion},
+	{"label", "label <KEY> <LABELS>", "Return the value of a label, or an empty string if the label is not set.", label},
+	{"labels", "labels <LABELS>", "Format a labels map as a sorted, comma-separated list of key=value pairs.", labels},
+}
+
+// templateFuncMap returns the function map used when parsing templates.
+func templateFuncMap() template.FuncMap {
+	fns := template.FuncMap{}
+	for _, tf := range templateFuncs {
+		fns[tf.name] = tf.fn
+	}
+	return fns
+}
+
+// templateFuncsHelp returns the help text listing the available template functions.
+func templateFuncsHelp() string {
+	buf := new(bytes.Buffer)
+	buf.WriteString("Functions available to go-template, go-template-file and custom-columns output:\n\n")
+	width := 0
+	for _, tf := range templateFuncs {
+		if len(tf.usage) > width {
+			width = len(tf.usage)
+		}
+	}
+	for _, tf := range templateFuncs {
+		fmt.Fprintf(buf, "  %-*s  %s\n", width, tf.usage, tf.description)
+	}
+	buf.WriteString(`
+Arguments may be piped into the final parameter of a function, for example:
+  calicoctl get workloadendpoint -o go-template='{{range .Items}}` +
+		`{{.Metadata.Labels | label "app" | default "none"}}{{"\n"}}{{end}}'
+`)
+	return buf.String()
+}
+
+// join is similar to strings.Join() but takes an arbitrary slice of interfaces and converts
+// each to its string represenation and joins them together with the provided separator
+// string.
+func join(items interface{}, separator string) string {
+	// If this is a slice of strings - just use the strings.Join function.
+	switch s := items.(type) {
+	case []string:
+		return strings.Join(s, separator)
+	}
+
+	// Otherwise, provided this is a slice, just convert each item to a string and
+	// join together.
+	switch reflect.TypeOf(items).Kind() {
+	case reflect.Slice:
+		slice := reflect.ValueOf(items)
+		buf := new(bytes.Buffer)
+		for i := 0; i < slice.Len(); i++ {
+			if i > 0 {
+				buf.WriteString(separator)
+			}
+			fmt.Fprint(buf, slice.Index(i).Interface())
+		}
+		return buf.String()
+	}
+
+	// The supplied items is not a slice - so just convert to a string.
+	return fmt.Sprint(items)
+}
+
+// toYAML returns the YAML representation of the supplied value.
+func toYAML(v interface{}) (string, error) {
+	b, err := yaml.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(b), "\n"), nil
+}
+
+// toJSON returns the compact JSON representation of the supplied value.
+func toJSON(v interface{}) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// defaultValue returns the supplied value, or the default value if the supplied value
+// is empty (nil, the zero value, or an empty slice or map).
+func defaultValue(def interface{}, v interface{}) interface{} {
+	if isEmpty(v) {
+		return def
+	}
+	return v
+}
+
+// isEmpty returns true if the value is nil or the zero value for its type.  Slices and
+// maps are empty if they contain no entries.
+func isEmpty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Array, reflect.String:
+		return rv.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return rv.IsNil()
+	}
+	return reflect.DeepEqual(v, reflect.Zero(rv.Type()).Interface())
+}
+
+// contains returns true if the string representation of s contains substr.
+func contains(substr string, s interface{}) bool {
+	return strings.Contains(fmt.Sprint(s), substr)
+}
+
+// hasPrefix returns true if the string representation of s starts with prefix.
+func hasPrefix(prefix string, s interface{}) bool {
+	return strings.HasPrefix(fmt.Sprint(s), prefix)
+}
+
+// sortAlpha converts each item in the supplied slice to a string and returns the
+// sorted slice of strings.  A value that is not a slice is returned as a single item
+// slice.
+func sortAlpha(items interface{}) []string {
+	var s []string
+	if items == nil {
+		return s
+	}
+	rv := reflect.ValueOf(items)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		s = make([]string, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			s[i] = fmt.Sprint(rv.Index(i).Interface())
+		}
+	default:
+		s = []string{fmt.Sprint(items)}
+	}
+	sort.Strings(s)
+	return s
+}
+
+// cidrContains returns true if the supplied IP address is within the supplied CIDR.  The
+// IP may also be specified as a CIDR, in which case the network address is checked.
+// Both parameters may be strings or any type whose string representation is an IP
+// address or CIDR (e.g. the libcalico-go net types).
+func cidrContains(cidr interface{}, ip interface{}) (bool, error) {
+	_, ipNet, err := net.ParseCIDR(fmt.Sprint(cidr))
+	if err != nil {
+		return false, err
+	}
+	parsed := parseIPOrCIDR(fmt.Sprint(ip))
+	if parsed == nil {
+		return false, fmt.Errorf("invalid IP address: %v", ip)
+	}
+	return ipNet.Contains(parsed), nil
+}
+
+// ipVersion returns the IP version (4 or 6) of the supplied IP address or CIDR, or 0 if
+// the value is not a valid IP address or CIDR.
+func ipVersion(ip interface{}) int {
+	parsed := parseIPOrCIDR(fmt.Sprint(ip))
+	if parsed == nil {
+		return 0
+	}
+	if parsed.To4() != nil {
+		return 4
+	}
+	return 6
+}
+
+// parseIPOrCIDR parses the supplied string as an IP address, or as a CIDR in which case
+// the IP address portion of the CIDR is returned.  Returns nil if the string is not valid.
+func parseIPOrCIDR(s string) net.IP {
+	if ip := net.ParseIP(s); ip != nil {
+		return ip
+	}
+	if ip, _, err := net.ParseCIDR(s); err == nil {
+		return ip
+	}
+	return nil
+}
+
+// label returns the value of the label key from the supplied labels map, or an empty
+// string if the map is nil or the label is not set.
+func label(key string, m map[string]string) string {
+	return m[key]
+}
+
+// labels formats the supplied labels map as a comma-separated list of key=value pairs,
+// sorted by key.
+func labels(m map[string]string) string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + m[k]
+	}
+	return strings.Join(pairs, ",")
+}
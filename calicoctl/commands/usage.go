@@ -0,0 +1,97 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/projectcalico/calico-containers/calicoctl/resourcemgr"
+)
+
+// The width of the help text.
+const helpWidth = 80
+
+// identifierUsage returns the usage text for identifying a resource by kind using the
+// identifier options of the registered resource kinds, e.g.
+//
+//	[--node=<NODE>] [--workload=<WORKLOAD>] (<KIND> [<NAME>])
+//
+// The first line is not indented, subsequent lines are indented by the specified number
+// of spaces.  The start column is the column of the first character of the usage.
+func identifierUsage(start, indent int) string {
+	words := []string{}
+	for _, id := range resourcemgr.IdentifierOptions() {
+		words = append(words, "["+id.Arg+"="+id.Value+"]")
+	}
+	words = append(words, "(<KIND>", "["+resourcemgr.IdentifierName.Arg+"])")
+	return wrapWords(words, start, indent)
+}
+
+// identifierOptionsHelp returns the options help text for the identifier options of the
+// registered resource kinds.  The descriptions start at the specified column.
+func identifierOptionsHelp(column int) string {
+	buf := new(bytes.Buffer)
+	for _, id := range resourcemgr.IdentifierOptions() {
+		option := "     "
+		if id.Short != "" {
+			option = "  " + id.Short + " "
+		}
+		option += id.Arg + "=" + id.Value
+		buf.WriteString(option)
+
+		// If the option is too long to fit before the description, start the
+		// description on the following line.
+		if len(option) > column-2 {
+			buf.WriteString("\n" + strings.Repeat(" ", column))
+		} else {
+			buf.WriteString(strings.Repeat(" ", column-len(option)))
+		}
+		buf.WriteString(wrapWords(strings.Split(id.Description, " "), column, column))
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
+
+// wrapWords joins the words with spaces, wrapping the text to fit within the help text
+// width.  The first line starts at the start column, subsequent lines are indented by the
+// specified number of spaces.  An empty word adds an additional space (so that text split
+// on single spaces retains double spacing between sentences) unless at the start of a line.
+func wrapWords(words []string, start, indent int) string {
+	buf := new(bytes.Buffer)
+	col := start
+	for i, word := range words {
+		if word == "" {
+			if col != indent {
+				buf.WriteString(" ")
+				col++
+			}
+			continue
+		}
+		if i > 0 && col != indent {
+			if col+1+len(word) > helpWidth {
+				buf.Truncate(len(bytes.TrimRight(buf.Bytes(), " ")))
+				buf.WriteString("\n" + strings.Repeat(" ", indent))
+				col = indent
+			} else {
+				buf.WriteString(" ")
+				col++
+			}
+		}
+		buf.WriteString(word)
+		col += len(word)
+	}
+	return buf.String()
+}
@@ -0,0 +1,117 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package commands
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/projectcalico/libcalico-go/lib/api/unversioned"
+)
+
+type watchEventType string
+
+const (
+	watchAdded    watchEventType = "ADDED"
+	watchModified watchEventType = "MODIFIED"
+	watchDeleted  watchEventType = "DELETED"
+)
+
+// watchEvent is a single change to a resource.  For a deleted resource the Object is the
+// last known state of the resource.  For a modified resource, previous is the state of the
+// resource before the change.
+type watchEvent struct {
+	Type     watchEventType       `json:"type"`
+	Object   unversioned.Resource `json:"object"`
+	previous unversioned.Resource
+}
+
+// resourceKey returns a key that uniquely identifies the resource, derived from the kind
+// and the identifying metadata fields of the resource.  Labels are not included, so a
+// change to the labels of a resource does not change its key.
+func resourceKey(r unversioned.Resource) (string, error) {
+	ids, err := resourceIdentifiers(r)
+	if err != nil {
+		return "", err
+	}
+	paths := make([]string, 0, len(ids))
+	for path := range ids {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for i, path := range paths {
+		paths[i] = path + "=" + ids[path]
+	}
+	return r.GetTypeMetadata().Kind + "(" + strings.Join(paths, ",") + ")", nil
+}
+
+// resourceSnapshot is the state of a resource when it was last seen by the watcher.
+type resourceSnapshot struct {
+	resource unversioned.Resource
+	data     string
+}
+
+// resourceDiffer determines the changes between successive lists of resources.  The libcalico-go
+// client does not currently provide a watch API, so watches are implemented by polling the
+// datastore and diffing the results against the previous results.
+type resourceDiffer struct {
+	keys  []string
+	known map[string]resourceSnapshot
+}
+
+// newResourceDiffer creates a resourceDiffer with no known resources.
+func newResourceDiffer() *resourceDiffer {
+	return &resourceDiffer{known: make(map[string]resourceSnapshot)}
+}
+
+// update takes the current (flattened) list of resources and returns the events describing
+// the changes since the previous call.  Events are returned in the order of the supplied
+// resources, followed by the deletions in the order the deleted resources were last seen.
+func (d *resourceDiffer) update(resources []unversioned.Resource) ([]watchEvent, error) {
+	events := []watchEvent{}
+	keys := make([]string, 0, len(resources))
+	current := make(map[string]resourceSnapshot, len(resources))
+	for _, r := range resources {
+		key, err := resourceKey(r)
+		if err != nil {
+			return nil, err
+		}
+		b, err := json.Marshal(r)
+		if err != nil {
+			return nil, err
+		}
+		snapshot := resourceSnapshot{resource: r, data: string(b)}
+		keys = append(keys, key)
+		current[key] = snapshot
+
+		if previous, ok := d.known[key]; !ok {
+			events = append(events, watchEvent{Type: watchAdded, Object: r})
+		} else if previous.data != snapshot.data {
+			events = append(events, watchEvent{Type: watchModified, Object: r, previous: previous.resource})
+		}
+	}
+	for _, key := range d.keys {
+		if _, ok := current[key]; !ok {
+			events = append(events, watchEvent{Type: watchDeleted, Object: d.known[key].resource})
+		}
+	}
+
+	log.Debugf("Watch update: %d resources, %d events", len(resources), len(events))
+	d.keys = keys
+	d.known = current
+	return events, nil
+}
@@ -15,42 +15,69 @@
 package resourcemgr
 
 import (
+	"fmt"
+
 	"github.com/projectcalico/libcalico-go/lib/api"
 	"github.com/projectcalico/libcalico-go/lib/api/unversioned"
 	"github.com/projectcalico/libcalico-go/lib/client"
+	"github.com/projectcalico/libcalico-go/lib/scope"
 )
 
 func init() {
-	registerResource(
-		api.NewBGPPeer(),
-		api.NewBGPPeerList(),
-		[]string{"SCOPE", "PEERIP", "HOSTNAME", "ASN"},
-		[]string{"SCOPE", "PEERIP", "HOSTNAME", "ASN"},
-		map[string]string{
-			"SCOPE":  "{{.Metadata.Scope}}",
-			"PEERIP": "{{.Metadata.PeerIP}}",
-			"NODE":   "{{.Metadata.Node}}",
-			"ASN":    "{{.Spec.ASNumber}}",
+	Register(ResourceDefinition{
+		Resource:     api.NewBGPPeer(),
+		ResourceList: api.NewBGPPeerList(),
+		Plural:       "bgpPeers",
+		ShortNames:   []string{"peer"},
+		Identifiers:  []Identifier{IdentifierName, IdentifierScope, IdentifierNode},
+		FromIdentifiers: func(ids map[string]string) (unversioned.Resource, error) {
+			r := api.NewBGPPeer()
+			if name := ids["<NAME>"]; name != "" {
+				if err := r.Metadata.PeerIP.UnmarshalText([]byte(name)); err != nil {
+					return nil, err
+				}
+			}
+			r.Metadata.Node = ids["--node"]
+			switch ids["--scope"] {
+			case "node":
+				r.Metadata.Scope = scope.Node
+			case "global":
+				r.Metadata.Scope = scope.Global
+			case "":
+				r.Metadata.Scope = scope.Undefined
+			default:
+				return nil, fmt.Errorf("Unrecognized scope '%s', must be one of: global, node", ids["--scope"])
+			}
+			return *r, nil
+		},
+		TableHeadings:     []string{"SCOPE", "PEERIP", "HOSTNAME", "ASN"},
+		TableHeadingsWide: []string{"SCOPE", "PEERIP", "HOSTNAME", "ASN"},
+		HeadingsMap: map[string]string{
+			"SCOPE":    "{{.Metadata.Scope}}",
+			"PEERIP":   "{{.Metadata.PeerIP}}",
+			"HOSTNAME": "{{.Metadata.Node}}",
+			"NODE":     "{{.Metadata.Node}}",
+			"ASN":      "{{.Spec.ASNumber}}",
 		},
-		func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+		Apply: func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
 			r := resource.(api.BGPPeer)
 			return client.BGPPeers().Apply(&r)
 		},
-		func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+		Create: func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
 			r := resource.(api.BGPPeer)
 			return client.BGPPeers().Create(&r)
 		},
-		func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+		Update: func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
 			r := resource.(api.BGPPeer)
 			return client.BGPPeers().Update(&r)
 		},
-		func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+		Delete: func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
 			r := resource.(api.BGPPeer)
 			return nil, client.BGPPeers().Delete(r.Metadata)
 		},
-		func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+		List: func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
 			r := resource.(api.BGPPeer)
 			return client.BGPPeers().List(r.Metadata)
 		},
-	)
+	})
 }
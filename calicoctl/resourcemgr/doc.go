@@ -17,5 +17,11 @@ Package resourcemgr implements generic resource handling methods.  This includes
 	- a mechanism for creating specific resources from a JSON or YAML input.
 	- an untyped resource management interface for each resource type
 	- table template data for each resource type
+	- a registry of the resource kinds, including the names and command line
+	  identifiers of each kind.
+
+Resource kinds are registered by calling Register with a ResourceDefinition from an init
+function.  A registered kind is available to all of the calicoctl resource management
+commands.
 */
 package resourcemgr
@@ -0,0 +1,179 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resourcemgr
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// FieldInfo describes a field of a resource structure.  This is constructed by walking
+// the reflected API type registered for the resource.
+type FieldInfo struct {
+	// The name of the field in the API structure.
+	Name string
+
+	// The key used for the field in the JSON and YAML encodings of the resource.
+	Key string
+
+	// The type of the field.
+	Type string
+
+	// Whether the field is required by the validator.
+	Required bool
+
+	// The validation constraints applied to the field (from the validator tag).
+	Validation []string
+
+	// The fields contained within this field, if the field is a structure (or a
+	// slice, map or pointer to a structure).
+	Fields []FieldInfo
+}
+
+var (
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// getFieldInfo returns the FieldInfo for the field identified by the path.  An empty path
+// returns the FieldInfo for the resource itself.  Each element of the path is matched
+// against the JSON/YAML key (or the structure field name) of the field, ignoring case.
+func getFieldInfo(t reflect.Type, path []string) (FieldInfo, error) {
+	fi := FieldInfo{Name: t.Name(), Type: t.String()}
+	for i, p := range path {
+		found := false
+		for _, f := range structFields(t) {
+			if strings.EqualFold(f.Key, p) || strings.EqualFold(f.Name, p) {
+				fi = f.FieldInfo
+				t = f.elemType()
+				found = true
+				break
+			}
+		}
+		if !found {
+			return FieldInfo{}, fmt.Errorf("field '%s' does not exist", strings.Join(path[:i+1], "."))
+		}
+	}
+	fi.Fields = fieldInfos(t)
+	return fi, nil
+}
+
+// fieldInfos returns the FieldInfo for each field in the structure type t (or the structure
+// referenced by t if t is a slice, map or pointer).  Returns nil if t does not reference a
+// structure, or if the structure is encoded as a simple value.
+func fieldInfos(t reflect.Type) []FieldInfo {
+	var fields []FieldInfo
+	for _, f := range structFields(t) {
+		fields = append(fields, f.FieldInfo)
+	}
+	return fields
+}
+
+// structField is a FieldInfo along with the reflected type of the field.
+type structField struct {
+	FieldInfo
+	typ reflect.Type
+}
+
+// elemType returns the underlying type of the field, dereferencing pointers, slices and
+// maps.
+func (s structField) elemType() reflect.Type {
+	return derefType(s.typ)
+}
+
+// structFields returns the encoded fields of the structure type t.  Anonymous (embedded)
+// structures are flattened into the parent structure, as per the JSON encoder.
+func structFields(t reflect.Type) []structField {
+	t = derefType(t)
+	if t.Kind() != reflect.Struct || isEncodedAsValue(t) {
+		return nil
+	}
+
+	fields := []structField{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			// Unexported field.
+			continue
+		}
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		key := strings.Split(tag, ",")[0]
+		if f.Anonymous && key == "" {
+			// Embedded structure without a JSON name is flattened into the parent.
+			fields = append(fields, structFields(f.Type)...)
+			continue
+		}
+		if key == "" {
+			key = f.Name
+		}
+
+		required := false
+		validation := []string{}
+		for _, v := range strings.Split(f.Tag.Get("validate"), ",") {
+			switch v {
+			case "":
+			case "omitempty":
+			case "required":
+				required = true
+			default:
+				validation = append(validation, v)
+			}
+		}
+
+		fields = append(fields, structField{
+			FieldInfo: FieldInfo{
+				Name:       f.Name,
+				Key:        key,
+				Type:       f.Type.String(),
+				Required:   required,
+				Validation: validation,
+			},
+			typ: f.Type,
+		})
+	}
+	return fields
+}
+
+// derefType dereferences pointer, slice, array and map types to return the underlying
+// element type.
+func derefType(t reflect.Type) reflect.Type {
+	for {
+		switch t.Kind() {
+		case reflect.Ptr, reflect.Slice, reflect.Array, reflect.Map:
+			if isEncodedAsValue(t) {
+				return t
+			}
+			t = t.Elem()
+		default:
+			return t
+		}
+	}
+}
+
+// isEncodedAsValue returns true if the type provides its own JSON or text encoding, in
+// which case it is encoded as a simple value (e.g. an IP address or port range) rather
+// than as a structure.
+func isEncodedAsValue(t reflect.Type) bool {
+	pt := reflect.PtrTo(t)
+	return t.Implements(jsonMarshalerType) || pt.Implements(jsonMarshalerType) ||
+		t.Implements(textMarshalerType) || pt.Implements(textMarshalerType)
+}
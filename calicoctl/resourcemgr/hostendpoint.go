@@ -21,37 +21,48 @@ import (
 )
 
 func init() {
-	registerResource(
-		api.NewHostEndpoint(),
-		api.NewHostEndpointList(),
-		[]string{"NODE", "NAME"},
-		[]string{"NODE", "NAME", "INTERFACE", "IPS", "PROFILES"},
-		map[string]string{
+	Register(ResourceDefinition{
+		Resource:     api.NewHostEndpoint(),
+		ResourceList: api.NewHostEndpointList(),
+		Plural:       "hostEndpoints",
+		ShortNames:   []string{"hep"},
+		NodeScoped:   true,
+		Identifiers:  []Identifier{IdentifierName, IdentifierNode},
+		FromIdentifiers: func(ids map[string]string) (unversioned.Resource, error) {
+			r := api.NewHostEndpoint()
+			r.Metadata.Name = ids["<NAME>"]
+			r.Metadata.Node = ids["--node"]
+			return *r, nil
+		},
+		TableHeadings:     []string{"NODE", "NAME"},
+		TableHeadingsWide: []string{"NODE", "NAME", "INTERFACE", "IPS", "PROFILES"},
+		HeadingsMap: map[string]string{
 			"NODE":      "{{.Metadata.Node}}",
 			"NAME":      "{{.Metadata.Name}}",
 			"INTERFACE": "{{.Spec.InterfaceName}}",
 			"IPS":       "{{join .Spec.ExpectedIPs \",\"}}",
 			"PROFILES":  "{{join .Spec.Profiles \",\"}}",
+			"LABELS":    "{{labels .Metadata.Labels}}",
 		},
-		func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+		Apply: func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
 			r := resource.(api.HostEndpoint)
 			return client.HostEndpoints().Apply(&r)
 		},
-		func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+		Create: func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
 			r := resource.(api.HostEndpoint)
 			return client.HostEndpoints().Create(&r)
 		},
-		func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+		Update: func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
 			r := resource.(api.HostEndpoint)
 			return client.HostEndpoints().Update(&r)
 		},
-		func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+		Delete: func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
 			r := resource.(api.HostEndpoint)
 			return nil, client.HostEndpoints().Delete(r.Metadata)
 		},
-		func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+		List: func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
 			r := resource.(api.HostEndpoint)
 			return client.HostEndpoints().List(r.Metadata)
 		},
-	)
+	})
 }
@@ -18,38 +18,53 @@ import (
 	"github.com/projectcalico/libcalico-go/lib/api"
 	"github.com/projectcalico/libcalico-go/lib/api/unversioned"
 	"github.com/projectcalico/libcalico-go/lib/client"
+	"github.com/projectcalico/libcalico-go/lib/net"
 )
 
 func init() {
-	registerResource(
-		api.NewIPPool(),
-		api.NewIPPoolList(),
-		[]string{"CIDR"},
-		[]string{"CIDR", "NAT", "IPIP"},
-		map[string]string{
+	Register(ResourceDefinition{
+		Resource:     api.NewIPPool(),
+		ResourceList: api.NewIPPoolList(),
+		Plural:       "ipPools",
+		ShortNames:   []string{"pool"},
+		Identifiers:  []Identifier{IdentifierName},
+		FromIdentifiers: func(ids map[string]string) (unversioned.Resource, error) {
+			r := api.NewIPPool()
+			if name := ids["<NAME>"]; name != "" {
+				_, cidr, err := net.ParseCIDR(name)
+				if err != nil {
+					return nil, err
+				}
+				r.Metadata.CIDR = *cidr
+			}
+			return *r, nil
+		},
+		TableHeadings:     []string{"CIDR"},
+		TableHeadingsWide: []string{"CIDR", "NAT", "IPIP"},
+		HeadingsMap: map[string]string{
 			"CIDR": "{{.Metadata.CIDR}}",
 			"NAT":  "{{.Spec.NATOutgoing}}",
 			"IPIP": "{{if .Spec.IPIP}}{{.Spec.IPIP.Enabled}}{{else}}false{{end}}",
 		},
-		func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+		Apply: func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
 			r := resource.(api.IPPool)
 			return client.IPPools().Apply(&r)
 		},
-		func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+		Create: func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
 			r := resource.(api.IPPool)
 			return client.IPPools().Create(&r)
 		},
-		func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+		Update: func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
 			r := resource.(api.IPPool)
 			return client.IPPools().Update(&r)
 		},
-		func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+		Delete: func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
 			r := resource.(api.IPPool)
 			return nil, client.IPPools().Delete(r.Metadata)
 		},
-		func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+		List: func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
 			r := resource.(api.IPPool)
 			return client.IPPools().List(r.Metadata)
 		},
-	)
+	})
 }
@@ -0,0 +1,206 @@
+// Copyright (c) 2016 Tigera, Inc. All rights reserved.
+
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resourcemgr
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/projectcalico/libcalico-go/lib/api/unversioned"
+)
+
+// KindInfo contains the names and command line identifiers of a resource kind.
+type KindInfo struct {
+	// The canonical kind name, as used in the resource type metadata.
+	Kind string
+
+	// The plural form of the kind name.
+	Plural string
+
+	// Short names that may be used in place of the kind name on the command line.
+	ShortNames []string
+
+	// Whether resources of this kind are scoped to a node.
+	NodeScoped bool
+
+	// The command line arguments used to identify a resource of this kind.
+	Identifiers []Identifier
+
+	// Function used to construct a resource from the command line identifiers.
+	fromIdentifiers IdentifiersFunc
+
+	// Whether resources of this kind may be listed.
+	listable bool
+}
+
+// Listable returns true if resources of the kind may be specified on the command line and
+// listed, for example by "calicoctl get".
+func (ki KindInfo) Listable() bool {
+	return ki.fromIdentifiers != nil && ki.listable
+}
+
+// IdentifiersFunc constructs a resource from the values of the command line identifiers.
+// The supplied map is keyed off the Identifier Arg, and contains an entry for each of the
+// identifiers of the kind (the value is blank if the identifier was not specified).
+type IdentifiersFunc func(ids map[string]string) (unversioned.Resource, error)
+
+// Identifier describes a command line argument used to identify a resource.
+type Identifier struct {
+	// The argument.  This is "<NAME>" for the positional name argument, otherwise
+	// the long option name, e.g. "--node".
+	Arg string
+
+	// The short option name, e.g. "-n", or blank if there is no short option.
+	Short string
+
+	// The option value placeholder, e.g. "<NODE>".
+	Value string
+
+	// The description of the option displayed in the command help text.
+	Description string
+}
+
+// The identifiers used by the built-in resource kinds.  Resource kinds registered outside
+// of this package should re-use these identifiers where appropriate.
+var (
+	IdentifierName = Identifier{
+		Arg:         "<NAME>",
+		Description: "The name of the resource.",
+	}
+	IdentifierNode = Identifier{
+		Arg:   "--node",
+		Short: "-n",
+		Value: "<NODE>",
+		Description: "The node (this may be the hostname of the compute server if your " +
+			"installation does not explicitly set the names of each Calico node).",
+	}
+	IdentifierOrchestrator = Identifier{
+		Arg:         "--orchestrator",
+		Value:       "<ORCH>",
+		Description: "The orchestrator (valid for workload endpoints).",
+	}
+	IdentifierWorkload = Identifier{
+		Arg:         "--workload",
+		Value:       "<WORKLOAD>",
+		Description: "The workload (valid for workload endpoints).",
+	}
+	IdentifierScope = Identifier{
+		Arg:   "--scope",
+		Value: "<SCOPE>",
+		Description: "The scope of the resource type.  One of global, node.  This is " +
+			"only valid for BGP peers and is used to indicate whether the peer is a " +
+			"global peer or node-specific.",
+	}
+)
+
+// Store the KindInfo for each registered kind, in order of registration.
+var kinds []KindInfo
+
+// The order in which the built-in kinds are displayed, for example by "calicoctl get all".
+// Other kinds are displayed after the built-in kinds, in order of registration.
+var builtinKindOrder = []string{
+	"node", "bgpPeer", "hostEndpoint", "workloadEndpoint", "ipPool", "policy", "profile",
+}
+
+// Kinds returns the KindInfo for each registered kind, in display order.
+func Kinds() []KindInfo {
+	s := make([]KindInfo, len(kinds))
+	copy(s, kinds)
+	sort.Stable(kindInfoByDisplayOrder(s))
+	return s
+}
+
+// LookupKind returns the KindInfo for the kind with the supplied name.  The name is case
+// insensitive, and may be the kind, the plural of the kind, or one of the short names.
+func LookupKind(name string) (KindInfo, error) {
+	for _, ki := range kinds {
+		if ki.hasName(name) {
+			return ki, nil
+		}
+	}
+	return KindInfo{}, fmt.Errorf("Resource type '%s' is not supported", name)
+}
+
+// hasName returns true if the supplied name is one of the names of the kind.
+func (ki KindInfo) hasName(name string) bool {
+	if strings.EqualFold(name, ki.Kind) || strings.EqualFold(name, ki.Plural) {
+		return true
+	}
+	for _, sn := range ki.ShortNames {
+		if strings.EqualFold(name, sn) {
+			return true
+		}
+	}
+	return false
+}
+
+// IdentifierOptions returns the option identifiers (that is excluding the positional name
+// identifier) used by any of the registered kinds.  Each option is returned once, in order
+// of first registration.
+func IdentifierOptions() []Identifier {
+	ids := []Identifier{}
+	seen := make(map[string]bool)
+	for _, ki := range kinds {
+		for _, id := range ki.Identifiers {
+			if id.Arg == IdentifierName.Arg || seen[id.Arg] {
+				continue
+			}
+			seen[id.Arg] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// NewResourceFromIdentifiers returns a resource of the specified kind constructed from
+// the command line identifiers.  The ids map is keyed off the Identifier Arg, identifiers
+// that are not used by the kind are ignored.
+func NewResourceFromIdentifiers(kind string, ids map[string]string) (unversioned.Resource, error) {
+	ki, err := LookupKind(kind)
+	if err != nil {
+		return nil, err
+	}
+	if ki.fromIdentifiers == nil {
+		return nil, fmt.Errorf("Resource type '%s' cannot be specified on the command line", ki.Kind)
+	}
+
+	kindIds := make(map[string]string, len(ki.Identifiers))
+	for _, id := range ki.Identifiers {
+		kindIds[id.Arg] = ids[id.Arg]
+	}
+	return ki.fromIdentifiers(kindIds)
+}
+
+// kindInfoByDisplayOrder is used to sort a slice of KindInfo into display order.  The sort
+// must be stable so that other kinds remain in order of registration.
+type kindInfoByDisplayOrder []KindInfo
+
+func (k kindInfoByDisplayOrder) Len() int      { return len(k) }
+func (k kindInfoByDisplayOrder) Swap(i, j int) { k[i], k[j] = k[j], k[i] }
+func (k kindInfoByDisplayOrder) Less(i, j int) bool {
+	return displayRank(k[i].Kind) < displayRank(k[j].Kind)
+}
+
+// displayRank returns the position of the kind in the display order of the built-in
+// kinds, or the number of built-in kinds if it is not a built-in kind.
+func displayRank(kind string) int {
+	for i, k := range builtinKindOrder {
+		if k == kind {
+			return i
+		}
+	}
+	return len(builtinKindOrder)
+}
@@ -21,36 +21,43 @@ import (
 )
 
 func init() {
-	registerResource(
-		api.NewNode(),
-		api.NewNodeList(),
-		[]string{"NAME"},
-		[]string{"NAME", "ASN", "IPV4", "IPV6"},
-		map[string]string{
+	Register(ResourceDefinition{
+		Resource:     api.NewNode(),
+		ResourceList: api.NewNodeList(),
+		Plural:       "nodes",
+		Identifiers:  []Identifier{IdentifierName},
+		FromIdentifiers: func(ids map[string]string) (unversioned.Resource, error) {
+			r := api.NewNode()
+			r.Metadata.Name = ids["<NAME>"]
+			return *r, nil
+		},
+		TableHeadings:     []string{"NAME"},
+		TableHeadingsWide: []string{"NAME", "ASN", "IPV4", "IPV6"},
+		HeadingsMap: map[string]string{
 			"NAME": "{{.Metadata.Name}}",
 			"ASN":  "{{if .Spec.BGP}}{{if .Spec.BGP.ASNumber}}{{.Spec.BGP.ASNumber}}{{end}}{{end}}",
 			"IPV4": "{{if .Spec.BGP}}{{if .Spec.BGP.IPv4Address}}{{.Spec.BGP.IPv4Address}}{{end}}{{end}}",
 			"IPV6": "{{if .Spec.BGP}}{{if .Spec.BGP.IPv6Address}}{{.Spec.BGP.IPv6Address}}{{end}}{{end}}",
 		},
-		func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+		Apply: func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
 			r := resource.(api.Node)
 			return client.Nodes().Apply(&r)
 		},
-		func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+		Create: func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
 			r := resource.(api.Node)
 			return client.Nodes().Create(&r)
 		},
-		func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+		Update: func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
 			r := resource.(api.Node)
 			return client.Nodes().Update(&r)
 		},
-		func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+		Delete: func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
 			r := resource.(api.Node)
 			return nil, client.Nodes().Delete(r.Metadata)
 		},
-		func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+		List: func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
 			r := resource.(api.Node)
 			return client.Nodes().List(r.Metadata)
 		},
-	)
+	})
 }
@@ -21,35 +21,43 @@ import (
 )
 
 func init() {
-	registerResource(
-		api.NewPolicy(),
-		api.NewPolicyList(),
-		[]string{"NAME"},
-		[]string{"NAME", "ORDER", "SELECTOR"},
-		map[string]string{
+	Register(ResourceDefinition{
+		Resource:     api.NewPolicy(),
+		ResourceList: api.NewPolicyList(),
+		Plural:       "policies",
+		ShortNames:   []string{"pol"},
+		Identifiers:  []Identifier{IdentifierName},
+		FromIdentifiers: func(ids map[string]string) (unversioned.Resource, error) {
+			r := api.NewPolicy()
+			r.Metadata.Name = ids["<NAME>"]
+			return *r, nil
+		},
+		TableHeadings:     []string{"NAME"},
+		TableHeadingsWide: []string{"NAME", "ORDER", "SELECTOR"},
+		HeadingsMap: map[string]string{
 			"NAME":     "{{.Metadata.Name}}",
 			"ORDER":    "{{.Spec.Order}}",
 			"SELECTOR": "{{.Spec.Selector}}",
 		},
-		func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+		Apply: func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
 			r := resource.(api.Policy)
 			return client.Policies().Apply(&r)
 		},
-		func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+		Create: func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
 			r := resource.(api.Policy)
 			return client.Policies().Create(&r)
 		},
-		func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+		Update: func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
 			r := resource.(api.Policy)
 			return client.Policies().Update(&r)
 		},
-		func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+		Delete: func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
 			r := resource.(api.Policy)
 			return nil, client.Policies().Delete(r.Metadata)
 		},
-		func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+		List: func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
 			r := resource.(api.Policy)
 			return client.Policies().List(r.Metadata)
 		},
-	)
+	})
 }
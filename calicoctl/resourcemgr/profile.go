@@ -21,34 +21,42 @@ import (
 )
 
 func init() {
-	registerResource(
-		api.NewProfile(),
-		api.NewProfileList(),
-		[]string{"NAME"},
-		[]string{"NAME", "TAGS"},
-		map[string]string{
+	Register(ResourceDefinition{
+		Resource:     api.NewProfile(),
+		ResourceList: api.NewProfileList(),
+		Plural:       "profiles",
+		ShortNames:   []string{"pro"},
+		Identifiers:  []Identifier{IdentifierName},
+		FromIdentifiers: func(ids map[string]string) (unversioned.Resource, error) {
+			r := api.NewProfile()
+			r.Metadata.Name = ids["<NAME>"]
+			return *r, nil
+		},
+		TableHeadings:     []string{"NAME"},
+		TableHeadingsWide: []string{"NAME", "TAGS"},
+		HeadingsMap: map[string]string{
 			"NAME": "{{.Metadata.Name}}",
 			"TAGS": "{{join .Spec.Tags \",\"}}",
 		},
-		func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+		Apply: func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
 			r := resource.(api.Profile)
 			return client.Profiles().Apply(&r)
 		},
-		func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+		Create: func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
 			r := resource.(api.Profile)
 			return client.Profiles().Create(&r)
 		},
-		func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+		Update: func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
 			r := resource.(api.Profile)
 			return client.Profiles().Update(&r)
 		},
-		func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+		Delete: func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
 			r := resource.(api.Profile)
 			return nil, client.Profiles().Delete(r.Metadata)
 		},
-		func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+		List: func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
 			r := resource.(api.Profile)
 			return client.Profiles().List(r.Metadata)
 		},
-	)
+	})
 }
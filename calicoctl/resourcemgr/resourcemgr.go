@@ -19,6 +19,7 @@ import (
 
 	"fmt"
 	"reflect"
+	"sort"
 	"strings"
 
 	"io/ioutil"
@@ -37,9 +38,13 @@ import (
 // The ResourceManager interface provides useful function for each resource type.  This includes:
 //	-  Commands to assist with generation of table output format of resources
 //	-  Commands to manage resource instances through an un-typed interface.
+//	-  Commands to describe the structure of the resource.
 type ResourceManager interface {
 	GetTableDefaultHeadings(wide bool) []string
+	GetTableHeadings() []string
 	GetTableTemplate(columns []string) (string, error)
+	GetTableRowTemplate(columns []string) (string, error)
+	GetFieldInfo(path []string) (FieldInfo, error)
 	Apply(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error)
 	Create(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error)
 	Update(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error)
@@ -70,6 +75,7 @@ type resourceHelper struct {
 	update            ResourceActionCommand
 	delete            ResourceActionCommand
 	list              ResourceActionCommand
+	validate          func(unversioned.Resource) error
 }
 
 func (r resourceHelper) String() string {
@@ -79,42 +85,129 @@ func (r resourceHelper) String() string {
 // Store a resourceHelper for each resource unversioned.TypeMetadata.
 var helpers map[unversioned.TypeMetadata]resourceHelper
 
-func registerResource(res unversioned.Resource, resList unversioned.Resource,
-	tableHeadings []string, tableHeadingsWide []string, headingsMap map[string]string,
-	apply, create, update, delete, list ResourceActionCommand) {
+// ResourceDefinition defines a resource kind.  A resource kind is registered by passing its
+// definition to Register, after which it is available to each of the resource management
+// commands (create, apply, replace, delete and get) and to the explain and api-resources
+// commands.
+type ResourceDefinition struct {
+	// A new instance of the resource and of the resource list (e.g. as returned by
+	// api.NewPolicy() and api.NewPolicyList()).  These are used to determine the
+	// type metadata and concrete structure types of the resource.
+	Resource     unversioned.Resource
+	ResourceList unversioned.Resource
+
+	// The plural and short names of the kind, and whether the resource is scoped to a
+	// node.  The canonical kind name is taken from the resource type metadata.
+	Plural     string
+	ShortNames []string
+	NodeScoped bool
+
+	// The command line identifiers of the resource, and the function used to construct a
+	// resource from those identifiers.  The FromIdentifiers function is required for the
+	// resource to be specified by kind on the command line.
+	Identifiers     []Identifier
+	FromIdentifiers IdentifiersFunc
+
+	// The default table headings for the ps and wide output formats, and the go-template
+	// snippet used to display the value of each valid heading.
+	TableHeadings     []string
+	TableHeadingsWide []string
+	HeadingsMap       map[string]string
+
+	// Functions to handle each of the resource management actions.  An action may be
+	// nil if it is not supported by the resource.
+	Apply  ResourceActionCommand
+	Create ResourceActionCommand
+	Update ResourceActionCommand
+	Delete ResourceActionCommand
+	List   ResourceActionCommand
+
+	// Optional validation of a resource loaded from file, performed in addition to the
+	// standard libcalico-go validation.
+	Validate func(unversioned.Resource) error
+}
 
+// Register registers a resource kind.  This should be called from an init function.  This
+// panics if the definition is invalid or the kind has already been registered.
+func Register(def ResourceDefinition) {
+	if def.Resource == nil || def.ResourceList == nil {
+		panic("resourcemgr: Register called without a resource or resource list")
+	}
 	if helpers == nil {
 		helpers = make(map[unversioned.TypeMetadata]resourceHelper)
 	}
 
-	tmd := res.GetTypeMetadata()
+	tmd := def.Resource.GetTypeMetadata()
+	if _, ok := helpers[tmd]; ok {
+		panic(fmt.Sprintf("resourcemgr: Register called twice for kind %s", tmd.Kind))
+	}
+
+	// Add the kind to the kind registry.  Each of the names of the kind must be unique.
+	names := append([]string{def.Plural, tmd.Kind}, def.ShortNames...)
+	for _, ki := range kinds {
+		for _, name := range names {
+			if name != "" && ki.hasName(name) {
+				panic(fmt.Sprintf("resourcemgr: name %s of kind %s is already used by kind %s",
+					name, tmd.Kind, ki.Kind))
+			}
+		}
+	}
+	kinds = append(kinds, KindInfo{
+		Kind:            tmd.Kind,
+		Plural:          def.Plural,
+		ShortNames:      def.ShortNames,
+		NodeScoped:      def.NodeScoped,
+		Identifiers:     def.Identifiers,
+		fromIdentifiers: def.FromIdentifiers,
+		listable:        def.List != nil,
+	})
+
 	rh := resourceHelper{
 		typeMetadata:      tmd,
-		resourceType:      reflect.ValueOf(res).Elem().Type(),
-		tableHeadings:     tableHeadings,
-		tableHeadingsWide: tableHeadingsWide,
-		headingsMap:       headingsMap,
+		resourceType:      reflect.ValueOf(def.Resource).Elem().Type(),
+		tableHeadings:     def.TableHeadings,
+		tableHeadingsWide: def.TableHeadingsWide,
+		headingsMap:       def.HeadingsMap,
 		isList:            false,
-		apply:             apply,
-		create:            create,
-		update:            update,
-		delete:            delete,
-		list:              list,
+		apply:             def.Apply,
+		create:            def.Create,
+		update:            def.Update,
+		delete:            def.Delete,
+		list:              def.List,
+		validate:          def.Validate,
 	}
 	helpers[tmd] = rh
 
-	tmd = resList.GetTypeMetadata()
+	tmd = def.ResourceList.GetTypeMetadata()
 	rh = resourceHelper{
 		typeMetadata:      tmd,
-		resourceType:      reflect.ValueOf(resList).Elem().Type(),
-		tableHeadings:     tableHeadings,
-		tableHeadingsWide: tableHeadingsWide,
-		headingsMap:       headingsMap,
+		resourceType:      reflect.ValueOf(def.ResourceList).Elem().Type(),
+		tableHeadings:     def.TableHeadings,
+		tableHeadingsWide: def.TableHeadingsWide,
+		headingsMap:       def.HeadingsMap,
 		isList:            true,
 	}
 	helpers[tmd] = rh
 }
 
+// Validate validates a resource using the libcalico-go validator, and any additional
+// validation registered for the resource kind.
+func Validate(r unversioned.Resource) error {
+	return validate(r)
+}
+
+// validate validates a resource using the libcalico-go validator, and any additional
+// validation registered for the resource kind.
+func validate(r unversioned.Resource) error {
+	if err := validator.Validate(r); err != nil {
+		return err
+	}
+	if rh, ok := helpers[r.GetTypeMetadata()]; ok && rh.validate != nil {
+		return rh.validate(r)
+	}
+	return nil
+}
+
 // Create a new concrete resource structure based on the type.  If the type is
 // a list, this creates a concrete Resource-List of the required type.
 func newResource(tm unversioned.TypeMetadata) (unversioned.Resource, error) {
@@ -176,7 +269,7 @@ func unmarshalResource(tm unversioned.TypeMetadata, b []byte) ([]unversioned.Res
 	}
 
 	log.Infof("Type of unpacked data: %v", reflect.TypeOf(unpacked))
-	if err = validator.Validate(unpacked); err != nil {
+	if err = validate(unpacked); err != nil {
 		return nil, err
 	}
 
@@ -209,7 +302,7 @@ func unmarshalSliceOfResources(tml []unversioned.TypeMetadata, b []byte) ([]unve
 	// Validate the data in the structures.  The validator does not handle slices, so
 	// validate each resource separately.
 	for _, r := range unpacked {
-		if err := validator.Validate(r); err != nil {
+		if err := validate(r); err != nil {
 			return nil, err
 		}
 	}
@@ -256,6 +349,17 @@ func (rh resourceHelper) GetTableDefaultHeadings(wide bool) []string {
 	}
 }
 
+// GetTableHeadings returns the complete set of headings that may be used in the ps-style
+// and custom-columns get output for the resource, sorted alphabetically.
+func (rh resourceHelper) GetTableHeadings() []string {
+	headings := make([]string, 0, len(rh.headingsMap))
+	for heading := range rh.headingsMap {
+		headings = append(headings, heading)
+	}
+	sort.Strings(headings)
+	return headings
+}
+
 // GetTableTemplate constructs the go-lang template string from the supplied set of headings.
 // The template separates columns using tabs so that a tabwriter can be used to pretty-print
 // the table.
@@ -268,6 +372,21 @@ func (rh resourceHelper) GetTableTemplate(headings []string) (string, error) {
 	}
 	buf.WriteByte('\n')
 
+	// Write the rows.
+	rows, err := rh.GetTableRowTemplate(headings)
+	if err != nil {
+		return "", err
+	}
+	buf.WriteString(rows)
+
+	return buf.String(), nil
+}
+
+// GetTableRowTemplate constructs the go-lang template string for the table rows (that is
+// the table without the headings line) from the supplied set of headings.
+func (rh resourceHelper) GetTableRowTemplate(headings []string) (string, error) {
+	buf := new(bytes.Buffer)
+
 	// If this is a list type, we need to iterate over the list items.
 	if rh.isList {
 		buf.WriteString("{{range .Items}}")
@@ -277,13 +396,9 @@ func (rh resourceHelper) GetTableTemplate(headings []string) (string, error) {
 	for _, heading := range headings {
 		value, ok := rh.headingsMap[heading]
 		if !ok {
-			headings := make([]string, 0, len(rh.headingsMap))
-			for heading := range rh.headingsMap {
-				headings = append(headings, heading)
-			}
 			return "", fmt.Errorf("Unknown heading %s, valid values are: %s",
 				heading,
-				strings.Join(headings, ", "))
+				strings.Join(rh.GetTableHeadings(), ", "))
 		}
 		buf.WriteString(value)
 		buf.WriteByte('\t')
@@ -298,10 +413,20 @@ func (rh resourceHelper) GetTableTemplate(headings []string) (string, error) {
 	return buf.String(), nil
 }
 
+// GetFieldInfo returns a description of the field identified by the path (a slice of field
+// names or JSON/YAML keys).  An empty path describes the resource itself.  The returned
+// FieldInfo includes the descriptions of the fields directly contained in the field.
+func (rh resourceHelper) GetFieldInfo(path []string) (FieldInfo, error) {
+	return getFieldInfo(rh.resourceType, path)
+}
+
 // Apply is an un-typed method to apply (create or update) a resource.  This calls directly
 // through to the resource helper specific Apply method which will map the untyped call to
 // the typed interface on the client.
 func (rh resourceHelper) Apply(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+	if rh.apply == nil {
+		return nil, rh.unsupported("apply")
+	}
 	return rh.apply(client, resource)
 }
 
@@ -309,6 +434,9 @@ func (rh resourceHelper) Apply(client *client.Client, resource unversioned.Resou
 // through to the resource helper specific Create method which will map the untyped call to
 // the typed interface on the client.
 func (rh resourceHelper) Create(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+	if rh.create == nil {
+		return nil, rh.unsupported("create")
+	}
 	return rh.create(client, resource)
 }
 
@@ -316,6 +444,9 @@ func (rh resourceHelper) Create(client *client.Client, resource unversioned.Reso
 // through to the resource helper specific Update method which will map the untyped call to
 // the typed interface on the client.
 func (rh resourceHelper) Update(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+	if rh.update == nil {
+		return nil, rh.unsupported("update")
+	}
 	return rh.update(client, resource)
 }
 
@@ -323,6 +454,9 @@ func (rh resourceHelper) Update(client *client.Client, resource unversioned.Reso
 // through to the resource helper specific Delete method which will map the untyped call to
 // the typed interface on the client.
 func (rh resourceHelper) Delete(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+	if rh.delete == nil {
+		return nil, rh.unsupported("delete")
+	}
 	return rh.delete(client, resource)
 }
 
@@ -330,9 +464,17 @@ func (rh resourceHelper) Delete(client *client.Client, resource unversioned.Reso
 // through to the resource helper specific List method which will map the untyped call to
 // the typed interface on the client.
 func (rh resourceHelper) List(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+	if rh.list == nil {
+		return nil, rh.unsupported("list")
+	}
 	return rh.list(client, resource)
 }
 
+// unsupported returns the error used when an action is not supported by the resource.
+func (rh resourceHelper) unsupported(action string) error {
+	return fmt.Errorf("resource type '%s' does not support %s", rh.typeMetadata.Kind, action)
+}
+
 // Return the Resource Manager for a particular resource type.
 func GetResourceManager(resource unversioned.Resource) ResourceManager {
 	return helpers[resource.GetTypeMetadata()]
@@ -21,12 +21,24 @@ import (
 )
 
 func init() {
-	registerResource(
-		api.NewWorkloadEndpoint(),
-		api.NewWorkloadEndpointList(),
-		[]string{"NODE", "ORCHESTRATOR", "WORKLOAD", "NAME"},
-		[]string{"NODE", "ORCHESTRATOR", "WORKLOAD", "NAME", "NETWORKS", "NATS", "INTERFACE", "PROFILES"},
-		map[string]string{
+	Register(ResourceDefinition{
+		Resource:     api.NewWorkloadEndpoint(),
+		ResourceList: api.NewWorkloadEndpointList(),
+		Plural:       "workloadEndpoints",
+		ShortNames:   []string{"wep"},
+		NodeScoped:   true,
+		Identifiers:  []Identifier{IdentifierName, IdentifierNode, IdentifierOrchestrator, IdentifierWorkload},
+		FromIdentifiers: func(ids map[string]string) (unversioned.Resource, error) {
+			r := api.NewWorkloadEndpoint()
+			r.Metadata.Name = ids["<NAME>"]
+			r.Metadata.Orchestrator = ids["--orchestrator"]
+			r.Metadata.Workload = ids["--workload"]
+			r.Metadata.Node = ids["--node"]
+			return *r, nil
+		},
+		TableHeadings:     []string{"NODE", "ORCHESTRATOR", "WORKLOAD", "NAME"},
+		TableHeadingsWide: []string{"NODE", "ORCHESTRATOR", "WORKLOAD", "NAME", "NETWORKS", "NATS", "INTERFACE", "PROFILES"},
+		HeadingsMap: map[string]string{
 			"NODE":         "{{.Metadata.Node}}",
 			"ORCHESTRATOR": "{{.Metadata.Orchestrator}}",
 			"WORKLOAD":     "{{.Metadata.Workload}}",
@@ -38,26 +50,27 @@ func init() {
 			"PROFILES":     "{{join .Spec.Profiles \",\"}}",
 			"INTERFACE":    "{{.Spec.InterfaceName}}",
 			"MAC":          "{{.Spec.MAC}}",
+			"LABELS":       "{{labels .Metadata.Labels}}",
 		},
-		func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+		Apply: func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
 			r := resource.(api.WorkloadEndpoint)
 			return client.WorkloadEndpoints().Apply(&r)
 		},
-		func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+		Create: func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
 			r := resource.(api.WorkloadEndpoint)
 			return client.WorkloadEndpoints().Create(&r)
 		},
-		func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+		Update: func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
 			r := resource.(api.WorkloadEndpoint)
 			return client.WorkloadEndpoints().Update(&r)
 		},
-		func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+		Delete: func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
 			r := resource.(api.WorkloadEndpoint)
 			return nil, client.WorkloadEndpoints().Delete(r.Metadata)
 		},
-		func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
+		List: func(client *client.Client, resource unversioned.Resource) (unversioned.Resource, error) {
 			r := resource.(api.WorkloadEndpoint)
 			return client.WorkloadEndpoints().List(r.Metadata)
 		},
-	)
+	})
 }